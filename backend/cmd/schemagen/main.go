@@ -0,0 +1,30 @@
+// Command schemagen writes the JSON Schema of the WebSocket protocol
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"powerpoint-quiz/internal/services"
+)
+
+func main() {
+	out := flag.String("o", "", "file to write the schema to instead of stdout")
+	flag.Parse()
+
+	schema, err := json.MarshalIndent(services.ProtocolSchema(), "", "  ")
+	if err != nil {
+		log.Fatalf("Error encoding schema: %v", err)
+	}
+	schema = append(schema, '\n')
+
+	if *out == "" {
+		os.Stdout.Write(schema)
+		return
+	}
+	if err := os.WriteFile(*out, schema, 0644); err != nil {
+		log.Fatalf("Error writing schema: %v", err)
+	}
+}
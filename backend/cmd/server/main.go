@@ -1,9 +1,19 @@
 package main
 
 import (
+	"bytes"
+	"crypto/rand"
 	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"io"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
 
 	"powerpoint-quiz/internal/config"
 	"powerpoint-quiz/internal/handlers"
@@ -13,13 +23,23 @@ import (
 func main() {
 	// Load configuration
 	cfg := config.LoadConfig()
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+
+	// Initialize room storage
+	store := newRoomStore(cfg.Storage)
+	history := newHistoryStore(cfg.Storage)
+	if closer, ok := store.(io.Closer); ok {
+		go closeOnSignal(closer)
+	}
 
 	// Initialize services
-	wsService := services.NewWebSocketService()
+	wsService := services.NewWebSocketService(store, history, newServiceOptions(cfg))
 	go wsService.Run()
 
 	// Initialize handlers
-	wsHandler := handlers.NewWebSocketHandler(wsService)
+	wsHandler := handlers.NewWebSocketHandler(wsService, cfg.WebSocket)
 	staticHandler := handlers.NewStaticHandler()
 
 	// Setup routes
@@ -51,6 +71,133 @@ func main() {
 	}
 }
 
+// newServiceOptions maps configuration onto WebSocket service options
+func newServiceOptions(cfg *config.Config) services.Options {
+	opts := services.DefaultOptions()
+	if cfg.Game.TimerTickMs > 0 {
+		opts.TimerTick = time.Duration(cfg.Game.TimerTickMs) * time.Millisecond
+	}
+	if cfg.Game.BuzzWindowMs >= 0 {
+		opts.BuzzWindow = time.Duration(cfg.Game.BuzzWindowMs) * time.Millisecond
+	}
+	if cfg.Game.ClockSyncSamples > 0 {
+		opts.ClockSyncSamples = cfg.Game.ClockSyncSamples
+	}
+	switch {
+	case cfg.Session.Secret != "":
+		opts.SessionSecret = []byte(cfg.Session.Secret)
+	case cfg.Storage.Backend == "file":
+		// Stored rooms outlive the process, so must the keys of their tokens
+		path := filepath.Join(cfg.Storage.Dir, "session.secret")
+		secret, err := storedSecret(path)
+		if err != nil {
+			log.Fatalf("SESSION_SECRET is not set and no secret could be kept in %s: %v", path, err)
+		}
+		opts.SessionSecret = secret
+		log.Printf("SESSION_SECRET is not set, using the secret kept in %s", path)
+	default:
+		log.Printf("SESSION_SECRET is not set, player sessions and admin and host tokens will not survive a restart")
+	}
+	if cfg.Session.TTLHours > 0 {
+		opts.SessionTTL = time.Duration(cfg.Session.TTLHours) * time.Hour
+	}
+	opts.AdminTokenTTL = time.Duration(cfg.Session.AdminTTLHours) * time.Hour
+	opts.AuthMaxFailures = cfg.Session.AuthMaxFailures
+	opts.AuthLockout = time.Duration(cfg.Session.AuthLockoutMin) * time.Minute
+	if cfg.Session.ReconnectGraceMs >= 0 {
+		opts.ReconnectGrace = time.Duration(cfg.Session.ReconnectGraceMs) * time.Millisecond
+	}
+	if cfg.Session.ReplayBuffer > 0 {
+		opts.ReplayBuffer = cfg.Session.ReplayBuffer
+	}
+	if cfg.WebSocket.SendBuffer > 0 {
+		opts.SendBuffer = cfg.WebSocket.SendBuffer
+	}
+	if cfg.WebSocket.MaxDropped >= 0 {
+		opts.MaxDropped = cfg.WebSocket.MaxDropped
+	}
+	if cfg.WebSocket.SnapshotEvery > 0 {
+		opts.SnapshotEvery = cfg.WebSocket.SnapshotEvery
+	}
+	if cfg.WebSocket.MaxMessageSize > 0 {
+		opts.MaxMessageSize = int(cfg.WebSocket.MaxMessageSize)
+	}
+	// Both lists passed Validate
+	opts.ConnRateLimits, _ = config.ParseRateLimits(cfg.Limits.PerConnection)
+	opts.IPRateLimits, _ = config.ParseRateLimits(cfg.Limits.PerIP)
+	opts.MaxRateStrikes = cfg.Limits.MaxStrikes
+	opts.MaxRoomsPerIP = cfg.Limits.MaxRoomsPerIP
+	return opts
+}
+
+// storedSecret returns the session secret kept in a file, generating and
+// saving one first if there is none
+func storedSecret(path string) ([]byte, error) {
+	if secret, err := os.ReadFile(path); err == nil && len(bytes.TrimSpace(secret)) > 0 {
+		return bytes.TrimSpace(secret), nil
+	} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+	secret := []byte(hex.EncodeToString(raw))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, append(secret, '\n'), 0600); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// closeOnSignal closes the room store, writing out the changes still
+// waiting for a flush, and exits when the server is stopped
+func closeOnSignal(store io.Closer) {
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+	if err := store.Close(); err != nil {
+		log.Printf("Error closing room store: %v", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// newRoomStore creates the room store selected by configuration
+func newRoomStore(cfg config.StorageConfig) services.RoomStore {
+	switch cfg.Backend {
+	case "file":
+		store, err := services.NewFileRoomStore(cfg.Dir, cfg.CompactEvery, time.Duration(cfg.FlushMs)*time.Millisecond)
+		if err != nil {
+			log.Fatalf("Failed to open room store in %s: %v", cfg.Dir, err)
+		}
+		log.Printf("Using file room store in %s", cfg.Dir)
+		return store
+	case "memory", "":
+		log.Printf("Using in-memory room store (rooms are lost on restart)")
+		return services.NewMemoryRoomStore()
+	default:
+		log.Fatalf("Unknown STORE_BACKEND %q (expected \"memory\" or \"file\")", cfg.Backend)
+		return nil
+	}
+}
+
+// newHistoryStore creates the room event history matching the room store
+func newHistoryStore(cfg config.StorageConfig) services.HistoryStore {
+	if cfg.Backend != "file" {
+		return services.NewMemoryHistoryStore()
+	}
+	dir := filepath.Join(cfg.Dir, "history")
+	history, err := services.NewFileHistoryStore(dir)
+	if err != nil {
+		log.Fatalf("Failed to open room history in %s: %v", dir, err)
+	}
+	return history
+}
+
 // getTLSVersion converts string version to tls.Version constant
 func getTLSVersion(version string) uint16 {
 	switch version {
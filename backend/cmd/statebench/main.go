@@ -0,0 +1,150 @@
+// Command statebench measures how much state traffic delta updates save. It
+// plays the same game twice against an in-process WebSocket service, once
+// with clients that get every full state and once with clients that opted
+// into state patches, and prints the bytes the players received.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"powerpoint-quiz/internal/models"
+	"powerpoint-quiz/internal/services"
+)
+
+// traffic counts what the players of one run received
+type traffic struct {
+	messages   int64
+	bytes      int64
+	stateBytes int64 // state and state_patch messages only
+}
+
+func main() {
+	players := flag.Int("players", 200, "players in the room")
+	rounds := flag.Int("rounds", 5, "questions in which every player buzzes")
+	snapshotEvery := flag.Int("snapshot-every", services.DefaultOptions().SnapshotEvery, "patches between full snapshots")
+	flag.Parse()
+
+	// The service logs every event
+	log.SetOutput(io.Discard)
+
+	full := run(*players, *rounds, *snapshotEvery, false)
+	delta := run(*players, *rounds, *snapshotEvery, true)
+
+	fmt.Printf("players=%d rounds=%d clicks=%d snapshot-every=%d\n\n",
+		*players, *rounds, *players**rounds, *snapshotEvery)
+	fmt.Printf("%-6s %10s %14s %14s\n", "mode", "messages", "state bytes", "total bytes")
+	for _, row := range []struct {
+		name string
+		t    traffic
+	}{{"full", full}, {"delta", delta}} {
+		fmt.Printf("%-6s %10d %14d %14d\n", row.name, row.t.messages, row.t.stateBytes, row.t.bytes)
+	}
+	if full.stateBytes > 0 {
+		fmt.Printf("\nstate traffic reduced by %.1f%%, total traffic by %.1f%%\n",
+			100*(1-float64(delta.stateBytes)/float64(full.stateBytes)),
+			100*(1-float64(delta.bytes)/float64(full.bytes)))
+	}
+}
+
+// run plays the game once and returns what the players received
+func run(players, rounds, snapshotEvery int, delta bool) traffic {
+	opts := services.DefaultOptions()
+	opts.SendBuffer = 1 << 16 // Nobody is slow here
+	opts.MaxDropped = 0
+	opts.BuzzWindow = 0
+	opts.ClockSyncSamples = 0
+	opts.SnapshotEvery = snapshotEvery
+	ws := services.NewWebSocketService(services.NewMemoryRoomStore(), services.NewMemoryHistoryStore(), opts)
+
+	host := ws.NewClient(nil, "")
+	ws.HandleEvent(host, models.Event{Type: models.EventCreateRoom})
+	code := roomCode(host)
+	go discard(host)
+
+	var t traffic
+	var wg sync.WaitGroup
+	clients := make([]*models.Client, players)
+	for i := range clients {
+		client := ws.NewClient(nil, "")
+		client.Delta = delta
+		clients[i] = client
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			count(client, &t)
+		}()
+		ws.HandleEvent(client, models.Event{
+			Type:     models.EventJoin,
+			QuizID:   code,
+			UserID:   fmt.Sprintf("player%03d", i),
+			Nickname: fmt.Sprintf("Player %d", i),
+		})
+	}
+
+	ws.HandleEvent(host, models.Event{Type: models.EventHostSetState, Phase: models.PhaseActive})
+	for r := 0; r < rounds; r++ {
+		ws.HandleEvent(host, models.Event{Type: models.EventStartQuestion})
+		for i, client := range clients {
+			ws.HandleEvent(client, models.Event{Type: models.EventClick, UserID: fmt.Sprintf("player%03d", i)})
+		}
+		ws.HandleEvent(host, models.Event{Type: models.EventAnswerConfirmation, IsCorrect: true})
+		ws.HandleEvent(host, models.Event{Type: models.EventNextQuestion})
+	}
+
+	// A REST call waits behind every queued event of the room
+	ws.Leaderboard(ws.GetRoom(code))
+	for _, client := range clients {
+		for len(client.Send) > 0 {
+			time.Sleep(time.Millisecond)
+		}
+		close(client.Send)
+	}
+	wg.Wait()
+	close(host.Send)
+	return t
+}
+
+// roomCode reads the code of the room the host just created
+func roomCode(host *models.Client) string {
+	for message := range host.Send {
+		var event struct {
+			Type models.EventType `json:"type"`
+			Data struct {
+				Code string `json:"code"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(message, &event); err == nil && event.Type == models.EventRoomCreated {
+			return event.Data.Code
+		}
+	}
+	fmt.Fprintln(os.Stderr, "room was not created")
+	os.Exit(1)
+	return ""
+}
+
+func discard(client *models.Client) {
+	for range client.Send {
+	}
+}
+
+func count(client *models.Client, t *traffic) {
+	for message := range client.Send {
+		var event struct {
+			Type models.EventType `json:"type"`
+		}
+		json.Unmarshal(message, &event)
+		atomic.AddInt64(&t.messages, 1)
+		atomic.AddInt64(&t.bytes, int64(len(message)))
+		if event.Type == models.EventState || event.Type == models.EventStatePatch {
+			atomic.AddInt64(&t.stateBytes, int64(len(message)))
+		}
+	}
+}
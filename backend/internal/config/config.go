@@ -1,8 +1,12 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
 )
 
 // Config holds all configuration for the application
@@ -10,6 +14,10 @@ type Config struct {
 	Server    ServerConfig
 	WebSocket WebSocketConfig
 	TLS       TLSConfig
+	Storage   StorageConfig
+	Game      GameConfig
+	Session   SessionConfig
+	Limits    RateLimitConfig
 }
 
 // ServerConfig holds HTTP server configuration
@@ -18,14 +26,23 @@ type ServerConfig struct {
 	Host string
 }
 
-// WebSocketConfig holds WebSocket specific configuration
+// WebSocketConfig holds WebSocket specific configuration. Timeouts and
+// periods are in seconds, sizes in bytes.
 type WebSocketConfig struct {
-	ReadLimit      int64
-	ReadTimeout    int
-	WriteTimeout   int
-	PingPeriod     int
-	PongWait       int
-	MaxMessageSize int64
+	ReadLimit         int64 // largest frame read from a client
+	ReadTimeout       int   // time a new connection has to answer the first ping
+	WriteTimeout      int
+	PingPeriod        int
+	PongWait          int   // time allowed for the next pong once one arrived
+	MaxMessageSize    int64 // largest client message once decoded to JSON
+	ReadBufferSize    int
+	WriteBufferSize   int
+	EnableCompression bool     // negotiate permessage-deflate
+	TrustProxy        bool     // take client addresses from X-Real-IP set by a reverse proxy
+	AllowedOrigins    []string // origins besides the server's own host
+	SendBuffer        int      // outbound messages queued per client
+	MaxDropped        int      // dropped messages before a slow client is disconnected, 0 = never
+	SnapshotEvery     int      // state patches between full state snapshots
 }
 
 // TLSConfig holds TLS/SSL configuration
@@ -36,6 +53,50 @@ type TLSConfig struct {
 	MinVersion string
 }
 
+// StorageConfig holds room persistence configuration
+type StorageConfig struct {
+	Backend      string // "memory" or "file"
+	Dir          string
+	CompactEvery int // journal records between snapshots
+	FlushMs      int // how long changes wait to be fsynced together; 0 fsyncs each one
+}
+
+// GameConfig holds quiz gameplay tuning
+type GameConfig struct {
+	TimerTickMs      int // interval between timer_tick broadcasts
+	BuzzWindowMs     int // buzz adjudication window, 0 = first arrival wins
+	ClockSyncSamples int // pings per clock sync round
+}
+
+// SessionConfig holds session and authentication configuration
+type SessionConfig struct {
+	Secret           string // HMAC key for session, admin and host tokens, random per process if empty
+	TTLHours         int    // lifetime of a session token
+	AdminTTLHours    int    // lifetime of admin and host tokens
+	AuthMaxFailures  int    // failed authentications per IP before a lockout
+	AuthLockoutMin   int    // lockout length, also the window failures are counted in
+	ReconnectGraceMs int    // how long a disconnected player may resume before being considered gone
+	ReplayBuffer     int    // recent room events kept per room for resume
+}
+
+// RateLimitConfig holds flood protection settings. Limits are lists of
+// "type=rate/burst" entries separated by commas: a token bucket per event
+// type refilled at rate events a second and holding up to burst. The
+// "default" entry covers the types not listed, "rest" the REST API calls of
+// an address, and a rate of 0 turns a limit off.
+type RateLimitConfig struct {
+	PerConnection string // limits of each WebSocket connection
+	PerIP         string // limits of all connections and REST calls from one address
+	MaxStrikes    int    // events refused for rate before a connection is closed, 0 = never
+	MaxRoomsPerIP int    // rooms created from one address that may exist at once, 0 = no cap
+}
+
+// RateLimit is one token bucket of a rate limit list
+type RateLimit struct {
+	Rate  float64 // tokens added a second
+	Burst int     // tokens the bucket holds
+}
+
 // LoadConfig loads configuration from environment variables with defaults
 func LoadConfig() *Config {
 	return &Config{
@@ -44,12 +105,20 @@ func LoadConfig() *Config {
 			Host: getEnv("HOST", "0.0.0.0"),
 		},
 		WebSocket: WebSocketConfig{
-			ReadLimit:      getEnvAsInt64("WS_READ_LIMIT", 512),
-			ReadTimeout:    getEnvAsInt("WS_READ_TIMEOUT", 60),
-			WriteTimeout:   getEnvAsInt("WS_WRITE_TIMEOUT", 10),
-			PingPeriod:     getEnvAsInt("WS_PING_PERIOD", 54),
-			PongWait:       getEnvAsInt("WS_PONG_WAIT", 60),
-			MaxMessageSize: getEnvAsInt64("WS_MAX_MESSAGE_SIZE", 512),
+			ReadLimit:         getEnvAsInt64("WS_READ_LIMIT", 64*1024),
+			ReadTimeout:       getEnvAsInt("WS_READ_TIMEOUT", 60),
+			WriteTimeout:      getEnvAsInt("WS_WRITE_TIMEOUT", 10),
+			PingPeriod:        getEnvAsInt("WS_PING_PERIOD", 54),
+			PongWait:          getEnvAsInt("WS_PONG_WAIT", 60),
+			MaxMessageSize:    getEnvAsInt64("WS_MAX_MESSAGE_SIZE", 64*1024),
+			ReadBufferSize:    getEnvAsInt("WS_READ_BUFFER_SIZE", 4096),
+			WriteBufferSize:   getEnvAsInt("WS_WRITE_BUFFER_SIZE", 4096),
+			EnableCompression: getEnvAsBool("WS_ENABLE_COMPRESSION", false),
+			TrustProxy:        getEnvAsBool("WS_TRUST_PROXY", false),
+			AllowedOrigins:    getEnvAsList("WS_ALLOWED_ORIGINS"),
+			SendBuffer:        getEnvAsInt("WS_SEND_BUFFER", 256),
+			MaxDropped:        getEnvAsInt("WS_MAX_DROPPED", 64),
+			SnapshotEvery:     getEnvAsInt("WS_SNAPSHOT_EVERY", 50),
 		},
 		TLS: TLSConfig{
 			Enabled:    getEnvAsBool("TLS_ENABLED", true),
@@ -57,7 +126,147 @@ func LoadConfig() *Config {
 			KeyFile:    getEnv("TLS_KEY_FILE", "key.pem"),
 			MinVersion: getEnv("TLS_MIN_VERSION", "1.2"),
 		},
+		Storage: StorageConfig{
+			Backend:      getEnv("STORE_BACKEND", "memory"),
+			Dir:          getEnv("STORE_DIR", "data"),
+			CompactEvery: getEnvAsInt("STORE_COMPACT_EVERY", 1000),
+			FlushMs:      getEnvAsInt("STORE_FLUSH_MS", 100),
+		},
+		Game: GameConfig{
+			TimerTickMs:      getEnvAsInt("TIMER_TICK_MS", 1000),
+			BuzzWindowMs:     getEnvAsInt("BUZZ_WINDOW_MS", 100),
+			ClockSyncSamples: getEnvAsInt("CLOCK_SYNC_SAMPLES", 5),
+		},
+		Session: SessionConfig{
+			Secret:           getEnv("SESSION_SECRET", ""),
+			TTLHours:         getEnvAsInt("SESSION_TTL_HOURS", 12),
+			AdminTTLHours:    getEnvAsInt("ADMIN_TOKEN_TTL_HOURS", 12),
+			AuthMaxFailures:  getEnvAsInt("AUTH_MAX_FAILURES", 5),
+			AuthLockoutMin:   getEnvAsInt("AUTH_LOCKOUT_MINUTES", 15),
+			ReconnectGraceMs: getEnvAsInt("RECONNECT_GRACE_MS", 120000),
+			ReplayBuffer:     getEnvAsInt("REPLAY_BUFFER", 256),
+		},
+		Limits: RateLimitConfig{
+			PerConnection: getEnv("RATE_LIMITS", "default=20/40,click=10/20,join=1/5,create_room=0.2/3"),
+			PerIP:         getEnv("RATE_LIMITS_IP", "default=200/400,join=20/100,create_room=0.1/10,rest=10/30"),
+			MaxStrikes:    getEnvAsInt("RATE_LIMIT_MAX_STRIKES", 50),
+			MaxRoomsPerIP: getEnvAsInt("MAX_ROOMS_PER_IP", 20),
+		},
+	}
+}
+
+// Validate reports every setting that is out of range or inconsistent with
+// another, naming the environment variables involved
+func (c *Config) Validate() error {
+	return errors.Join(c.WebSocket.Validate(), c.Session.Validate(), c.Limits.Validate(), c.Storage.Validate())
+}
+
+// Validate reports the rate limit settings the server cannot work with
+func (c *RateLimitConfig) Validate() error {
+	var errs []error
+	if _, err := ParseRateLimits(c.PerConnection); err != nil {
+		errs = append(errs, fmt.Errorf("RATE_LIMITS: %w", err))
+	}
+	if _, err := ParseRateLimits(c.PerIP); err != nil {
+		errs = append(errs, fmt.Errorf("RATE_LIMITS_IP: %w", err))
+	}
+	if c.MaxStrikes < 0 {
+		errs = append(errs, fmt.Errorf("RATE_LIMIT_MAX_STRIKES must not be negative, got %d", c.MaxStrikes))
+	}
+	if c.MaxRoomsPerIP < 0 {
+		errs = append(errs, fmt.Errorf("MAX_ROOMS_PER_IP must not be negative, got %d", c.MaxRoomsPerIP))
+	}
+	return errors.Join(errs...)
+}
+
+// ParseRateLimits parses a rate limit list, see RateLimitConfig
+func ParseRateLimits(spec string) (map[string]RateLimit, error) {
+	limits := make(map[string]RateLimit)
+	for _, entry := range strings.Split(spec, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(entry, "=")
+		rateText, burstText, hasBurst := strings.Cut(value, "/")
+		if !ok || !hasBurst || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("entry %q is not like click=10/20", entry)
+		}
+		rate, err := strconv.ParseFloat(strings.TrimSpace(rateText), 64)
+		if err != nil || rate < 0 {
+			return nil, fmt.Errorf("entry %q needs a rate of at least 0", entry)
+		}
+		burst, err := strconv.Atoi(strings.TrimSpace(burstText))
+		if err != nil || burst < 1 {
+			return nil, fmt.Errorf("entry %q needs a burst of at least 1", entry)
+		}
+		// A smaller bucket could never hold one second's worth of events
+		if float64(burst) < rate {
+			return nil, fmt.Errorf("entry %q needs a burst of at least its rate", entry)
+		}
+		limits[strings.TrimSpace(name)] = RateLimit{Rate: rate, Burst: burst}
+	}
+	return limits, nil
+}
+
+// Validate reports the storage settings the server cannot work with
+func (c *StorageConfig) Validate() error {
+	if c.FlushMs < 0 {
+		return fmt.Errorf("STORE_FLUSH_MS must not be negative, got %d", c.FlushMs)
+	}
+	return nil
+}
+
+// Validate reports the session settings the server cannot work with
+func (c *SessionConfig) Validate() error {
+	var errs []error
+	if c.AdminTTLHours <= 0 {
+		errs = append(errs, fmt.Errorf("ADMIN_TOKEN_TTL_HOURS must be positive, got %d", c.AdminTTLHours))
 	}
+	if c.AuthMaxFailures <= 0 {
+		errs = append(errs, fmt.Errorf("AUTH_MAX_FAILURES must be positive, got %d", c.AuthMaxFailures))
+	}
+	if c.AuthLockoutMin <= 0 {
+		errs = append(errs, fmt.Errorf("AUTH_LOCKOUT_MINUTES must be positive, got %d", c.AuthLockoutMin))
+	}
+	return errors.Join(errs...)
+}
+
+// Validate reports the WebSocket settings the server cannot work with
+func (c *WebSocketConfig) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.ReadLimit > 0, "WS_READ_LIMIT must be positive, got %d", c.ReadLimit)
+	check(c.MaxMessageSize > 0, "WS_MAX_MESSAGE_SIZE must be positive, got %d", c.MaxMessageSize)
+	check(c.MaxMessageSize >= c.ReadLimit,
+		"WS_MAX_MESSAGE_SIZE (%d) must not be smaller than WS_READ_LIMIT (%d)", c.MaxMessageSize, c.ReadLimit)
+	check(c.ReadTimeout > 0, "WS_READ_TIMEOUT must be positive, got %d", c.ReadTimeout)
+	check(c.WriteTimeout > 0, "WS_WRITE_TIMEOUT must be positive, got %d", c.WriteTimeout)
+	check(c.PingPeriod > 0, "WS_PING_PERIOD must be positive, got %d", c.PingPeriod)
+	check(c.PongWait > 0, "WS_PONG_WAIT must be positive, got %d", c.PongWait)
+	// A pong can only arrive after a ping, so pings must come before the
+	// read deadline runs out
+	check(c.PingPeriod < c.PongWait,
+		"WS_PING_PERIOD (%d) must be shorter than WS_PONG_WAIT (%d)", c.PingPeriod, c.PongWait)
+	check(c.PingPeriod < c.ReadTimeout,
+		"WS_PING_PERIOD (%d) must be shorter than WS_READ_TIMEOUT (%d)", c.PingPeriod, c.ReadTimeout)
+	check(c.WriteTimeout < c.PingPeriod,
+		"WS_WRITE_TIMEOUT (%d) must be shorter than WS_PING_PERIOD (%d)", c.WriteTimeout, c.PingPeriod)
+	check(c.ReadBufferSize >= 0, "WS_READ_BUFFER_SIZE must not be negative, got %d", c.ReadBufferSize)
+	check(c.WriteBufferSize >= 0, "WS_WRITE_BUFFER_SIZE must not be negative, got %d", c.WriteBufferSize)
+	check(c.SendBuffer > 0, "WS_SEND_BUFFER must be positive, got %d", c.SendBuffer)
+	check(c.MaxDropped >= 0, "WS_MAX_DROPPED must not be negative, got %d", c.MaxDropped)
+	check(c.SnapshotEvery > 0, "WS_SNAPSHOT_EVERY must be positive, got %d", c.SnapshotEvery)
+	for _, origin := range c.AllowedOrigins {
+		u, err := url.Parse(origin)
+		check(err == nil && u.Scheme != "" && u.Host != "" && (u.Path == "" || u.Path == "/"),
+			"WS_ALLOWED_ORIGINS entry %q is not an origin like https://example.com", origin)
+	}
+	return errors.Join(errs...)
 }
 
 // Helper functions for environment variable parsing
@@ -86,6 +295,18 @@ func getEnvAsInt64(key string, defaultValue int64) int64 {
 	return defaultValue
 }
 
+// getEnvAsList splits a comma-separated variable, dropping empty entries
+// and trailing slashes
+func getEnvAsList(key string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimRight(strings.TrimSpace(item), "/"); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
 func getEnvAsBool(key string, defaultValue bool) bool {
 	if value := os.Getenv(key); value != "" {
 		if boolValue, err := strconv.ParseBool(value); err == nil {
@@ -0,0 +1,104 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+// The defaults have to take a create_room or load_quiz carrying a whole quiz
+func TestDefaults(t *testing.T) {
+	for _, key := range []string{"WS_READ_LIMIT", "WS_MAX_MESSAGE_SIZE"} {
+		t.Setenv(key, "")
+	}
+	cfg := LoadConfig()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("defaults are invalid: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		got  int64
+	}{
+		{"WS_READ_LIMIT", cfg.WebSocket.ReadLimit},
+		{"WS_MAX_MESSAGE_SIZE", cfg.WebSocket.MaxMessageSize},
+	}
+	for _, tt := range tests {
+		if tt.got != 64*1024 {
+			t.Errorf("%s = %d, want %d", tt.name, tt.got, 64*1024)
+		}
+	}
+}
+
+// validConfig returns a config that passes Validate
+func validConfig(t *testing.T) *Config {
+	t.Helper()
+	cfg := LoadConfig()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("defaults are invalid: %v", err)
+	}
+	return cfg
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(c *Config)
+		wantErr string // Substring of the error
+	}{
+		{"zero read limit", func(c *Config) { c.WebSocket.ReadLimit = 0 }, "WS_READ_LIMIT must be positive"},
+		{"negative message size", func(c *Config) { c.WebSocket.MaxMessageSize = -1 }, "WS_MAX_MESSAGE_SIZE must be positive"},
+		{"frame limit above the message size", func(c *Config) {
+			c.WebSocket.ReadLimit = 128 * 1024
+			c.WebSocket.MaxMessageSize = 64 * 1024
+		}, "must not be smaller than WS_READ_LIMIT"},
+		{"negative read timeout", func(c *Config) { c.WebSocket.ReadTimeout = -1 }, "WS_READ_TIMEOUT must be positive"},
+		{"negative write timeout", func(c *Config) { c.WebSocket.WriteTimeout = -1 }, "WS_WRITE_TIMEOUT must be positive"},
+		{"negative ping period", func(c *Config) { c.WebSocket.PingPeriod = -1 }, "WS_PING_PERIOD must be positive"},
+		{"negative pong wait", func(c *Config) { c.WebSocket.PongWait = -1 }, "WS_PONG_WAIT must be positive"},
+		{"ping after the pong wait", func(c *Config) { c.WebSocket.PingPeriod = 60 }, "must be shorter than WS_PONG_WAIT"},
+		{"ping after the read timeout", func(c *Config) { c.WebSocket.ReadTimeout = 30 }, "must be shorter than WS_READ_TIMEOUT"},
+		{"write timeout after the ping", func(c *Config) { c.WebSocket.WriteTimeout = 54 }, "must be shorter than WS_PING_PERIOD"},
+		{"negative read buffer", func(c *Config) { c.WebSocket.ReadBufferSize = -1 }, "WS_READ_BUFFER_SIZE"},
+		{"negative write buffer", func(c *Config) { c.WebSocket.WriteBufferSize = -1 }, "WS_WRITE_BUFFER_SIZE"},
+		{"no send buffer", func(c *Config) { c.WebSocket.SendBuffer = 0 }, "WS_SEND_BUFFER"},
+		{"negative max dropped", func(c *Config) { c.WebSocket.MaxDropped = -1 }, "WS_MAX_DROPPED"},
+		{"no snapshots", func(c *Config) { c.WebSocket.SnapshotEvery = 0 }, "WS_SNAPSHOT_EVERY"},
+		{"origin with a path", func(c *Config) { c.WebSocket.AllowedOrigins = []string{"https://example.com/quiz"} }, "WS_ALLOWED_ORIGINS"},
+		{"origin without a scheme", func(c *Config) { c.WebSocket.AllowedOrigins = []string{"example.com"} }, "WS_ALLOWED_ORIGINS"},
+		{"zero admin token lifetime", func(c *Config) { c.Session.AdminTTLHours = 0 }, "ADMIN_TOKEN_TTL_HOURS"},
+		{"no failures allowed", func(c *Config) { c.Session.AuthMaxFailures = 0 }, "AUTH_MAX_FAILURES"},
+		{"negative lockout", func(c *Config) { c.Session.AuthLockoutMin = -5 }, "AUTH_LOCKOUT_MINUTES"},
+		{"rate limit without a burst", func(c *Config) { c.Limits.PerConnection = "click=10" }, "RATE_LIMITS: entry \"click=10\""},
+		{"negative rate", func(c *Config) { c.Limits.PerIP = "join=-1/5" }, "RATE_LIMITS_IP: entry \"join=-1/5\" needs a rate"},
+		{"zero burst", func(c *Config) { c.Limits.PerConnection = "click=0/0" }, "needs a burst of at least 1"},
+		{"burst below the rate", func(c *Config) { c.Limits.PerConnection = "click=10/5" }, "needs a burst of at least its rate"},
+		{"negative strikes", func(c *Config) { c.Limits.MaxStrikes = -1 }, "RATE_LIMIT_MAX_STRIKES"},
+		{"negative room cap", func(c *Config) { c.Limits.MaxRoomsPerIP = -1 }, "MAX_ROOMS_PER_IP"},
+		{"negative flush delay", func(c *Config) { c.Storage.FlushMs = -1 }, "STORE_FLUSH_MS"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig(t)
+			tt.change(cfg)
+			err := cfg.Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// Every broken setting is reported, not just the first
+func TestValidateReportsAll(t *testing.T) {
+	cfg := validConfig(t)
+	cfg.WebSocket.SendBuffer = 0
+	cfg.Session.AuthMaxFailures = 0
+	cfg.Storage.FlushMs = -1
+	err := cfg.Validate()
+	for _, name := range []string{"WS_SEND_BUFFER", "AUTH_MAX_FAILURES", "STORE_FLUSH_MS"} {
+		if err == nil || !strings.Contains(err.Error(), name) {
+			t.Errorf("error = %v, want it to name %s", err, name)
+		}
+	}
+}
@@ -1,12 +1,20 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
+	"powerpoint-quiz/internal/config"
 	"powerpoint-quiz/internal/models"
 	"powerpoint-quiz/internal/services"
 
@@ -14,9 +22,17 @@ import (
 	"github.com/gorilla/websocket"
 )
 
+// apiKeyRejections counts the question control requests refused, by reason;
+// served on /metrics. It is not published to expvar, whose handler would
+// also expose the command line and memory statistics.
+var apiKeyRejections = new(expvar.Map).Init()
+
+// roomKey is the request context key of the room an API key belongs to
+type roomKey struct{}
+
 // ActivateQuestionRequest represents a request to activate a question
 type ActivateQuestionRequest struct {
-	RoomCode string `json:"roomCode"`
+	RoomCode string `json:"roomCode"` // Optional, must be the API key's room
 	Duration int    `json:"duration"` // Duration in seconds, 0 means no timer
 }
 
@@ -27,17 +43,47 @@ type ActivateQuestionResponse struct {
 	RoomCode string `json:"roomCode,omitempty"`
 }
 
+// ScoreAdjustRequest changes the score of one player or team
+type ScoreAdjustRequest struct {
+	UserID    string `json:"userId,omitempty"`
+	TeamID    string `json:"teamId,omitempty"`
+	Op        string `json:"op"` // "add", "subtract" or "set"
+	Points    int    `json:"points"`
+	Reason    string `json:"reason"`
+	AdminName string `json:"adminName"` // Recorded in the audit trail, defaults to "api"
+}
+
+// ScoreUndoRequest undoes the last scoring actions of a room
+type ScoreUndoRequest struct {
+	Count     int    `json:"count"` // Defaults to 1
+	Reason    string `json:"reason"`
+	AdminName string `json:"adminName"` // Recorded in the audit trail, defaults to "api"
+}
+
 // WebSocketHandler handles WebSocket connections
 type WebSocketHandler struct {
-	wsService *services.WebSocketService
-	upgrader  websocket.Upgrader
+	wsService    *services.WebSocketService
+	upgrader     websocket.Upgrader
+	readLimit    int64
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	pingPeriod   time.Duration
+	pongWait     time.Duration
+	trustProxy   bool
 }
 
-// NewWebSocketHandler creates a new WebSocket handler
-func NewWebSocketHandler(wsService *services.WebSocketService) *WebSocketHandler {
+// NewWebSocketHandler creates a new WebSocket handler whose connections
+// follow cfg, which should have passed Validate
+func NewWebSocketHandler(wsService *services.WebSocketService, cfg config.WebSocketConfig) *WebSocketHandler {
 	return &WebSocketHandler{
-		wsService: wsService,
-		upgrader:  services.GetUpgrader(),
+		wsService:    wsService,
+		upgrader:     services.NewUpgrader(cfg),
+		readLimit:    cfg.ReadLimit,
+		readTimeout:  time.Duration(cfg.ReadTimeout) * time.Second,
+		writeTimeout: time.Duration(cfg.WriteTimeout) * time.Second,
+		pingPeriod:   time.Duration(cfg.PingPeriod) * time.Second,
+		pongWait:     time.Duration(cfg.PongWait) * time.Second,
+		trustProxy:   cfg.TrustProxy,
 	}
 }
 
@@ -45,6 +91,14 @@ func NewWebSocketHandler(wsService *services.WebSocketService) *WebSocketHandler
 func (h *WebSocketHandler) ServeWS(w http.ResponseWriter, r *http.Request) {
 	log.Printf("WebSocket connection attempt from %s", r.RemoteAddr)
 
+	// A client that asks for protocol versions must share one with us;
+	// one that asks for none speaks the legacy protocol
+	if requested := websocket.Subprotocols(r); len(requested) > 0 && !services.SupportsSubprotocol(requested) {
+		log.Printf("Unsupported protocol versions %v from %s", requested, r.RemoteAddr)
+		http.Error(w, "Unsupported protocol version", http.StatusBadRequest)
+		return
+	}
+
 	conn, err := h.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("WebSocket upgrade error: %v", err)
@@ -58,19 +112,20 @@ func (h *WebSocketHandler) ServeWS(w http.ResponseWriter, r *http.Request) {
 	if roomID == "" {
 		roomID = "default"
 	}
-	role := r.URL.Query().Get("role")
-	if role == "" {
-		role = "viewer"
+	// Roles come from authentication, never from the URL
+	if role := r.URL.Query().Get("role"); role != "" && role != models.RoleViewer {
+		log.Printf("Ignoring role %q requested by %s, connecting as viewer", role, r.RemoteAddr)
 	}
 
-	client := &models.Client{
-		Conn:   conn,
-		Send:   make(chan []byte, 256),
-		RoomID: roomID,
-		Role:   role,
-	}
+	client := h.wsService.NewClient(conn, roomID)
+	client.IP = h.clientIP(r)
+	// Clients that can apply JSON merge patches opt into state_patch events
+	client.Delta = r.URL.Query().Get("delta") == "1"
+	client.Protocol = services.ProtocolVersion(conn.Subprotocol())
+	client.Encoding = services.EncodingOf(conn.Subprotocol())
 
 	h.wsService.GetHub().Register <- client
+	h.wsService.ClientConnected(client)
 
 	go h.writePump(client)
 	go h.readPump(client)
@@ -79,19 +134,22 @@ func (h *WebSocketHandler) ServeWS(w http.ResponseWriter, r *http.Request) {
 // readPump handles reading messages from WebSocket connection
 func (h *WebSocketHandler) readPump(client *models.Client) {
 	defer func() {
+		// Leave the room first so nothing sends to the client once Run
+		// closes its channel
+		h.wsService.ClientDisconnected(client)
 		h.wsService.GetHub().Unregister <- client
 		client.Conn.Close()
 	}()
 
-	client.Conn.SetReadLimit(512)
-	client.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+	client.Conn.SetReadLimit(h.readLimit)
+	client.Conn.SetReadDeadline(time.Now().Add(h.readTimeout))
 	client.Conn.SetPongHandler(func(string) error {
-		client.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+		client.Conn.SetReadDeadline(time.Now().Add(h.pongWait))
 		return nil
 	})
 
 	for {
-		_, message, err := client.Conn.ReadMessage()
+		messageType, message, err := client.Conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("WebSocket error: %v", err)
@@ -99,54 +157,65 @@ func (h *WebSocketHandler) readPump(client *models.Client) {
 			break
 		}
 
-		log.Printf("Received message from %s: %s", client.Conn.RemoteAddr(), string(message))
-
-		var event models.Event
-		if err := json.Unmarshal(message, &event); err != nil {
-			log.Printf("Error unmarshaling event: %v", err)
-			continue
+		// Payloads may carry tokens, so only their size is logged
+		kind := "text"
+		if messageType == websocket.BinaryMessage {
+			kind = "binary"
 		}
-
-		log.Printf("Handling event: %+v", event)
-		h.wsService.HandleEvent(client, event)
+		log.Printf("Received %d byte %s message from %s", len(message), kind, client.Conn.RemoteAddr())
+		h.wsService.HandleMessage(client, message)
 	}
 }
 
 // writePump handles writing messages to WebSocket connection
 func (h *WebSocketHandler) writePump(client *models.Client) {
-	ticker := time.NewTicker(54 * time.Second)
+	ticker := time.NewTicker(h.pingPeriod)
 	defer func() {
 		ticker.Stop()
 		client.Conn.Close()
 	}()
 
+	// Messages arrive already in the client's encoding
+	messageType := services.FrameType(client.Encoding)
+	write := func(message []byte) bool {
+		client.Conn.SetWriteDeadline(time.Now().Add(h.writeTimeout))
+		// One event per frame so clients can parse and sequence each
+		return client.Conn.WriteMessage(messageType, message) == nil
+	}
+
 	for {
 		select {
 		case message, ok := <-client.Send:
-			client.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
 			if !ok {
+				client.Conn.SetWriteDeadline(time.Now().Add(h.writeTimeout))
 				client.Conn.WriteMessage(websocket.CloseMessage, []byte{})
 				return
 			}
-
-			w, err := client.Conn.NextWriter(websocket.TextMessage)
-			if err != nil {
+			if !write(message) {
 				return
 			}
-			w.Write(message)
-
-			n := len(client.Send)
-			for i := 0; i < n; i++ {
-				w.Write([]byte{'\n'})
-				w.Write(<-client.Send)
+			// A state snapshot parked while the queue was full goes out
+			// once the queue has drained
+			if state := services.PendingState(client); state != nil && !write(state) {
+				return
 			}
 
-			if err := w.Close(); err != nil {
+		case <-client.Out.Wake:
+			if state := services.PendingState(client); state != nil && !write(state) {
 				return
 			}
 
+		case <-client.Out.Kick:
+			code, reason := services.CloseCode(client), "too slow"
+			if code == services.CloseRateLimited {
+				reason = "rate limited"
+			}
+			client.Conn.SetWriteDeadline(time.Now().Add(h.writeTimeout))
+			client.Conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason))
+			return
+
 		case <-ticker.C:
-			client.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			client.Conn.SetWriteDeadline(time.Now().Add(h.writeTimeout))
 			if err := client.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
@@ -178,6 +247,12 @@ func (h *StaticHandler) ServeStatic(w http.ResponseWriter, r *http.Request) {
 	http.ServeFile(w, r, "web/"+path)
 }
 
+// Metrics serves the API key rejection counters as JSON
+func (h *WebSocketHandler) Metrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	fmt.Fprintf(w, "{\"api_key_rejections\": %s}\n", apiKeyRejections.String())
+}
+
 // SetupRoutes configures all HTTP routes
 func SetupRoutes(wsHandler *WebSocketHandler, staticHandler *StaticHandler) *mux.Router {
 	r := mux.NewRouter()
@@ -188,7 +263,7 @@ func SetupRoutes(wsHandler *WebSocketHandler, staticHandler *StaticHandler) *mux
 			// Set CORS headers
 			w.Header().Set("Access-Control-Allow-Origin", "*")
 			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key")
 
 			// Handle preflight requests
 			if req.Method == "OPTIONS" {
@@ -200,12 +275,34 @@ func SetupRoutes(wsHandler *WebSocketHandler, staticHandler *StaticHandler) *mux
 		})
 	})
 
+	// Every REST call counts against its address's rate limit
+	r.Use(wsHandler.limitREST)
+
 	// WebSocket endpoint
 	r.HandleFunc("/ws", wsHandler.ServeWS)
 
-	// PowerPoint integration endpoints
-	r.HandleFunc("/api/activate-question", wsHandler.ActivateQuestion).Methods("POST")
-	r.HandleFunc("/api/deactivate-question", wsHandler.DeactivateQuestion).Methods("POST")
+	// PowerPoint integration endpoints, authorized by the room's API key
+	r.Handle("/api/activate-question", wsHandler.requireAPIKey(http.HandlerFunc(wsHandler.ActivateQuestion))).Methods("POST")
+	r.Handle("/api/deactivate-question", wsHandler.requireAPIKey(http.HandlerFunc(wsHandler.DeactivateQuestion))).Methods("POST")
+
+	// Quiz definition upload (JSON, YAML or CSV)
+	r.HandleFunc("/api/rooms/{code}/quiz", wsHandler.UploadQuiz).Methods("POST")
+
+	// Room history endpoints
+	r.HandleFunc("/api/rooms/{code}/history", wsHandler.RoomHistory).Methods("GET")
+	r.HandleFunc("/api/rooms/{code}/replay", wsHandler.ReplayRoom).Methods("GET")
+
+	// JSON Schema of the WebSocket protocol
+	r.HandleFunc("/api/protocol/schema", wsHandler.ProtocolSchema).Methods("GET")
+
+	// Scores
+	r.HandleFunc("/api/rooms/{code}/leaderboard", wsHandler.RoomLeaderboard).Methods("GET")
+	r.HandleFunc("/api/rooms/{code}/scores", wsHandler.AdjustScore).Methods("POST")
+	r.HandleFunc("/api/rooms/{code}/scores/undo", wsHandler.UndoScores).Methods("POST")
+	r.HandleFunc("/api/rooms/{code}/scores/audit", wsHandler.ScoreAudit).Methods("GET")
+
+	// The service's own counters
+	r.HandleFunc("/metrics", wsHandler.Metrics).Methods("GET")
 
 	// Health check endpoint
 	r.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
@@ -227,46 +324,21 @@ func (h *WebSocketHandler) ActivateQuestion(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	if req.RoomCode == "" {
-		http.Error(w, "Room code is required", http.StatusBadRequest)
-		return
-	}
-
-	// Find the room
-	room := h.wsService.GetRoom(req.RoomCode)
-	if room == nil {
-		http.Error(w, "Room not found", http.StatusNotFound)
+	room, ok := keyRoom(w, r, req.RoomCode)
+	if !ok {
 		return
 	}
 
-	// Activate the question
-	room.Mu.Lock()
-	room.QuestionActive = true
-	room.FirstAnswerer = ""
-	room.QuestionStartTime = time.Now()
-	room.Mu.Unlock()
-
-	log.Printf("Question activated for room %s via PowerPoint API", req.RoomCode)
+	// Activate the question; a duration sets up auto-deactivation
+	h.wsService.ActivateQuestion(room, time.Duration(req.Duration)*time.Second)
 
-	// Broadcast to all clients in the room
-	questionStartEvent := models.Event{
-		Type: models.EventStartQuestion,
-	}
-	h.wsService.BroadcastToRoom(room, questionStartEvent)
-
-	// If duration is specified, set up auto-deactivation
-	if req.Duration > 0 {
-		go func() {
-			time.Sleep(time.Duration(req.Duration) * time.Second)
-			h.DeactivateQuestionInternal(req.RoomCode)
-		}()
-	}
+	log.Printf("Question activated for room %s via PowerPoint API", room.Code)
 
 	// Send response
 	response := ActivateQuestionResponse{
 		Success:  true,
 		Message:  "Question activated successfully",
-		RoomCode: req.RoomCode,
+		RoomCode: room.Code,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -281,22 +353,17 @@ func (h *WebSocketHandler) DeactivateQuestion(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	if req.RoomCode == "" {
-		http.Error(w, "Room code is required", http.StatusBadRequest)
-		return
-	}
-
-	success := h.DeactivateQuestionInternal(req.RoomCode)
-	if !success {
-		http.Error(w, "Room not found", http.StatusNotFound)
+	room, ok := keyRoom(w, r, req.RoomCode)
+	if !ok {
 		return
 	}
+	h.wsService.DeactivateQuestion(room)
 
 	// Send response
 	response := ActivateQuestionResponse{
 		Success:  true,
 		Message:  "Question deactivated successfully",
-		RoomCode: req.RoomCode,
+		RoomCode: room.Code,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -310,17 +377,324 @@ func (h *WebSocketHandler) DeactivateQuestionInternal(roomCode string) bool {
 		return false
 	}
 
-	room.Mu.Lock()
-	room.QuestionActive = false
-	room.Mu.Unlock()
+	h.wsService.DeactivateQuestion(room)
+	return true
+}
+
+// limitREST refuses REST API calls from an address that exceeds its rate
+// limit
+func (h *WebSocketHandler) limitREST(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/") && !h.wsService.AllowREST(h.clientIP(r)) {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireAPIKey lets a request through only with a room's API key in the
+// X-API-Key header or as "Authorization: Bearer <key>", and hands the room
+// to next in the request context. Refusals are counted in
+// api_key_rejections.
+func (h *WebSocketHandler) requireAPIKey(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("X-API-Key")
+		if key == "" {
+			key = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		}
+
+		room, err := h.wsService.AuthorizeAPIKey(key, h.clientIP(r))
+		if err == nil {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), roomKey{}, room)))
+			return
+		}
+
+		var refusal *services.CommandError
+		switch {
+		case errors.Is(err, services.ErrAPIKeyMissing):
+			apiKeyRejections.Add("missing", 1)
+			http.Error(w, "API key required", http.StatusUnauthorized)
+		case errors.Is(err, services.ErrAPIKeyMalformed):
+			apiKeyRejections.Add("malformed", 1)
+			http.Error(w, "Invalid API key", http.StatusUnauthorized)
+		case errors.As(err, &refusal) && refusal.Code == models.ErrCodeRateLimited:
+			apiKeyRejections.Add("locked_out", 1)
+			http.Error(w, refusal.Message, http.StatusTooManyRequests)
+		default:
+			apiKeyRejections.Add("invalid", 1)
+			http.Error(w, "Invalid API key", http.StatusUnauthorized)
+		}
+		log.Printf("Rejected %s %s from %s: %v", r.Method, r.URL.Path, h.clientIP(r), err)
+	})
+}
+
+// keyRoom returns the room of the request's API key and writes an error
+// response if the request names another room
+func keyRoom(w http.ResponseWriter, r *http.Request, roomCode string) (*models.Room, bool) {
+	room := r.Context().Value(roomKey{}).(*models.Room)
+	if roomCode != "" && roomCode != room.Code {
+		apiKeyRejections.Add("wrong_room", 1)
+		http.Error(w, "API key is not valid for this room", http.StatusForbidden)
+		return nil, false
+	}
+	return room, true
+}
+
+// maxQuizSize limits uploaded quiz definitions
+const maxQuizSize = 1 << 20
 
-	log.Printf("Question deactivated for room %s", roomCode)
+// authorizeRoomAdmin checks the room's admin token passed as
+// "Authorization: Bearer <token>" and writes an error response if it fails
+func (h *WebSocketHandler) authorizeRoomAdmin(w http.ResponseWriter, r *http.Request, room *models.Room) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	err := h.wsService.AuthorizeAdmin(room, token, h.clientIP(r))
+	if err == nil {
+		return true
+	}
+	var refusal *services.CommandError
+	if errors.As(err, &refusal) && refusal.Code == models.ErrCodeRateLimited {
+		http.Error(w, refusal.Message, http.StatusTooManyRequests)
+	} else {
+		http.Error(w, "Invalid admin token", http.StatusUnauthorized)
+	}
+	return false
+}
 
-	// Broadcast to all clients in the room
-	nextQuestionEvent := models.Event{
-		Type: models.EventNextQuestion,
+// clientIP returns the address a request came from, as reported by the
+// reverse proxy if it is trusted
+func (h *WebSocketHandler) clientIP(r *http.Request) string {
+	if h.trustProxy {
+		if ip := r.Header.Get("X-Real-IP"); ip != "" {
+			return ip
+		}
 	}
-	h.wsService.BroadcastToRoom(room, nextQuestionEvent)
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
 
-	return true
+// UploadQuiz attaches a quiz definition to a room. The format is taken from
+// ?format=json|yaml|csv or else from the Content-Type header.
+func (h *WebSocketHandler) UploadQuiz(w http.ResponseWriter, r *http.Request) {
+	roomCode := mux.Vars(r)["code"]
+	room := h.wsService.GetRoom(roomCode)
+	if room == nil {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+	if !h.authorizeRoomAdmin(w, r, room) {
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxQuizSize+1))
+	if err != nil {
+		http.Error(w, "Failed to read quiz", http.StatusBadRequest)
+		return
+	}
+	if len(data) > maxQuizSize {
+		http.Error(w, "Quiz is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = services.QuizFormatFromContentType(r.Header.Get("Content-Type"))
+	}
+	quiz, err := services.ParseQuiz(data, format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.wsService.LoadQuiz(room, quiz)
+
+	response := ActivateQuestionResponse{
+		Success:  true,
+		Message:  fmt.Sprintf("Quiz loaded with %d questions", len(quiz.Questions)),
+		RoomCode: roomCode,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// RoomHistory returns the recorded event log of a room
+func (h *WebSocketHandler) RoomHistory(w http.ResponseWriter, r *http.Request) {
+	roomCode := mux.Vars(r)["code"]
+	if !h.authorizeHistory(w, r, roomCode) {
+		return
+	}
+	entries := h.wsService.History(roomCode)
+	if len(entries) == 0 {
+		http.Error(w, "Room history not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// ReplayRoom rebuilds a room from its event log, optionally stopping after
+// the entry with sequence number ?upTo=N
+func (h *WebSocketHandler) ReplayRoom(w http.ResponseWriter, r *http.Request) {
+	roomCode := mux.Vars(r)["code"]
+	if !h.authorizeHistory(w, r, roomCode) {
+		return
+	}
+	entries := h.wsService.History(roomCode)
+	if len(entries) == 0 {
+		http.Error(w, "Room history not found", http.StatusNotFound)
+		return
+	}
+
+	if upTo := r.URL.Query().Get("upTo"); upTo != "" {
+		seq, err := strconv.ParseInt(upTo, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid upTo", http.StatusBadRequest)
+			return
+		}
+		for i, entry := range entries {
+			if entry.Seq > seq {
+				entries = entries[:i]
+				break
+			}
+		}
+	}
+
+	room, err := services.ReplayRoom(entries)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(room)
+}
+
+// RoomLeaderboard returns the ranked players and teams of a room. Player
+// user IDs are included only for a caller with the room's admin token.
+func (h *WebSocketHandler) RoomLeaderboard(w http.ResponseWriter, r *http.Request) {
+	room := h.wsService.GetRoom(mux.Vars(r)["code"])
+	if room == nil {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+
+	var board interface{}
+	if r.Header.Get("Authorization") == "" {
+		board = h.wsService.PublicLeaderboard(room)
+	} else if h.authorizeRoomAdmin(w, r, room) {
+		board = h.wsService.Leaderboard(room)
+	} else {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(board)
+}
+
+// ProtocolSchema serves the JSON Schema of the WebSocket protocol
+func (h *WebSocketHandler) ProtocolSchema(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/schema+json")
+	json.NewEncoder(w).Encode(services.ProtocolSchema())
+}
+
+// AdjustScore adds, subtracts or sets the score of a player or team
+func (h *WebSocketHandler) AdjustScore(w http.ResponseWriter, r *http.Request) {
+	room := h.wsService.GetRoom(mux.Vars(r)["code"])
+	if room == nil {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+	if !h.authorizeRoomAdmin(w, r, room) {
+		return
+	}
+
+	var req ScoreAdjustRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	event := models.Event{
+		UserID:  req.UserID,
+		TeamID:  req.TeamID,
+		ScoreOp: req.Op,
+		Points:  req.Points,
+		Reason:  req.Reason,
+	}
+	if err := h.wsService.AdjustScore(room, apiAdminName(req.AdminName), event); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.wsService.Leaderboard(room))
+}
+
+// UndoScores reverts the last scoring actions of a room
+func (h *WebSocketHandler) UndoScores(w http.ResponseWriter, r *http.Request) {
+	room := h.wsService.GetRoom(mux.Vars(r)["code"])
+	if room == nil {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+	if !h.authorizeRoomAdmin(w, r, room) {
+		return
+	}
+
+	var req ScoreUndoRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.wsService.UndoScores(room, apiAdminName(req.AdminName), req.Count, req.Reason); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, services.ErrNothingUndo) {
+			status = http.StatusConflict
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.wsService.Leaderboard(room))
+}
+
+// apiAdminName is the audit identity of a REST caller
+func apiAdminName(name string) string {
+	if name == "" {
+		return "api"
+	}
+	return name
+}
+
+// ScoreAudit returns every score change of a room with who made it and why
+func (h *WebSocketHandler) ScoreAudit(w http.ResponseWriter, r *http.Request) {
+	room := h.wsService.GetRoom(mux.Vars(r)["code"])
+	if room == nil {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+	if !h.authorizeRoomAdmin(w, r, room) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.wsService.ScoreAudit(room))
+}
+
+// authorizeHistory requires admin access to a room's history since it
+// contains the quiz answers
+func (h *WebSocketHandler) authorizeHistory(w http.ResponseWriter, r *http.Request, roomCode string) bool {
+	room := h.wsService.GetRoom(roomCode)
+	if room == nil {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return false
+	}
+	return h.authorizeRoomAdmin(w, r, room)
 }
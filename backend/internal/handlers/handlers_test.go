@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"powerpoint-quiz/internal/config"
+	"powerpoint-quiz/internal/models"
+	"powerpoint-quiz/internal/services"
+)
+
+func TestMetricsServesOnlyOwnCounters(t *testing.T) {
+	apiKeyRejections.Add("invalid", 1)
+
+	rec := httptest.NewRecorder()
+	(&WebSocketHandler{}).Metrics(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	var body map[string]map[string]int
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("undecodable metrics %q: %v", rec.Body.String(), err)
+	}
+	if len(body) != 1 || body["api_key_rejections"]["invalid"] < 1 {
+		t.Errorf("metrics = %v, want only api_key_rejections", body)
+	}
+}
+
+// newTestRoom creates a room with one joined player and returns the handler,
+// the room code and its admin token
+func newTestRoom(t *testing.T) (*WebSocketHandler, string, string) {
+	t.Helper()
+	opts := services.DefaultOptions()
+	opts.SessionSecret = []byte("test secret")
+	opts.ConnRateLimits = nil
+	opts.IPRateLimits = nil
+	ws := services.NewWebSocketService(services.NewMemoryRoomStore(), services.NewMemoryHistoryStore(), opts)
+	h := NewWebSocketHandler(ws, config.LoadConfig().WebSocket)
+
+	admin := ws.NewClient(nil, "")
+	ws.HandleEvent(admin, models.Event{Type: models.EventCreateRoom})
+	var created models.Event
+	for created.Type != models.EventRoomCreated {
+		if err := json.Unmarshal(<-admin.Send, &created); err != nil {
+			t.Fatal(err)
+		}
+	}
+	code := admin.RoomID
+
+	player := ws.NewClient(nil, "")
+	ws.HandleEvent(player, models.Event{Type: models.EventJoin, QuizID: code, UserID: "secret-u1", Nickname: "Ann"})
+	return h, code, created.AdminToken
+}
+
+func TestRoomLeaderboardHidesUserIDs(t *testing.T) {
+	h, code, adminToken := newTestRoom(t)
+	router := SetupRoutes(h, NewStaticHandler())
+
+	tests := []struct {
+		name          string
+		authorization string
+		status        int
+		userIDs       bool
+	}{
+		{"anonymous", "", http.StatusOK, false},
+		{"admin", "Bearer " + adminToken, http.StatusOK, true},
+		{"bad token", "Bearer nope", http.StatusUnauthorized, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/rooms/"+code+"/leaderboard", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body.String())
+			}
+			body := rec.Body.String()
+			if got := strings.Contains(body, "secret-u1"); got != tt.userIDs {
+				t.Errorf("user IDs in the leaderboard = %v, want %v: %s", got, tt.userIDs, body)
+			}
+			if tt.status == http.StatusOK && !strings.Contains(body, "Ann") {
+				t.Errorf("leaderboard lacks the player: %s", body)
+			}
+		})
+	}
+}
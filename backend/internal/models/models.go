@@ -31,6 +31,16 @@ const (
 	EventJoinTeam     EventType = "join_team"
 	EventCreateTeam   EventType = "create_team"
 	EventAdminAuth    EventType = "admin_auth"
+	EventHostAuth     EventType = "host_auth"      // Authenticates with a host token
+	EventPairDisplay  EventType = "pair_display"   // Authenticates a projector with the pairing code
+	EventAuthSuccess  EventType = "auth_success"   // Tells a connection its new role
+	EventRevokeTokens EventType = "revoke_tokens"  // Invalidates the room's admin and host tokens
+	EventCreateInvite EventType = "create_invite"  // Issues the invitation code of a role
+	EventInviteCode   EventType = "invite_code"    // The new invitation code, sent to the admin only
+	EventRedeemInvite EventType = "redeem_invite"  // Joins the room's staff with an invitation code
+	EventRevokeMember EventType = "revoke_member"  // Takes an invited member's role away
+	EventRotateAPIKey EventType = "rotate_api_key" // Replaces the room's REST API key
+	EventAPIKey       EventType = "api_key"        // The new API key, sent to the admin only
 	// Additional events for better frontend handling
 	EventRoomCreated           EventType = "room_created"
 	EventJoinSuccess           EventType = "join_success"
@@ -42,14 +52,188 @@ const (
 	EventPlayerLeft            EventType = "player_left"
 	EventTeamJoined            EventType = "team_joined"
 	EventPhaseChanged          EventType = "phase_changed"
+	// Player session events
+	EventResume             EventType = "resume"
+	EventResumeSuccess      EventType = "resume_success"
+	EventPlayerConnected    EventType = "player_connected"
+	EventPlayerDisconnected EventType = "player_disconnected"
 	// Quiz management events
 	EventStartQuestion      EventType = "start_question"
 	EventAnswerReceived     EventType = "answer_received"
 	EventAnswerConfirmation EventType = "answer_confirmation"
 	EventShowAnswer         EventType = "show_answer"
 	EventNextQuestion       EventType = "next_question"
+	// Recorded when the PowerPoint API deactivates a question
+	EventDeactivateQuestion EventType = "deactivate_question"
+	// Question bank events
+	EventLoadQuiz     EventType = "load_quiz"
+	EventQuizLoaded   EventType = "quiz_loaded"
+	EventAnswerGraded EventType = "answer_graded" // Sent to hosts only
+	// Multiple-choice events
+	EventSubmitAnswer   EventType = "submit_answer"
+	EventAnswerAccepted EventType = "answer_accepted"
+	EventLockAnswers    EventType = "lock_answers"
+	EventAnswerResults  EventType = "answer_results"
+	// Timer events
+	EventTimerStart  EventType = "timer_start"
+	EventTimerPause  EventType = "timer_pause"
+	EventTimerResume EventType = "timer_resume"
+	EventTimerExtend EventType = "timer_extend"
+	EventTimerCancel EventType = "timer_cancel"
+	EventTimerTick   EventType = "timer_tick"
+	EventTimeUp      EventType = "time_up"
+	// Clock sync and buzzer adjudication events
+	EventClockSync    EventType = "clock_sync"
+	EventClockPing    EventType = "clock_ping"
+	EventClockPong    EventType = "clock_pong"
+	EventBuzzDecision EventType = "buzz_decision"
+	EventBuzzQueued   EventType = "buzz_queued"
+	EventBuzzTurn     EventType = "buzz_turn"
+	// Leaderboard events
+	EventLeaderboard EventType = "leaderboard"
+	// Scoring events
+	EventSetScoring        EventType = "set_scoring"
+	EventFalseStartPenalty EventType = "false_start_penalty"
+	EventScoreAdjust       EventType = "score_adjust"
+	EventScoreUndo         EventType = "score_undo"
+	EventScoreChanged      EventType = "score_changed"
+	// State sync events
+	EventStatePatch EventType = "state_patch" // JSON merge patch of the last state
+	// Replies to commands that carry a request id
+	EventAck  EventType = "ack"
+	EventNack EventType = "nack"
 )
 
+// ScoringPolicyName selects how a correct answer's base points are computed
+type ScoringPolicyName string
+
+const (
+	ScoringFixed ScoringPolicyName = "fixed" // Always the full points
+	ScoringSpeed ScoringPolicyName = "speed" // Points decay with reaction time
+)
+
+// ScoringRules configures scoring for a room, a quiz or a single question
+type ScoringRules struct {
+	Policy            ScoringPolicyName `json:"policy,omitempty" yaml:"policy,omitempty"`                       // Defaults to fixed
+	MinPoints         int               `json:"minPoints,omitempty" yaml:"minPoints,omitempty"`                 // Speed: floor once the decay is over
+	DecayMs           int               `json:"decayMs,omitempty" yaml:"decayMs,omitempty"`                     // Speed: decay duration, defaults to the time limit
+	WrongPenalty      int               `json:"wrongPenalty,omitempty" yaml:"wrongPenalty,omitempty"`           // Points taken for a wrong answer
+	FalseStartPenalty int               `json:"falseStartPenalty,omitempty" yaml:"falseStartPenalty,omitempty"` // Points taken for each false start
+	StreakBonus       int               `json:"streakBonus,omitempty" yaml:"streakBonus,omitempty"`             // Extra points per previous correct answer in a row
+	MaxStreakBonus    int               `json:"maxStreakBonus,omitempty" yaml:"maxStreakBonus,omitempty"`       // Cap on the streak bonus, 0 means no cap
+}
+
+// AnswerMode represents who submits multiple-choice answers
+type AnswerMode string
+
+const (
+	AnswerModePlayer AnswerMode = "player" // Every player answers for themselves
+	AnswerModeTeam   AnswerMode = "team"   // One vote per team, the latest submission counts
+)
+
+// QuestionType represents how a question is answered
+type QuestionType string
+
+const (
+	QuestionBuzzer         QuestionType = "buzzer"          // First to buzz answers, host confirms
+	QuestionMultipleChoice QuestionType = "multiple_choice" // Players pick one of Options
+	QuestionText           QuestionType = "text"            // Free text graded against CorrectAnswer
+)
+
+// QuestionOption is one choice of a multiple-choice question
+type QuestionOption struct {
+	ID   string `json:"id" yaml:"id"`
+	Text string `json:"text" yaml:"text"`
+}
+
+// Question is a single prepared quiz question
+type Question struct {
+	ID            string           `json:"id" yaml:"id"`
+	Text          string           `json:"text" yaml:"text"`
+	Type          QuestionType     `json:"type" yaml:"type"`
+	Options       []QuestionOption `json:"options,omitempty" yaml:"options,omitempty"`
+	CorrectAnswer string           `json:"correctAnswer" yaml:"correctAnswer"` // Option ID for multiple choice
+	Points        int              `json:"points" yaml:"points"`
+	TimeLimit     int              `json:"timeLimit" yaml:"timeLimit"` // Seconds, 0 means no limit
+	Media         string           `json:"media,omitempty" yaml:"media,omitempty"`
+	Scoring       *ScoringRules    `json:"scoring,omitempty" yaml:"scoring,omitempty"` // Overrides the room's rules
+}
+
+// Quiz is a prepared list of questions attached to a room
+type Quiz struct {
+	Title      string     `json:"title" yaml:"title"`
+	AnswerMode AnswerMode `json:"answerMode,omitempty" yaml:"answerMode,omitempty"`
+	// ExcludeTeamOnWrong locks the whole team out of a buzzer question after
+	// one of its players answers wrong
+	ExcludeTeamOnWrong bool          `json:"excludeTeamOnWrong,omitempty" yaml:"excludeTeamOnWrong,omitempty"`
+	Scoring            *ScoringRules `json:"scoring,omitempty" yaml:"scoring,omitempty"` // Default rules for the quiz
+	Questions          []Question    `json:"questions" yaml:"questions"`
+}
+
+// OptionAnswer is a submitted multiple-choice answer
+type OptionAnswer struct {
+	UserID   string    `json:"userId"`
+	TeamID   string    `json:"teamId,omitempty"`
+	OptionID string    `json:"optionId"`
+	At       time.Time `json:"at"`
+}
+
+// AnswerResults summarises a locked multiple-choice question
+type AnswerResults struct {
+	QuestionID    string         `json:"questionId"`
+	CorrectAnswer string         `json:"correctAnswer"`
+	Distribution  map[string]int `json:"distribution"` // Option ID -> votes
+	Total         int            `json:"total"`
+	Correct       []string       `json:"correct"` // UserIDs, or TeamIDs in team mode
+	Points        int            `json:"points"`
+}
+
+// TimerState describes a running or paused room timer
+type TimerState struct {
+	Kind        string `json:"kind"`        // "question" or "start_delay"
+	QuestionSeq int    `json:"questionSeq"` // Question the timer belongs to
+	DurationMs  int64  `json:"durationMs"`
+	RemainingMs int64  `json:"remainingMs"`
+	Running     bool   `json:"running"`
+}
+
+// ClockSample is one ping/pong measurement of a client's clock
+type ClockSample struct {
+	OffsetMs int64 `json:"offsetMs"` // Client clock minus server clock
+	RTTMs    int64 `json:"rttMs"`
+	At       int64 `json:"at"` // Server time of the measurement, Unix ms
+}
+
+// ClockSync is the clock estimate of a connection
+type ClockSync struct {
+	Samples  []ClockSample `json:"samples"`
+	OffsetMs int64         `json:"offsetMs"` // Offset of the lowest-RTT sample
+	RTTMs    int64         `json:"rttMs"`
+	Synced   bool          `json:"synced"`
+	Pending  int           `json:"-"` // Pings left in the current round
+}
+
+// BuzzCandidate is a buzz considered during adjudication
+type BuzzCandidate struct {
+	UserID      string `json:"userId"`
+	ArrivalMs   int64  `json:"arrivalMs"`   // Server receive time, Unix ms
+	TsClient    int64  `json:"tsClient"`    // Client press time as sent
+	OffsetMs    int64  `json:"offsetMs"`    // Estimated client clock offset
+	RTTMs       int64  `json:"rttMs"`       // Round trip of the offset sample
+	Synced      bool   `json:"synced"`      // Whether the offset is known
+	CorrectedMs int64  `json:"correctedMs"` // Press time on the server clock used for ranking
+	Note        string `json:"note"`
+}
+
+// BuzzDecision explains who won a buzz and why
+type BuzzDecision struct {
+	QuestionSeq int              `json:"questionSeq"`
+	Winner      string           `json:"winner"`
+	WindowMs    int64            `json:"windowMs"`
+	Reason      string           `json:"reason"`
+	Candidates  []*BuzzCandidate `json:"candidates"` // Ranked, winner first
+}
+
 // Player represents a quiz participant
 type Player struct {
 	ID          string    `json:"id"`
@@ -60,6 +244,61 @@ type Player struct {
 	FalseStarts int       `json:"falseStarts"`
 	LastClick   time.Time `json:"lastClick"`
 	Connected   bool      `json:"connected"`
+	// Presence fields
+	DisconnectedAt time.Time `json:"disconnectedAt"` // Zero while connected
+	Left           bool      `json:"left"`           // Gone for longer than the reconnect grace period
+	// Scoring fields
+	Score            int   `json:"score"`
+	CorrectAnswers   int   `json:"correctAnswers"`
+	IncorrectAnswers int   `json:"incorrectAnswers"`
+	Reactions        int   `json:"reactions"`       // Number of timed buzzes and answers
+	ReactionTotalMs  int64 `json:"reactionTotalMs"` // Sum of their reaction times
+	AvgReactionMs    int64 `json:"avgReactionMs"`   // 0 until the first reaction
+	Streak           int   `json:"streak"`          // Correct answers in a row
+}
+
+// LeaderboardEntry is a ranked player or team
+type LeaderboardEntry struct {
+	Rank             int    `json:"rank"`         // Entries tied on every criterion share a rank
+	ID               string `json:"id,omitempty"` // Player IDs are sent to the staff only
+	Name             string `json:"name"`
+	Score            int    `json:"score"`
+	CorrectAnswers   int    `json:"correctAnswers"`
+	IncorrectAnswers int    `json:"incorrectAnswers"`
+	AvgReactionMs    int64  `json:"avgReactionMs"`
+}
+
+// Score adjustment operations
+const (
+	ScoreOpAdd      = "add"
+	ScoreOpSubtract = "subtract"
+	ScoreOpSet      = "set"
+)
+
+// ScoreDelta is a change to one player's and/or one team's score
+type ScoreDelta struct {
+	UserID    string `json:"userId,omitempty"`
+	TeamID    string `json:"teamId,omitempty"`
+	Points    int    `json:"points"`
+	Correct   int    `json:"correct,omitempty"`   // Change to the player's correct answers
+	Incorrect int    `json:"incorrect,omitempty"` // Change to the player's incorrect answers
+}
+
+// ScoreAction is an audited scoring change made by one history entry
+type ScoreAction struct {
+	Seq      int64        `json:"seq"` // History entry that made the change
+	Type     EventType    `json:"type"`
+	Admin    string       `json:"admin,omitempty"`
+	Reason   string       `json:"reason,omitempty"`
+	At       time.Time    `json:"at"`
+	Deltas   []ScoreDelta `json:"deltas"`
+	UndoneBy int64        `json:"undoneBy,omitempty"` // Seq of the undo that reverted it
+}
+
+// Leaderboard ranks the players and teams of a room
+type Leaderboard struct {
+	Players []LeaderboardEntry `json:"players"`
+	Teams   []LeaderboardEntry `json:"teams"`
 }
 
 // Team represents a team in a quiz
@@ -74,35 +313,142 @@ type Team struct {
 
 // Room represents a quiz session
 type Room struct {
-	ID            string             `json:"id"`
-	Code          string             `json:"code"` // 4-character room code
-	Phase         Phase              `json:"phase"`
-	Players       map[string]*Player `json:"players"`
-	Teams         map[string]*Team   `json:"teams"`
-	EnableAt      time.Time          `json:"enableAt"`
-	CreatedAt     time.Time          `json:"createdAt"`
-	LastActivity  time.Time          `json:"lastActivity"` // Last activity timestamp
-	AdminPassword string             `json:"-"`            // Not sent to clients
+	ID           string             `json:"id"`
+	Code         string             `json:"code"` // 4-character room code
+	Phase        Phase              `json:"phase"`
+	Players      map[string]*Player `json:"players"`
+	Teams        map[string]*Team   `json:"teams"`
+	EnableAt     time.Time          `json:"enableAt"`
+	CreatedAt    time.Time          `json:"createdAt"`
+	LastActivity time.Time          `json:"lastActivity"` // Last activity timestamp
+	TokenEpoch   int                `json:"-"`            // Admin and host tokens of older epochs are revoked
+	DisplayCode  string             `json:"-"`            // Pairs displays, shown to hosts only
+	Invites      map[string]string  `json:"-"`            // Invitation code of each role
+	Members      map[string]*Member `json:"-"`            // Invited staff, keyed by member ID
+	APIKeyHash   string             `json:"-"`            // SHA-256 of the question control API key
+	CreatorIP    string             `json:"-"`            // Address the room was created from, set once
 	// Quiz management fields
 	QuestionActive    bool      `json:"questionActive"`    // Is question currently active
 	FirstAnswerer     string    `json:"firstAnswerer"`     // UserID of first person to answer
 	CorrectAnswer     string    `json:"correctAnswer"`     // The correct answer for current question
 	QuestionStartTime time.Time `json:"questionStartTime"` // When question was started
-	Mu                sync.RWMutex
+	QuestionSeq       int       `json:"questionSeq"`       // Incremented on every question start
+	// Question bank fields
+	Quiz            *Quiz     `json:"-"`                         // Not sent to clients, holds answers
+	QuestionIndex   int       `json:"questionIndex"`             // Index into Quiz.Questions
+	CurrentQuestion *Question `json:"currentQuestion,omitempty"` // Public copy without the answer
+	// Multiple-choice fields
+	Answers       map[string]*OptionAnswer `json:"-"`             // Keyed by UserID, or TeamID in team mode
+	AnswerCount   int                      `json:"answerCount"`   // Number of answers submitted so far
+	AnswersLocked bool                     `json:"answersLocked"` // No more answers accepted
+	PendingBuzzes []*BuzzCandidate         `json:"-"`             // Buzzes inside the adjudication window
+	// Buzzer queue fields
+	BuzzQueue []string         `json:"buzzQueue"`           // UserIDs waiting for a turn, in buzz order
+	LockedOut []string         `json:"lockedOut,omitempty"` // UserIDs that may not buzz again this question
+	BuzzTimes map[string]int64 `json:"buzzTimes,omitempty"` // Reaction time in ms of each buzz this question
+	// Scoring fields
+	Scoring  *ScoringRules  `json:"scoring,omitempty"` // Set by the host, overrides the quiz rules
+	ScoreLog []*ScoreAction `json:"-"`                 // Audit trail of score changes, oldest first
+}
+
+// Roles of a connection. Every connection starts as a viewer; the server
+// grants the others on authentication.
+const (
+	RoleAdmin       = "admin"        // The room's owner: created it or has its admin token
+	RoleHost        = "host"         // Co-host: has a host token or a co-host invitation
+	RoleScorer      = "scorer"       // Judges answers and keeps the score
+	RoleTeamManager = "team_manager" // Creates teams
+	RoleDisplay     = "display"      // A projector paired with the display code
+	RolePlayer      = "player"       // Joined or resumed as a player
+	RoleViewer      = "viewer"       // Anyone else
+)
+
+// Member is someone the admin invited to help run the room
+type Member struct {
+	ID        string    `json:"id"`
+	Role      string    `json:"role"`
+	Name      string    `json:"name,omitempty"`
+	Connected bool      `json:"connected"`
+	JoinedAt  time.Time `json:"joinedAt"`
+}
+
+// Views of the room state; every connection gets the one its role allows
+const (
+	ViewHost    = "host"    // The whole room plus the timers
+	ViewPlayer  = "player"  // The player's own status, their team and the scores
+	ViewDisplay = "display" // Scoreboard and question for a projector
+)
+
+// HostView is the room state sent to hosts
+type HostView struct {
+	*Room
+	Timers      []*TimerState `json:"timers"`
+	DisplayCode string        `json:"displayCode,omitempty"` // For pair_display
+	Members     []*Member     `json:"members"`               // Invited staff, oldest first
+}
+
+// ScoreboardEntry is a ranked player or team as shown to players and the
+// audience, without IDs
+type ScoreboardEntry struct {
+	Rank  int    `json:"rank"`
+	Name  string `json:"name"`
+	Score int    `json:"score"`
+	Color string `json:"color,omitempty"` // Team color
+}
+
+// PlayerView is the room state sent to a player. It holds nothing about
+// other players beyond their teams' scores.
+type PlayerView struct {
+	Code            string            `json:"code"`
+	Phase           Phase             `json:"phase"`
+	EnableAt        time.Time         `json:"enableAt"`
+	QuestionActive  bool              `json:"questionActive"`
+	QuestionSeq     int               `json:"questionSeq"`
+	QuestionIndex   int               `json:"questionIndex"`
+	CurrentQuestion *Question         `json:"currentQuestion,omitempty"`
+	AnswersLocked   bool              `json:"answersLocked"`
+	Me              *Player           `json:"me"`
+	Rank            int               `json:"rank"`
+	Team            *Team             `json:"team,omitempty"`
+	Answering       bool              `json:"answering"`               // It is the player's turn to answer
+	QueuePosition   int               `json:"queuePosition,omitempty"` // Place in the buzzer queue, 0 if not queued
+	LockedOut       bool              `json:"lockedOut"`
+	Teams           []ScoreboardEntry `json:"teams"`
+}
+
+// DisplayView is the room state sent to displays and to connections that
+// have not joined as a player
+type DisplayView struct {
+	Code            string            `json:"code"`
+	Phase           Phase             `json:"phase"`
+	EnableAt        time.Time         `json:"enableAt"`
+	QuestionActive  bool              `json:"questionActive"`
+	QuestionSeq     int               `json:"questionSeq"`
+	QuestionIndex   int               `json:"questionIndex"`
+	CurrentQuestion *Question         `json:"currentQuestion,omitempty"`
+	AnswerCount     int               `json:"answerCount"`
+	AnswersLocked   bool              `json:"answersLocked"`
+	Players         []ScoreboardEntry `json:"players"`
+	Teams           []ScoreboardEntry `json:"teams"`
 }
 
 // Event represents a WebSocket message
 type Event struct {
 	Type     EventType   `json:"type"`
+	Seq      int64       `json:"seq,omitempty"` // Room sequence number of outbound room events
 	QuizID   string      `json:"quizId,omitempty"`
 	UserID   string      `json:"userId,omitempty"`
 	ButtonID string      `json:"buttonId,omitempty"`
 	Phase    Phase       `json:"phase,omitempty"`
 	DelayMs  int         `json:"delayMs,omitempty"`
 	TsClient int64       `json:"tsClient,omitempty"`
+	TsServer int64       `json:"tsServer,omitempty"`
 	OptionID string      `json:"optionId,omitempty"`
 	Message  string      `json:"message,omitempty"`
 	Data     interface{} `json:"data,omitempty"`
+	// Protocol fields
+	RequestID string `json:"requestId,omitempty"` // Client's id of a command, echoed in its ack, nack or error
+	Code      string `json:"code,omitempty"`      // Error code, see ErrCode*
 	// New fields for team management
 	RoomCode   string `json:"roomCode,omitempty"`
 	Nickname   string `json:"nickname,omitempty"`
@@ -110,32 +456,96 @@ type Event struct {
 	TeamName   string `json:"teamName,omitempty"`
 	TeamColor  string `json:"teamColor,omitempty"`
 	Password   string `json:"password,omitempty"`
-	AdminToken string `json:"adminToken,omitempty"`
+	AdminToken string `json:"adminToken,omitempty"` // Signed, issued on room_created, sent back with admin_auth
 	AdminName  string `json:"adminName,omitempty"`
 	AdminEmail string `json:"adminEmail,omitempty"`
+	// Session fields
+	SessionToken string `json:"sessionToken,omitempty"` // Issued on join_success, sent back with resume
+	HostToken    string `json:"hostToken,omitempty"`    // Issued to admins, sent back with host_auth
+	DisplayCode  string `json:"displayCode,omitempty"`  // Sent with pair_display
+	Role         string `json:"role,omitempty"`         // Granted role in auth_success, invited role in create_invite
+	InviteCode   string `json:"inviteCode,omitempty"`   // Issued in invite_code, sent back with redeem_invite
+	MemberID     string `json:"memberId,omitempty"`     // Staff member to revoke
+	APIKey       string `json:"apiKey,omitempty"`       // Question control API key in room_created and api_key
+	LastSeq      int64  `json:"lastSeq,omitempty"`      // Last room sequence number the client saw
+	BaseSeq      int64  `json:"baseSeq,omitempty"`      // Sequence number of the state a state_patch applies to
 	// Quiz management fields
 	Answer        string `json:"answer,omitempty"`        // The answer given by player
 	CorrectAnswer string `json:"correctAnswer,omitempty"` // The correct answer
 	IsCorrect     bool   `json:"isCorrect,omitempty"`     // Whether the answer is correct
 	Points        int    `json:"points,omitempty"`        // Points awarded for the answer
 	PlayerName    string `json:"playerName,omitempty"`    // Name of the player who answered
+	// Question bank fields
+	Quiz       *Quiz  `json:"quiz,omitempty"`       // Structured quiz definition
+	QuizFormat string `json:"quizFormat,omitempty"` // "json", "yaml" or "csv" for QuizSource
+	QuizSource string `json:"quizSource,omitempty"` // Raw quiz definition text
+	QuestionID string `json:"questionId,omitempty"` // Question to start, defaults to the current one
+	DurationMs int    `json:"durationMs,omitempty"` // Timer length or extension
+	// Buzzer queue fields
+	ExcludeTeam bool  `json:"excludeTeam,omitempty"` // Lock out the wrong answerer's whole team
+	ReactionMs  int64 `json:"reactionMs,omitempty"`  // Time from question start to the buzz
+	// Scoring fields
+	Scoring *ScoringRules `json:"scoring,omitempty"` // Room scoring rules for set_scoring
+	ScoreOp string        `json:"scoreOp,omitempty"` // "add", "subtract" or "set" for score_adjust
+	Reason  string        `json:"reason,omitempty"`  // Why the host changed a score
+	Count   int           `json:"count,omitempty"`   // Number of scoring actions to undo
 }
 
-// Client represents a WebSocket connection
+// HistoryEntry is an immutable record of an accepted event in a room.
+// Event holds the resolved values (generated IDs, awarded points) so that
+// replaying the log rebuilds exactly the same room.
+type HistoryEntry struct {
+	Seq       int64     `json:"seq"`
+	RoomCode  string    `json:"roomCode"`
+	Timestamp time.Time `json:"timestamp"`
+	Role      string    `json:"role,omitempty"` // role of the sender, "system" for timers
+	Event     Event     `json:"event"`
+}
+
+// Client represents a WebSocket connection. Apart from Send and Out it is
+// only used by the actor of the room it is bound to; RoomID changes only
+// while the client's read loop waits for that actor.
 type Client struct {
+	ID     uint64 // Unique within the process
 	Conn   *websocket.Conn
-	Send   chan []byte
+	Send   chan []byte // Closed only by the hub's Run loop
+	Out    Outbound    // What did not fit into Send
 	RoomID string
 	UserID string
-	Role   string // "host" or "viewer"
+	IP     string    // Remote address, or the proxy's X-Real-IP if trusted
+	Role   string    // One of Role*, only ever set by the server
+	Delta  bool      // Gets state_patch events instead of every full state
+	Clock  ClockSync // Estimated clock offset of the device
+	// Protocol is the protocol version negotiated at connect time
+	Protocol int
+	// Encoding is the wire encoding negotiated at connect time; Send carries
+	// messages already encoded in it
+	Encoding string
+	// AdminName identifies an authenticated admin in audit records
+	AdminName string
+	// MemberID is the invited staff member the connection authenticated as
+	MemberID string
+	// RateStrikes counts the events refused in a row for rate limits; only
+	// the read loop uses it
+	RateStrikes int
+}
+
+// Outbound is the backpressure state of a client's Send queue, shared by the
+// senders and the client's write loop
+type Outbound struct {
+	Mu        sync.Mutex
+	State     []byte        // Newest state snapshot that did not fit; a newer one replaces it
+	Dropped   int           // Messages dropped because Send was full
+	CloseCode int           // Set when the client must be disconnected
+	Wake      chan struct{} // Tells an idle write loop that State is set
+	Kick      chan struct{} // Closed when CloseCode is set
 }
 
-// Hub manages all rooms and clients
+// Hub tracks all open connections; rooms and their clients are owned by the
+// service's room actors
 type Hub struct {
-	Rooms      map[string]*Room
 	Clients    map[*Client]bool
 	Register   chan *Client
 	Unregister chan *Client
 	Broadcast  chan []byte
-	Mu         sync.RWMutex
 }
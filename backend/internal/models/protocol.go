@@ -0,0 +1,241 @@
+package models
+
+import "encoding/json"
+
+// Protocol versions. Clients that do not negotiate one speak the legacy
+// protocol: flat events decoded leniently.
+const (
+	ProtocolLegacy = 0
+	ProtocolV1     = 1
+)
+
+// WebSocket subprotocols that select protocol v1 and its wire encoding
+const (
+	SubprotocolV1        = "quiz.v1" // JSON, same as SubprotocolV1JSON
+	SubprotocolV1JSON    = "quiz.v1.json"
+	SubprotocolV1MsgPack = "quiz.v1.msgpack"
+)
+
+// Wire encodings. JSON goes in text frames, MessagePack in binary frames
+// holding the same maps, arrays and values as the JSON.
+const (
+	EncodingJSON    = "json"
+	EncodingMsgPack = "msgpack"
+)
+
+// Envelope is a client command in protocol v1. The payload type depends on
+// Type, see Commands.
+type Envelope struct {
+	Type      EventType       `json:"type" quiz:"required"`
+	RequestID string          `json:"requestId,omitempty" quiz:"max=64"` // Echoed in the command's ack or nack
+	Payload   json.RawMessage `json:"payload,omitempty"`
+}
+
+// Error codes of error and nack events
+const (
+	ErrCodeBadMessage      = "bad_message"      // Not valid JSON or not an envelope
+	ErrCodeUnknownType     = "unknown_type"     // Not a client command
+	ErrCodeInvalidPayload  = "invalid_payload"  // Payload fails the command's rules
+	ErrCodeUnauthorized    = "unauthorized"     // Wrong password or session token
+	ErrCodeForbidden       = "forbidden"        // The sender's role may not do this
+	ErrCodeNotFound        = "not_found"        // No such room, player, team or question
+	ErrCodeConflict        = "conflict"         // Clashes with the room's state, e.g. someone answered first
+	ErrCodeInvalidState    = "invalid_state"    // Not possible in the current phase or question state
+	ErrCodeInvalidArgument = "invalid_argument" // A value the command cannot use
+	ErrCodeRateLimited     = "rate_limited"     // Too many attempts, try again later
+)
+
+// Payloads of the client commands. Their fields carry the same JSON names as
+// the matching Event fields. The quiz tag holds validation rules separated
+// by commas: required (present and not zero), max=N (string length),
+// min=N (number) and enum=a|b.
+
+// EmptyPayload is the payload of commands without parameters
+type EmptyPayload struct{}
+
+// CreateRoomPayload creates a room, optionally with a quiz
+type CreateRoomPayload struct {
+	AdminName  string `json:"adminName,omitempty" quiz:"max=64"`
+	AdminEmail string `json:"adminEmail,omitempty" quiz:"max=254"`
+	Quiz       *Quiz  `json:"quiz,omitempty"`
+	QuizFormat string `json:"quizFormat,omitempty" quiz:"enum=json|yaml|csv"`
+	QuizSource string `json:"quizSource,omitempty"`
+}
+
+// JoinPayload joins a room as a new player
+type JoinPayload struct {
+	QuizID   string `json:"quizId" quiz:"required,max=16"` // Room code
+	UserID   string `json:"userId" quiz:"required,max=64"`
+	Nickname string `json:"nickname,omitempty" quiz:"max=64"`
+	ButtonID string `json:"buttonId,omitempty" quiz:"max=64"`
+}
+
+// ResumePayload resumes a player session, or a host's or viewer's room
+type ResumePayload struct {
+	QuizID       string `json:"quizId,omitempty" quiz:"max=16"`
+	SessionToken string `json:"sessionToken,omitempty" quiz:"max=512"`
+	LastSeq      int64  `json:"lastSeq,omitempty" quiz:"min=0"`
+}
+
+// AdminAuthPayload authenticates the connection as the room's admin with
+// the admin token, in either field
+type AdminAuthPayload struct {
+	RoomCode   string `json:"roomCode" quiz:"required,max=16"`
+	AdminToken string `json:"adminToken,omitempty" quiz:"max=512"`
+	Password   string `json:"password,omitempty" quiz:"max=512"` // Older name of adminToken
+	AdminName  string `json:"adminName,omitempty" quiz:"max=64"`
+}
+
+// HostAuthPayload authenticates the connection as a host of the room
+type HostAuthPayload struct {
+	RoomCode  string `json:"roomCode" quiz:"required,max=16"`
+	HostToken string `json:"hostToken" quiz:"required,max=512"`
+}
+
+// CreateInvitePayload issues a new invitation code for a role, replacing the
+// previous one; for displays it is the display code
+type CreateInvitePayload struct {
+	Role string `json:"role" quiz:"required,enum=host|scorer|team_manager|display"`
+}
+
+// RedeemInvitePayload joins the room's staff with an invitation code
+type RedeemInvitePayload struct {
+	RoomCode   string `json:"roomCode" quiz:"required,max=16"`
+	InviteCode string `json:"inviteCode" quiz:"required,max=16"`
+	Nickname   string `json:"nickname,omitempty" quiz:"max=64"`
+}
+
+// RevokeMemberPayload takes an invited member's role away
+type RevokeMemberPayload struct {
+	MemberID string `json:"memberId" quiz:"required,max=64"`
+}
+
+// PairDisplayPayload pairs the connection as the room's display
+type PairDisplayPayload struct {
+	RoomCode    string `json:"roomCode" quiz:"required,max=16"`
+	DisplayCode string `json:"displayCode" quiz:"required,max=16"`
+}
+
+// ClickPayload is a buzzer press. Player commands carry no user ID; the
+// server acts for the player the connection joined as.
+type ClickPayload struct {
+	ButtonID string `json:"buttonId,omitempty" quiz:"max=64"`
+	TsClient int64  `json:"tsClient,omitempty" quiz:"min=0"` // Client clock at the press, Unix ms
+}
+
+// ClockPongPayload answers a clock_ping
+type ClockPongPayload struct {
+	TsClient int64 `json:"tsClient" quiz:"required,min=1"`
+	TsServer int64 `json:"tsServer" quiz:"required,min=1"`
+}
+
+// HostSetStatePayload changes the game phase
+type HostSetStatePayload struct {
+	Phase   Phase `json:"phase" quiz:"required,enum=lobby|started|active|finished"`
+	DelayMs int   `json:"delayMs,omitempty" quiz:"min=0"`
+}
+
+// CreateTeamPayload creates a team
+type CreateTeamPayload struct {
+	TeamName  string `json:"teamName" quiz:"required,max=64"`
+	TeamColor string `json:"teamColor,omitempty" quiz:"max=32"`
+}
+
+// JoinTeamPayload puts a player into a team
+type JoinTeamPayload struct {
+	TeamID string `json:"teamId" quiz:"required,max=64"`
+}
+
+// StartQuestionPayload starts a question
+type StartQuestionPayload struct {
+	QuestionID string `json:"questionId,omitempty" quiz:"max=64"`
+	DurationMs int    `json:"durationMs,omitempty" quiz:"min=0"`
+}
+
+// AnswerReceivedPayload is the first answerer's answer
+type AnswerReceivedPayload struct {
+	Answer string `json:"answer,omitempty" quiz:"max=1024"`
+}
+
+// AnswerConfirmationPayload is the host's verdict on the first answer
+type AnswerConfirmationPayload struct {
+	IsCorrect     bool   `json:"isCorrect,omitempty"`
+	Points        int    `json:"points,omitempty"`
+	CorrectAnswer string `json:"correctAnswer,omitempty" quiz:"max=1024"`
+}
+
+// LoadQuizPayload loads a quiz into the room
+type LoadQuizPayload struct {
+	Quiz       *Quiz  `json:"quiz,omitempty"`
+	QuizFormat string `json:"quizFormat,omitempty" quiz:"enum=json|yaml|csv"`
+	QuizSource string `json:"quizSource,omitempty"`
+}
+
+// SubmitAnswerPayload picks an option of a multiple-choice question
+type SubmitAnswerPayload struct {
+	OptionID string `json:"optionId" quiz:"required,max=64"`
+}
+
+// SetScoringPayload sets the room's scoring rules
+type SetScoringPayload struct {
+	Scoring *ScoringRules `json:"scoring,omitempty"`
+}
+
+// ScoreAdjustPayload changes a player's or team's score by hand
+type ScoreAdjustPayload struct {
+	UserID  string `json:"userId,omitempty" quiz:"max=64"`
+	TeamID  string `json:"teamId,omitempty" quiz:"max=64"`
+	ScoreOp string `json:"scoreOp" quiz:"required,enum=add|subtract|set"`
+	Points  int    `json:"points,omitempty"`
+	Reason  string `json:"reason,omitempty" quiz:"max=256"`
+}
+
+// ScoreUndoPayload reverts the latest scoring actions
+type ScoreUndoPayload struct {
+	Count  int    `json:"count,omitempty" quiz:"min=0"`
+	Reason string `json:"reason,omitempty" quiz:"max=256"`
+}
+
+// TimerPayload starts or extends the question timer
+type TimerPayload struct {
+	DurationMs int `json:"durationMs,omitempty" quiz:"min=0"`
+}
+
+// Commands maps every client command to its payload type
+var Commands = map[EventType]interface{}{
+	EventCreateRoom:         CreateRoomPayload{},
+	EventJoin:               JoinPayload{},
+	EventResume:             ResumePayload{},
+	EventLeave:              EmptyPayload{},
+	EventAdminAuth:          AdminAuthPayload{},
+	EventHostAuth:           HostAuthPayload{},
+	EventPairDisplay:        PairDisplayPayload{},
+	EventRevokeTokens:       EmptyPayload{},
+	EventCreateInvite:       CreateInvitePayload{},
+	EventRedeemInvite:       RedeemInvitePayload{},
+	EventRevokeMember:       RevokeMemberPayload{},
+	EventRotateAPIKey:       EmptyPayload{},
+	EventClick:              ClickPayload{},
+	EventClockSync:          EmptyPayload{},
+	EventClockPong:          ClockPongPayload{},
+	EventHostSetState:       HostSetStatePayload{},
+	EventCreateTeam:         CreateTeamPayload{},
+	EventJoinTeam:           JoinTeamPayload{},
+	EventStartQuestion:      StartQuestionPayload{},
+	EventAnswerReceived:     AnswerReceivedPayload{},
+	EventAnswerConfirmation: AnswerConfirmationPayload{},
+	EventShowAnswer:         EmptyPayload{},
+	EventNextQuestion:       EmptyPayload{},
+	EventLoadQuiz:           LoadQuizPayload{},
+	EventSubmitAnswer:       SubmitAnswerPayload{},
+	EventLockAnswers:        EmptyPayload{},
+	EventSetScoring:         SetScoringPayload{},
+	EventScoreAdjust:        ScoreAdjustPayload{},
+	EventScoreUndo:          ScoreUndoPayload{},
+	EventLeaderboard:        EmptyPayload{},
+	EventTimerStart:         TimerPayload{},
+	EventTimerPause:         EmptyPayload{},
+	EventTimerResume:        EmptyPayload{},
+	EventTimerExtend:        TimerPayload{},
+	EventTimerCancel:        EmptyPayload{},
+}
@@ -0,0 +1,211 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"sort"
+
+	"powerpoint-quiz/internal/models"
+)
+
+// ErrRoomNotFound is returned when a room is gone before a request reaches it
+var ErrRoomNotFound = errors.New("room not found")
+
+// roomInboxSize bounds the work queued for a room before senders block
+const roomInboxSize = 256
+
+// roomActor runs everything that touches one room on its own goroutine:
+// client events, timers, presence and REST calls. Only that goroutine reads
+// or writes the room, its clients, timers and outbox, so rooms need no locks
+// and never wait on each other.
+type roomActor struct {
+	room    *models.Room
+	clients map[*models.Client]*viewSync // What each client knows of the state
+	timers  map[string]*countdown        // Keyed by timer kind
+	outbox  roomOutbox
+	dirty   bool // The room changed since it was last saved
+	inbox   chan func()
+	done    chan struct{} // Closed when the room is deleted
+}
+
+func (a *roomActor) run() {
+	for {
+		select {
+		case fn := <-a.inbox:
+			fn()
+		case <-a.done:
+			return
+		}
+		select {
+		case <-a.done:
+			return
+		default:
+		}
+	}
+}
+
+// send queues fn on the actor; false if the room was deleted
+func (a *roomActor) send(fn func()) bool {
+	select {
+	case a.inbox <- fn:
+		return true
+	case <-a.done:
+		return false
+	}
+}
+
+// actorFor returns the actor of a room, starting it for a stored room that
+// has none yet (e.g. after a restart). nil if the room does not exist.
+func (ws *WebSocketService) actorFor(code string) *roomActor {
+	ws.roomsMu.Lock()
+	defer ws.roomsMu.Unlock()
+	if a, ok := ws.rooms[code]; ok {
+		return a
+	}
+	room, ok := ws.store.Get(code)
+	if !ok {
+		return nil
+	}
+	a := ws.startActorLocked(room)
+	// Runs before anything else reaches the new actor
+	a.send(func() { ws.recoverRoom(room) })
+	return a
+}
+
+// recoverRoom brings a stored room back to life after a restart. Its
+// connections, timers and grace periods are gone with the old process, so
+// its players become disconnected with a fresh grace period, and the
+// question that was open is closed since nothing would end it.
+func (ws *WebSocketService) recoverRoom(room *models.Room) {
+	ids := make([]string, 0, len(room.Players))
+	for id := range room.Players {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		player := room.Players[id]
+		if player.Left {
+			continue
+		}
+		disconnectedAt := player.DisconnectedAt
+		if player.Connected {
+			entry := ws.commit(room, "system", models.Event{
+				Type:   models.EventPlayerDisconnected,
+				UserID: id,
+			})
+			disconnectedAt = entry.Timestamp
+		}
+		ws.startGracePeriod(room, id, disconnectedAt)
+	}
+
+	ws.timeUp(room)
+	ws.saveRoom(room)
+	log.Printf("Room %s recovered from the store", room.Code)
+}
+
+// startActor starts the actor of a newly created room
+func (ws *WebSocketService) startActor(room *models.Room) *roomActor {
+	ws.roomsMu.Lock()
+	defer ws.roomsMu.Unlock()
+	return ws.startActorLocked(room)
+}
+
+func (ws *WebSocketService) startActorLocked(room *models.Room) *roomActor {
+	a := &roomActor{
+		room:    room,
+		clients: make(map[*models.Client]*viewSync),
+		timers:  make(map[string]*countdown),
+		inbox:   make(chan func(), roomInboxSize),
+		done:    make(chan struct{}),
+	}
+	ws.rooms[room.Code] = a
+	go a.run()
+	return a
+}
+
+// actorOf returns the actor of a room; called from that actor's goroutine,
+// where it always exists
+func (ws *WebSocketService) actorOf(room *models.Room) *roomActor {
+	ws.roomsMu.RLock()
+	defer ws.roomsMu.RUnlock()
+	return ws.rooms[room.Code]
+}
+
+// markChanged notes that the room's state changed and has to be saved;
+// called from the room's actor
+func (ws *WebSocketService) markChanged(room *models.Room) {
+	if a := ws.actorOf(room); a != nil {
+		a.dirty = true
+	}
+}
+
+// stopActor forgets a deleted room's actor and ends its goroutine once the
+// current work is done; called from that goroutine
+func (ws *WebSocketService) stopActor(a *roomActor) {
+	ws.roomsMu.Lock()
+	delete(ws.rooms, a.room.Code)
+	ws.roomsMu.Unlock()
+	close(a.done)
+}
+
+// post queues fn on a room's actor without waiting for it; false if the room
+// does not exist
+func (ws *WebSocketService) post(code string, fn func(a *roomActor)) bool {
+	a := ws.actorFor(code)
+	if a == nil {
+		return false
+	}
+	return a.send(func() { fn(a) })
+}
+
+// call runs fn on a room's actor and waits for it to finish; false if the
+// room does not exist. It must never be called from a room actor.
+func (ws *WebSocketService) call(code string, fn func(a *roomActor)) bool {
+	a := ws.actorFor(code)
+	if a == nil {
+		return false
+	}
+	finished := make(chan struct{})
+	if !a.send(func() { fn(a); close(finished) }) {
+		return false
+	}
+	select {
+	case <-finished:
+		return true
+	case <-a.done:
+		// fn may have deleted the room itself
+		select {
+		case <-finished:
+			return true
+		default:
+			return false
+		}
+	}
+}
+
+// bindClient makes a client a member of a room so it gets the room's
+// broadcasts, starting with a full state of its view; called from the room's
+// actor
+func (ws *WebSocketService) bindClient(room *models.Room, client *models.Client) {
+	if client.RoomID != room.Code {
+		client.RoomID = room.Code
+	}
+	ws.actorOf(room).clients[client] = &viewSync{}
+}
+
+// unbindClient takes a client out of the room it is bound to and waits until
+// the room no longer uses it. Roles and player identities belong to a room,
+// so the client becomes a viewer again. Called from the client's read loop.
+func (ws *WebSocketService) unbindClient(client *models.Client) {
+	if client.RoomID == "" {
+		return
+	}
+	ws.call(client.RoomID, func(a *roomActor) {
+		delete(a.clients, client)
+	})
+	client.RoomID = ""
+	client.Role = models.RoleViewer
+	client.UserID = ""
+	client.MemberID = ""
+	client.AdminName = ""
+}
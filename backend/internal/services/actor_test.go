@@ -0,0 +1,171 @@
+package services
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"powerpoint-quiz/internal/models"
+)
+
+// countingStore counts the rooms written to it
+type countingStore struct {
+	*MemoryRoomStore
+	puts int
+}
+
+func (s *countingStore) Put(room *models.Room) error {
+	s.puts++
+	return s.MemoryRoomStore.Put(room)
+}
+
+// Events that change nothing, and refused ones, do not write the room
+func TestRoomSavedOnlyAfterChanges(t *testing.T) {
+	store := &countingStore{MemoryRoomStore: NewMemoryRoomStore()}
+	opts := DefaultOptions()
+	opts.SessionSecret = []byte("test secret")
+	opts.ConnRateLimits = nil
+	opts.IPRateLimits = nil
+	opts.SendBuffer = 1024
+	ws := NewWebSocketService(store, NewMemoryHistoryStore(), opts)
+
+	admin := newTestClient(ws, "192.0.2.1")
+	code := createTestRoom(t, ws, admin, nil)
+	player := newTestClient(ws, "192.0.2.2")
+
+	tests := []struct {
+		name  string
+		event models.Event
+		saved bool
+	}{
+		{"join", models.Event{Type: models.EventJoin, QuizID: code, UserID: "u1", Nickname: "Ann"}, true},
+		{"read only", models.Event{Type: models.EventLeaderboard}, false},
+		{"refused", models.Event{Type: models.EventStartQuestion}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := store.puts
+			ws.HandleEvent(player, tt.event)
+			onRoom(t, ws, code, func(*models.Room) {}) // Wait for the actor
+			if saved := store.puts > before; saved != tt.saved {
+				t.Errorf("saved = %v, want %v", saved, tt.saved)
+			}
+		})
+	}
+}
+
+// A room loaded after a restart has no connections or timers left, so its
+// players are disconnected with a new grace period and its open question is
+// closed
+func TestRecoverRoomAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileRoomStore(dir, 1000, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	history := NewMemoryHistoryStore()
+	opts := DefaultOptions()
+	opts.SessionSecret = []byte("test secret")
+	opts.ConnRateLimits = nil
+	opts.IPRateLimits = nil
+	ws := NewWebSocketService(store, history, opts)
+
+	admin := newTestClient(ws, "192.0.2.1")
+	code := createTestRoom(t, ws, admin, nil)
+	joinTestPlayer(t, ws, code, "u1")
+	ws.ClientDisconnected(joinTestPlayer(t, ws, code, "u2"))
+	if err := dispatch(t, ws, admin, code, models.Event{Type: models.EventStartQuestion}); err != nil {
+		t.Fatal(err)
+	}
+	onRoom(t, ws, code, func(room *models.Room) {
+		if !room.QuestionActive {
+			t.Error("question not started")
+		}
+		ws.saveRoom(room) // HandleEvent saves after dispatch
+	})
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewFileRoomStore(dir, 1000, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	opts.ReconnectGrace = 10 * time.Millisecond
+	restarted := NewWebSocketService(reopened, history, opts)
+
+	onRoom(t, restarted, code, func(room *models.Room) {
+		if room.QuestionActive {
+			t.Error("question still active after the restart")
+		}
+		for id, player := range room.Players {
+			if player.Connected {
+				t.Errorf("player %s still connected after the restart", id)
+			}
+		}
+	})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		left := 0
+		onRoom(t, restarted, code, func(room *models.Room) {
+			for _, player := range room.Players {
+				if player.Left {
+					left++
+				}
+			}
+		})
+		if left == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d of 2 players left after the grace period", left)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// Events from many connections at once are applied one at a time, none lost.
+// Run with -race to check that only the actor touches the room.
+func TestRoomActorSerializesConcurrentEvents(t *testing.T) {
+	ws := newTestService(t)
+	admin := newTestClient(ws, "192.0.2.1")
+	code := createTestRoom(t, ws, admin, nil)
+
+	const players, posts = 20, 50
+	counted := 0 // Only written on the actor
+	var wg sync.WaitGroup
+	for i := 0; i < players; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			client := newTestClient(ws, "192.0.2.10")
+			id := fmt.Sprintf("u%02d", i)
+			ws.HandleEvent(client, models.Event{Type: models.EventJoin, QuizID: code, UserID: id, Nickname: id})
+			for j := 0; j < posts; j++ {
+				ws.post(code, func(a *roomActor) {
+					counted++
+					a.room.Players[id].Score++
+				})
+				ws.HandleEvent(client, models.Event{Type: models.EventLeaderboard})
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	onRoom(t, ws, code, func(room *models.Room) {
+		if counted != players*posts {
+			t.Errorf("ran %d posted jobs, want %d", counted, players*posts)
+		}
+		if len(room.Players) != players {
+			t.Errorf("%d players joined, want %d", len(room.Players), players)
+		}
+		for id, player := range room.Players {
+			if player.Score != posts || !player.Connected {
+				t.Errorf("%s: score %d, connected %v", id, player.Score, player.Connected)
+			}
+		}
+	})
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"log"
+	"strings"
+
+	"powerpoint-quiz/internal/models"
+)
+
+// API keys let PowerPoint start and stop questions over the REST API. A key
+// belongs to one room, whose code it carries, and covers question control
+// only; the room keeps just its hash.
+const apiKeyPrefix = "pqk_"
+
+// API key errors
+var (
+	ErrAPIKeyMissing   = errors.New("API key required")
+	ErrAPIKeyMalformed = errors.New("malformed API key")
+	ErrAPIKeyInvalid   = errors.New("invalid API key")
+)
+
+// issueAPIKey gives the room a new API key, which replaces the previous
+// one, and returns it
+func issueAPIKey(room *models.Room) string {
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		panic("crypto/rand failed: " + err.Error())
+	}
+	key := apiKeyPrefix + room.Code + "_" + hex.EncodeToString(secret)
+	room.APIKeyHash = hashAPIKey(key)
+	return key
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// apiKeyRoom returns the code of the room an API key names
+func apiKeyRoom(key string) (string, bool) {
+	rest, ok := strings.CutPrefix(key, apiKeyPrefix)
+	if !ok {
+		return "", false
+	}
+	code, secret, ok := strings.Cut(rest, "_")
+	return code, ok && code != "" && secret != ""
+}
+
+// AuthorizeAPIKey checks an API key presented to the question control API
+// from the given address and returns the room it belongs to. Failures lock
+// the address out of API keys only, see authenticate.
+func (ws *WebSocketService) AuthorizeAPIKey(key, ip string) (*models.Room, error) {
+	if key == "" {
+		return nil, ErrAPIKeyMissing
+	}
+	code, ok := apiKeyRoom(key)
+	if !ok {
+		return nil, ErrAPIKeyMalformed
+	}
+	room := ws.GetRoom(code)
+	if room == nil {
+		return nil, ErrAPIKeyInvalid
+	}
+
+	err := ErrAPIKeyInvalid
+	ws.call(room.Code, func(a *roomActor) {
+		err = ws.authenticate(&models.Client{IP: ip}, room, authScopeAPIKey, "API key auth", func() error {
+			if room.APIKeyHash == "" || subtle.ConstantTimeCompare([]byte(room.APIKeyHash), []byte(hashAPIKey(key))) != 1 {
+				return ErrAPIKeyInvalid
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return room, nil
+}
+
+// handleRotateAPIKey replaces the room's API key and sends the new one to
+// the admin only
+func (ws *WebSocketService) handleRotateAPIKey(client *models.Client, room *models.Room) error {
+	key := issueAPIKey(room)
+	ws.markChanged(room)
+	log.Printf("API key of room %s rotated", room.Code)
+
+	ws.sendEventToClient(client, models.Event{
+		Type:     models.EventAPIKey,
+		RoomCode: room.Code,
+		APIKey:   key,
+	})
+	return nil
+}
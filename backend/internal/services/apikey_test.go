@@ -0,0 +1,109 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"powerpoint-quiz/internal/models"
+)
+
+func TestAuthorizeAPIKey(t *testing.T) {
+	ws := newTestService(t)
+	admin := newTestClient(ws, "192.0.2.1")
+	code := createTestRoom(t, ws, admin, nil)
+	key := ""
+	onRoom(t, ws, code, func(room *models.Room) { key = issueAPIKey(room) })
+
+	tests := []struct {
+		name string
+		key  string
+		want error
+	}{
+		{"valid", key, nil},
+		{"missing", "", ErrAPIKeyMissing},
+		{"malformed", "not-a-key", ErrAPIKeyMalformed},
+		{"unknown room", apiKeyPrefix + "ZZZZ_00", ErrAPIKeyInvalid},
+		{"wrong secret", apiKeyPrefix + code + "_00", ErrAPIKeyInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			room, err := ws.AuthorizeAPIKey(tt.key, "192.0.2.50")
+			switch {
+			case tt.want == nil && err != nil:
+				t.Fatalf("unexpected error %v", err)
+			case tt.want == nil && room.Code != code:
+				t.Errorf("room = %s, want %s", room.Code, code)
+			case tt.want != nil && !errors.Is(err, tt.want) && refusalCode(err) != models.ErrCodeUnauthorized:
+				t.Errorf("error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// Wrong API keys lock the address out of API keys, not out of logging in,
+// and failed logins do not stop the add-in
+func TestAPIKeyLockoutIsSeparate(t *testing.T) {
+	ws := newTestService(t)
+	admin := newTestClient(ws, "192.0.2.1")
+	code := createTestRoom(t, ws, admin, nil)
+	key, adminToken := "", ""
+	onRoom(t, ws, code, func(room *models.Room) {
+		key = issueAPIKey(room)
+		adminToken = ws.signAdminToken(room)
+	})
+
+	const ip = "192.0.2.60"
+	for i := 0; i < ws.opts.AuthMaxFailures; i++ {
+		ws.AuthorizeAPIKey(apiKeyPrefix+code+"_00", ip)
+	}
+	if _, err := ws.AuthorizeAPIKey(key, ip); refusalCode(err) != models.ErrCodeRateLimited {
+		t.Fatalf("API key after lockout: got %v, want rate_limited", err)
+	}
+	if err := ws.AuthorizeAdmin(ws.GetRoom(code), adminToken, ip); err != nil {
+		t.Fatalf("admin login after API key lockout: %v", err)
+	}
+
+	const other = "192.0.2.61"
+	for i := 0; i < ws.opts.AuthMaxFailures; i++ {
+		ws.AuthorizeAdmin(ws.GetRoom(code), "wrong", other)
+	}
+	if _, err := ws.AuthorizeAPIKey(key, other); err != nil {
+		t.Fatalf("API key after login lockout: %v", err)
+	}
+}
+
+// Rotating the API key stops the old one and sends the new one to the admin
+// who asked only
+func TestRotateAPIKey(t *testing.T) {
+	ws := newTestService(t)
+	admin := newTestClient(ws, "192.0.2.1")
+	code := createTestRoom(t, ws, admin, nil)
+	host := newTestClient(ws, "192.0.2.2")
+	onRoom(t, ws, code, func(room *models.Room) { ws.grantRole(host, room, models.RoleHost, nil) })
+
+	keys := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		drain(t, host)
+		if err := dispatch(t, ws, admin, code, models.Event{Type: models.EventRotateAPIKey}); err != nil {
+			t.Fatal(err)
+		}
+		event, ok := received(t, admin, models.EventAPIKey)
+		if !ok || event.APIKey == "" || event.RoomCode != code {
+			t.Fatalf("rotation %d sent %+v", i+1, event)
+		}
+		if _, ok := received(t, host, models.EventAPIKey); ok {
+			t.Error("API key sent to a host")
+		}
+		keys[event.APIKey] = true
+
+		for key := range keys {
+			_, err := ws.AuthorizeAPIKey(key, "192.0.2.50")
+			if current := key == event.APIKey; current != (err == nil) {
+				t.Errorf("rotation %d: key current = %v, error = %v", i+1, current, err)
+			}
+		}
+	}
+	if len(keys) != 2 {
+		t.Error("rotation issued the same key twice")
+	}
+}
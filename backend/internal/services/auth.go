@@ -0,0 +1,394 @@
+package services
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"powerpoint-quiz/internal/models"
+)
+
+// signAdminToken issues the token that makes a connection the room's admin
+func (ws *WebSocketService) signAdminToken(room *models.Room) string {
+	return ws.signRoleToken(room, models.RoleAdmin, "")
+}
+
+// signHostToken issues a token that makes a connection a host of the room,
+// so the admin can hand the game to another device without its own token
+func (ws *WebSocketService) signHostToken(room *models.Room) string {
+	return ws.signRoleToken(room, models.RoleHost, "")
+}
+
+// signMemberToken issues the token an invited member authenticates with
+// again; it is sent back with host_auth like a host token
+func (ws *WebSocketService) signMemberToken(room *models.Room, member *models.Member) string {
+	return ws.signRoleToken(room, member.Role, member.ID)
+}
+
+func (ws *WebSocketService) signRoleToken(room *models.Room, role, memberID string) string {
+	return ws.signClaims(sessionClaims{
+		Room:    room.Code,
+		Role:    role,
+		Member:  memberID,
+		Epoch:   room.TokenEpoch,
+		Expires: time.Now().Add(ws.opts.AdminTokenTTL).Unix(),
+	})
+}
+
+// verifyRoleToken checks that a token grants one of the roles in the room:
+// its signature and expiry, and that the room has not revoked it or its
+// member since
+func (ws *WebSocketService) verifyRoleToken(room *models.Room, token string, roles ...string) (*sessionClaims, error) {
+	claims, err := ws.verifySession(token)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Room != room.Code || !containsString(roles, claims.Role) {
+		return nil, ErrSessionInvalid
+	}
+	if claims.Epoch != room.TokenEpoch {
+		return nil, ErrTokenRevoked
+	}
+	if claims.Member != "" {
+		if member := room.Members[claims.Member]; member == nil || member.Role != claims.Role {
+			return nil, ErrTokenRevoked
+		}
+	}
+	return claims, nil
+}
+
+// AuthorizeAdmin checks an admin token presented to the REST API from the
+// given address, with the same lockout as admin_auth
+func (ws *WebSocketService) AuthorizeAdmin(room *models.Room, token, ip string) error {
+	err := ErrSessionInvalid
+	found := ws.call(room.Code, func(a *roomActor) {
+		client := &models.Client{IP: ip}
+		err = ws.authenticate(client, room, authScopeLogin, "API admin auth", func() error {
+			_, err := ws.verifyRoleToken(room, token, models.RoleAdmin)
+			return err
+		})
+	})
+	if !found {
+		return refuse(models.ErrCodeNotFound, "Room not found")
+	}
+	return err
+}
+
+// Lockout scopes. Failed API keys are counted apart from failed logins so
+// a misconfigured add-in cannot lock its admin out, nor the other way round.
+const (
+	authScopeLogin  = "login"
+	authScopeAPIKey = "api_key"
+)
+
+// authenticate runs one authentication attempt of a client on a room,
+// refusing it outright while the client's address is locked out in the
+// scope and counting it against the address if check fails. Failures are not
+// counted per room, or anyone could lock the real admin out of it.
+func (ws *WebSocketService) authenticate(client *models.Client, room *models.Room, scope, what string, check func() error) error {
+	key := scope + ":" + client.IP
+	if wait := ws.auth.retryAfter(key); wait > 0 {
+		log.Printf("Refused %s for room %s from %s: locked out", what, room.Code, client.IP)
+		return refuse(models.ErrCodeRateLimited,
+			fmt.Sprintf("Too many failed attempts, try again in %d s", int(math.Ceil(wait.Seconds()))))
+	}
+	if err := check(); err != nil {
+		ws.auth.fail(key)
+		log.Printf("Failed %s for room %s from %s: %v", what, room.Code, client.IP, err)
+		return refuse(models.ErrCodeUnauthorized, err.Error())
+	}
+	ws.auth.reset(key)
+	return nil
+}
+
+// handleAdminAuth makes the client the room's admin if it has a valid
+// admin token
+func (ws *WebSocketService) handleAdminAuth(client *models.Client, room *models.Room, event models.Event) error {
+	token := event.AdminToken
+	if token == "" {
+		token = event.Password
+	}
+	err := ws.authenticate(client, room, authScopeLogin, string(event.Type), func() error {
+		_, err := ws.verifyRoleToken(room, token, models.RoleAdmin)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	ws.grantRole(client, room, models.RoleAdmin, nil)
+	client.AdminName = event.AdminName
+	log.Printf("Admin authenticated for room: %s", room.Code)
+	return nil
+}
+
+// handleHostAuth makes the client a host of the room if it has a valid host
+// token, or gives an invited member its role back with its member token
+func (ws *WebSocketService) handleHostAuth(client *models.Client, room *models.Room, event models.Event) error {
+	var claims *sessionClaims
+	err := ws.authenticate(client, room, authScopeLogin, string(event.Type), func() (err error) {
+		claims, err = ws.verifyRoleToken(room, event.HostToken, invitedRoles...)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	member := room.Members[claims.Member]
+	ws.grantRole(client, room, claims.Role, member)
+	if member != nil {
+		log.Printf("Member %s (%s) authenticated for room: %s", member.ID, member.Role, room.Code)
+		ws.broadcastRoomState(room)
+	} else {
+		log.Printf("Host authenticated for room: %s", room.Code)
+	}
+	return nil
+}
+
+// handleRedeemInvite adds the client to the room's staff with the role of
+// the invitation code it knows
+func (ws *WebSocketService) handleRedeemInvite(client *models.Client, room *models.Room, event models.Event) error {
+	var role string
+	err := ws.authenticate(client, room, authScopeLogin, string(event.Type), func() error {
+		for _, invited := range invitedRoles {
+			code := room.Invites[invited]
+			if code != "" && subtle.ConstantTimeCompare([]byte(code), []byte(event.InviteCode)) == 1 {
+				role = invited
+				return nil
+			}
+		}
+		return fmt.Errorf("invalid invitation code")
+	})
+	if err != nil {
+		return err
+	}
+
+	member := &models.Member{
+		ID:       "member_" + generateInviteCode(),
+		Role:     role,
+		Name:     event.Nickname,
+		JoinedAt: time.Now(),
+	}
+	if room.Members == nil {
+		room.Members = make(map[string]*models.Member)
+	}
+	room.Members[member.ID] = member
+	ws.markChanged(room)
+	log.Printf("Member %s joined room %s as %s", member.ID, room.Code, role)
+
+	ws.grantRole(client, room, role, member)
+	ws.broadcastRoomState(room)
+	return nil
+}
+
+// handlePairDisplay makes the client the room's display if it knows the
+// pairing code shown to the hosts
+func (ws *WebSocketService) handlePairDisplay(client *models.Client, room *models.Room, event models.Event) error {
+	err := ws.authenticate(client, room, authScopeLogin, string(event.Type), func() error {
+		if room.DisplayCode == "" || subtle.ConstantTimeCompare([]byte(room.DisplayCode), []byte(event.DisplayCode)) != 1 {
+			return fmt.Errorf("invalid display code")
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	ws.grantRole(client, room, models.RoleDisplay, nil)
+	log.Printf("Display paired with room: %s", room.Code)
+	return nil
+}
+
+// handleCreateInvite issues a new invitation code for a role and sends it
+// to the admin only. The previous code of the role stops working; members
+// who already joined with it keep their role. For displays the code is the
+// display code.
+func (ws *WebSocketService) handleCreateInvite(client *models.Client, room *models.Room, event models.Event) error {
+	var code string
+	switch {
+	case event.Role == models.RoleDisplay:
+		room.DisplayCode = generateDisplayCode()
+		code = room.DisplayCode
+	case containsString(invitedRoles, event.Role):
+		code = generateInviteCode()
+		if room.Invites == nil {
+			room.Invites = make(map[string]string)
+		}
+		room.Invites[event.Role] = code
+	default:
+		return refuse(models.ErrCodeInvalidArgument, fmt.Sprintf("Role %q cannot be invited", event.Role))
+	}
+	ws.markChanged(room)
+	log.Printf("Invitation for %s issued in room %s", event.Role, room.Code)
+
+	ws.sendEventToClient(client, models.Event{
+		Type:       models.EventInviteCode,
+		RoomCode:   room.Code,
+		Role:       event.Role,
+		InviteCode: code,
+	})
+	ws.broadcastRoomState(room)
+	return nil
+}
+
+// handleRevokeMember takes an invited member's role away, also from its
+// open connections, and invalidates its member token
+func (ws *WebSocketService) handleRevokeMember(room *models.Room, event models.Event) error {
+	member, ok := room.Members[event.MemberID]
+	if !ok {
+		return refuse(models.ErrCodeNotFound, "Member not found")
+	}
+	delete(room.Members, member.ID)
+	ws.markChanged(room)
+	for other := range ws.actorOf(room).clients {
+		if other.MemberID == member.ID {
+			ws.demote(other, room)
+		}
+	}
+	log.Printf("Member %s (%s) revoked in room %s", member.ID, member.Role, room.Code)
+
+	ws.broadcastRoomState(room)
+	return nil
+}
+
+// handleRevokeTokens invalidates every admin, host and member token of the
+// room, its invitations and its display code. Everyone else who holds a role
+// goes back to being a viewer; the admin who asked gets fresh tokens.
+func (ws *WebSocketService) handleRevokeTokens(client *models.Client, room *models.Room) error {
+	room.TokenEpoch++
+	room.DisplayCode = generateDisplayCode()
+	room.Invites = nil
+	room.Members = nil
+	ws.markChanged(room)
+	for other := range ws.actorOf(room).clients {
+		if other != client && (isStaff(other) || other.Role == models.RoleDisplay) {
+			ws.demote(other, room)
+		}
+	}
+	log.Printf("Tokens of room %s revoked", room.Code)
+
+	ws.grantRole(client, room, models.RoleAdmin, nil)
+	ws.broadcastRoomState(room)
+	return nil
+}
+
+// demote makes a client whose access was revoked a viewer again and tells it
+// so
+func (ws *WebSocketService) demote(client *models.Client, room *models.Room) {
+	client.Role = models.RoleViewer
+	client.AdminName = ""
+	client.MemberID = ""
+	ws.sendEventToClient(client, models.Event{
+		Type:    models.EventError,
+		Code:    models.ErrCodeUnauthorized,
+		Message: "Access to the room was revoked",
+	})
+	ws.sendState(client, room)
+}
+
+// grantRole binds an authenticated client to the room with its new role,
+// tells it so and sends it the state its role may see. Invited members get
+// their member token back; otherwise admins get a fresh admin token, and
+// admins and hosts a host token to hand on.
+func (ws *WebSocketService) grantRole(client *models.Client, room *models.Room, role string, member *models.Member) {
+	ws.bindClient(room, client)
+	client.Role = role
+	client.MemberID = ""
+
+	success := models.Event{
+		Type:     models.EventAuthSuccess,
+		RoomCode: room.Code,
+		Role:     role,
+	}
+	switch {
+	case member != nil:
+		client.MemberID = member.ID
+		client.AdminName = member.Name
+		success.MemberID = member.ID
+		success.HostToken = ws.signMemberToken(room, member)
+	case role == models.RoleAdmin:
+		success.AdminToken = ws.signAdminToken(room)
+		success.HostToken = ws.signHostToken(room)
+	case role == models.RoleHost:
+		success.HostToken = ws.signHostToken(room)
+	}
+	ws.sendEventToClient(client, success)
+	ws.sendState(client, room)
+}
+
+// authLimiter locks out an address after repeated failed authentications
+// in a scope. It counts per address only: a key per room would let anyone
+// lock the real admin out of a room by failing on purpose. Room actors
+// authenticate concurrently, so it has its own lock.
+type authLimiter struct {
+	mu       sync.Mutex
+	max      int
+	lockout  time.Duration
+	failures map[string]*authFailures // Keyed by scope and address
+}
+
+type authFailures struct {
+	count       int
+	since       time.Time // First failure counted
+	lockedUntil time.Time
+}
+
+func newAuthLimiter(max int, lockout time.Duration) *authLimiter {
+	return &authLimiter{
+		max:      max,
+		lockout:  lockout,
+		failures: make(map[string]*authFailures),
+	}
+}
+
+// retryAfter returns how long a key stays locked out, zero if it is not
+func (l *authLimiter) retryAfter(key string) time.Duration {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if f := l.failures[key]; f != nil && f.lockedUntil.After(now) {
+		return f.lockedUntil.Sub(now)
+	}
+	return 0
+}
+
+// fail counts a failed authentication against a key and locks it out when
+// it reaches the maximum within the lockout window
+func (l *authLimiter) fail(key string) {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.prune(now)
+	f := l.failures[key]
+	if f == nil || now.Sub(f.since) > l.lockout {
+		f = &authFailures{since: now}
+		l.failures[key] = f
+	}
+	f.count++
+	if l.max > 0 && f.count >= l.max {
+		f.lockedUntil = now.Add(l.lockout)
+		f.count = 0
+		f.since = now
+	}
+}
+
+// reset forgets the failures of a key after a successful authentication
+func (l *authLimiter) reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.failures, key)
+}
+
+// prune drops the failures that neither count nor lock anything any more
+func (l *authLimiter) prune(now time.Time) {
+	for key, f := range l.failures {
+		if now.Sub(f.since) > l.lockout && !f.lockedUntil.After(now) {
+			delete(l.failures, key)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"powerpoint-quiz/internal/models"
+)
+
+func TestAuthLimiter(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int
+		reset    bool
+		locked   bool
+	}{
+		{"below the maximum", 2, false, false},
+		{"at the maximum", 3, false, true},
+		{"reset after success", 2, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newAuthLimiter(3, time.Minute)
+			for i := 0; i < tt.failures; i++ {
+				l.fail("ip:a")
+			}
+			if tt.reset {
+				l.reset("ip:a")
+				l.fail("ip:a")
+			}
+			if locked := l.retryAfter("ip:a") > 0; locked != tt.locked {
+				t.Errorf("locked = %v, want %v", locked, tt.locked)
+			}
+			if l.retryAfter("ip:b") > 0 {
+				t.Error("another key was locked out")
+			}
+		})
+	}
+}
+
+// Failed logins lock out the address they come from, never the room, so
+// nobody can lock the admin out of their own room
+func TestAuthenticateLocksOutAddressesOnly(t *testing.T) {
+	ws := newTestService(t)
+	admin := newTestClient(ws, "192.0.2.1")
+	code := createTestRoom(t, ws, admin, nil)
+	adminToken := ""
+	onRoom(t, ws, code, func(room *models.Room) { adminToken = ws.signAdminToken(room) })
+
+	attacker := newTestClient(ws, "198.51.100.7")
+	for i := 0; i < ws.opts.AuthMaxFailures; i++ {
+		err := dispatch(t, ws, attacker, code, models.Event{Type: models.EventAdminAuth, RoomCode: code, AdminToken: "wrong"})
+		if got := refusalCode(err); got != models.ErrCodeUnauthorized {
+			t.Fatalf("attempt %d: got %q, want %q", i+1, got, models.ErrCodeUnauthorized)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		client *models.Client
+		token  string
+		want   string
+	}{
+		{"attacker is locked out", attacker, adminToken, models.ErrCodeRateLimited},
+		{"admin from elsewhere gets in", newTestClient(ws, "203.0.113.5"), adminToken, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := dispatch(t, ws, tt.client, code, models.Event{Type: models.EventAdminAuth, RoomCode: code, AdminToken: tt.token})
+			if got := refusalCode(err); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthenticateResetsOnSuccess(t *testing.T) {
+	ws := newTestService(t)
+	admin := newTestClient(ws, "192.0.2.1")
+	code := createTestRoom(t, ws, admin, nil)
+	adminToken := ""
+	onRoom(t, ws, code, func(room *models.Room) { adminToken = ws.signAdminToken(room) })
+
+	client := newTestClient(ws, "192.0.2.2")
+	login := func(token string) error {
+		return dispatch(t, ws, client, code, models.Event{Type: models.EventAdminAuth, RoomCode: code, AdminToken: token})
+	}
+	for round := 0; round < 3; round++ {
+		for i := 0; i < ws.opts.AuthMaxFailures-1; i++ {
+			login("wrong")
+		}
+		if err := login(adminToken); err != nil {
+			t.Fatalf("round %d: %v", round, err)
+		}
+	}
+}
+
+// inviteMember has the admin invite a role and a new connection redeem the
+// invitation; it returns the member's connection and member token
+func inviteMember(t *testing.T, ws *WebSocketService, code string, admin *models.Client, role, ip string) (*models.Client, string) {
+	t.Helper()
+	if err := dispatch(t, ws, admin, code, models.Event{Type: models.EventCreateInvite, Role: role}); err != nil {
+		t.Fatalf("create_invite: %v", err)
+	}
+	invite, ok := received(t, admin, models.EventInviteCode)
+	if !ok || invite.InviteCode == "" {
+		t.Fatalf("no invitation code, got %+v", invite)
+	}
+	member := newTestClient(ws, ip)
+	err := dispatch(t, ws, member, code, models.Event{Type: models.EventRedeemInvite, RoomCode: code, InviteCode: invite.InviteCode, Nickname: "Sam"})
+	if err != nil {
+		t.Fatalf("redeem_invite: %v", err)
+	}
+	success, ok := received(t, member, models.EventAuthSuccess)
+	if !ok || success.HostToken == "" || success.MemberID == "" {
+		t.Fatalf("auth_success = %+v", success)
+	}
+	return member, success.HostToken
+}
+
+// An invitation gives its role and a member token; a new invitation for the
+// role replaces the old code
+func TestRedeemInvite(t *testing.T) {
+	ws := newTestService(t)
+	admin := newTestClient(ws, "192.0.2.1")
+	code := createTestRoom(t, ws, admin, nil)
+
+	member, token := inviteMember(t, ws, code, admin, models.RoleScorer, "192.0.2.20")
+	if member.Role != models.RoleScorer || member.MemberID == "" {
+		t.Errorf("member is %s %q", member.Role, member.MemberID)
+	}
+	onRoom(t, ws, code, func(room *models.Room) {
+		if m := room.Members[member.MemberID]; m == nil || m.Role != models.RoleScorer || m.Name != "Sam" {
+			t.Errorf("member = %+v", m)
+		}
+	})
+
+	// The member token restores the role on a new connection
+	again := newTestClient(ws, "192.0.2.20")
+	if err := dispatch(t, ws, again, code, models.Event{Type: models.EventHostAuth, HostToken: token}); err != nil {
+		t.Fatalf("host_auth with the member token: %v", err)
+	}
+	if again.Role != models.RoleScorer || again.MemberID != member.MemberID {
+		t.Errorf("member token gave %s %q", again.Role, again.MemberID)
+	}
+
+	old := ""
+	onRoom(t, ws, code, func(room *models.Room) { old = room.Invites[models.RoleScorer] })
+	inviteMember(t, ws, code, admin, models.RoleScorer, "192.0.2.21")
+	late := newTestClient(ws, "192.0.2.22")
+	err := dispatch(t, ws, late, code, models.Event{Type: models.EventRedeemInvite, RoomCode: code, InviteCode: old})
+	if refusalCode(err) != models.ErrCodeUnauthorized || late.Role != models.RoleViewer {
+		t.Errorf("replaced code: error = %v, role %s", err, late.Role)
+	}
+}
+
+// Revoking a member, or every token, demotes the member's connections and
+// stops its member token
+func TestRevokeMembers(t *testing.T) {
+	tests := []struct {
+		name   string
+		revoke func(member *models.Client) models.Event
+	}{
+		{"revoke_member", func(member *models.Client) models.Event {
+			return models.Event{Type: models.EventRevokeMember, MemberID: member.MemberID}
+		}},
+		{"revoke_tokens", func(*models.Client) models.Event {
+			return models.Event{Type: models.EventRevokeTokens}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws := newTestService(t)
+			admin := newTestClient(ws, "192.0.2.1")
+			code := createTestRoom(t, ws, admin, nil)
+			member, token := inviteMember(t, ws, code, admin, models.RoleHost, "192.0.2.20")
+
+			if err := dispatch(t, ws, admin, code, tt.revoke(member)); err != nil {
+				t.Fatal(err)
+			}
+			if member.Role != models.RoleViewer || member.MemberID != "" {
+				t.Errorf("revoked connection is still %s %q", member.Role, member.MemberID)
+			}
+			if admin.Role != models.RoleAdmin {
+				t.Errorf("admin became %s", admin.Role)
+			}
+			onRoom(t, ws, code, func(room *models.Room) {
+				if len(room.Members) != 0 {
+					t.Errorf("members left: %v", room.Members)
+				}
+				if _, err := ws.verifyRoleToken(room, token, invitedRoles...); !errors.Is(err, ErrTokenRevoked) {
+					t.Errorf("member token: error = %v, want %v", err, ErrTokenRevoked)
+				}
+			})
+			again := newTestClient(ws, "192.0.2.20")
+			err := dispatch(t, ws, again, code, models.Event{Type: models.EventHostAuth, HostToken: token})
+			if refusalCode(err) != models.ErrCodeUnauthorized || again.Role != models.RoleViewer {
+				t.Errorf("host_auth with a revoked token: error = %v, role %s", err, again.Role)
+			}
+		})
+	}
+}
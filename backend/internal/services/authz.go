@@ -0,0 +1,94 @@
+package services
+
+import (
+	"fmt"
+	"log"
+
+	"powerpoint-quiz/internal/models"
+)
+
+// Groups of roles in the permission matrix. The admin owns the room; the
+// others are invited by it or hold a host token.
+var (
+	hostRoles  = []string{models.RoleAdmin, models.RoleHost}                                            // Run the game
+	scoreRoles = []string{models.RoleAdmin, models.RoleHost, models.RoleScorer}                         // Judge answers and keep the score
+	teamRoles  = []string{models.RoleAdmin, models.RoleTeamManager}                                     // Manage teams
+	staffRoles = []string{models.RoleAdmin, models.RoleHost, models.RoleScorer, models.RoleTeamManager} // See the host view
+)
+
+// allRoles are every role a connection can have
+var allRoles = []string{models.RoleAdmin, models.RoleHost, models.RoleScorer, models.RoleTeamManager,
+	models.RoleDisplay, models.RolePlayer, models.RoleViewer}
+
+// invitedRoles can be given to members with an invitation code
+var invitedRoles = []string{models.RoleHost, models.RoleScorer, models.RoleTeamManager}
+
+// permissions lists the roles allowed to send each command; commands not
+// listed are refused to everyone
+var permissions = map[models.EventType][]string{
+	models.EventJoin:               {models.RoleViewer},
+	models.EventResume:             {models.RoleViewer, models.RolePlayer, models.RoleDisplay},
+	models.EventAdminAuth:          allRoles,
+	models.EventHostAuth:           allRoles,
+	models.EventPairDisplay:        allRoles,
+	models.EventRedeemInvite:       allRoles,
+	models.EventClockSync:          allRoles,
+	models.EventClockPong:          allRoles,
+	models.EventLeaderboard:        allRoles,
+	models.EventClick:              {models.RolePlayer},
+	models.EventJoinTeam:           {models.RolePlayer},
+	models.EventAnswerReceived:     {models.RolePlayer},
+	models.EventSubmitAnswer:       {models.RolePlayer},
+	models.EventLeave:              {models.RolePlayer},
+	models.EventCreateTeam:         teamRoles,
+	models.EventRevokeTokens:       {models.RoleAdmin},
+	models.EventCreateInvite:       {models.RoleAdmin},
+	models.EventRevokeMember:       {models.RoleAdmin},
+	models.EventRotateAPIKey:       {models.RoleAdmin},
+	models.EventHostSetState:       hostRoles,
+	models.EventStartQuestion:      hostRoles,
+	models.EventAnswerConfirmation: scoreRoles,
+	models.EventShowAnswer:         hostRoles,
+	models.EventNextQuestion:       hostRoles,
+	models.EventLoadQuiz:           hostRoles,
+	models.EventLockAnswers:        hostRoles,
+	models.EventSetScoring:         hostRoles,
+	models.EventScoreAdjust:        scoreRoles,
+	models.EventScoreUndo:          scoreRoles,
+	models.EventTimerStart:         hostRoles,
+	models.EventTimerPause:         hostRoles,
+	models.EventTimerResume:        hostRoles,
+	models.EventTimerExtend:        hostRoles,
+	models.EventTimerCancel:        hostRoles,
+}
+
+// authorize decides whether a client's role allows a command. Handlers do
+// not check roles themselves; every command passes here first.
+func authorize(client *models.Client, eventType models.EventType) error {
+	roles, listed := permissions[eventType]
+	if !listed {
+		log.Printf("Refused %s, which no role may send", eventType)
+		return refuseQuietly(models.ErrCodeForbidden, fmt.Sprintf("No role may send %s", eventType))
+	}
+	if hasRole(client, roles...) {
+		return nil
+	}
+	log.Printf("Refused %s from a client with role %q", eventType, client.Role)
+	return refuseQuietly(models.ErrCodeForbidden, fmt.Sprintf("Role %q may not send %s", client.Role, eventType))
+}
+
+// hasRole reports whether a client has one of the roles
+func hasRole(client *models.Client, roles ...string) bool {
+	for _, role := range roles {
+		if client.Role == role {
+			return true
+		}
+	}
+	return false
+}
+
+// isStaff reports whether a client helps run the room and so sees the host
+// view
+func isStaff(client *models.Client) bool {
+	return hasRole(client, staffRoles...)
+}
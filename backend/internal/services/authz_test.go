@@ -0,0 +1,46 @@
+package services
+
+import (
+	"testing"
+
+	"powerpoint-quiz/internal/models"
+)
+
+// Every command routed to a room has a permission entry; create_room is
+// handled before a room exists
+func TestEveryCommandHasPermissions(t *testing.T) {
+	for eventType := range models.Commands {
+		if _, ok := permissions[eventType]; !ok && eventType != models.EventCreateRoom {
+			t.Errorf("%s has no permission entry and is refused to everyone", eventType)
+		}
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	tests := []struct {
+		role      string
+		eventType models.EventType
+		want      string // Refusal code, "" when allowed
+	}{
+		{models.RoleViewer, models.EventJoin, ""},
+		{models.RolePlayer, models.EventJoin, models.ErrCodeForbidden},
+		{models.RoleViewer, models.EventClick, models.ErrCodeForbidden},
+		{models.RolePlayer, models.EventClick, ""},
+		{models.RoleHost, models.EventClick, models.ErrCodeForbidden},
+		{models.RolePlayer, models.EventStartQuestion, models.ErrCodeForbidden},
+		{models.RoleHost, models.EventStartQuestion, ""},
+		{models.RoleHost, models.EventRevokeTokens, models.ErrCodeForbidden},
+		{models.RoleAdmin, models.EventRevokeTokens, ""},
+		{models.RolePlayer, models.EventAdminAuth, ""},
+		{models.RoleDisplay, models.EventResume, ""},
+		{models.RoleAdmin, models.EventType("unknown"), models.ErrCodeForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.role+"/"+string(tt.eventType), func(t *testing.T) {
+			client := &models.Client{Role: tt.role}
+			if got := refusalCode(authorize(client, tt.eventType)); got != tt.want {
+				t.Errorf("refusal = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
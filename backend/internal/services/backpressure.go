@@ -0,0 +1,122 @@
+package services
+
+import (
+	"log"
+	"sync/atomic"
+
+	"powerpoint-quiz/internal/models"
+
+	"github.com/gorilla/websocket"
+)
+
+// CloseSlowConsumer is the close code sent to a client that kept missing
+// messages because it could not read them fast enough
+const CloseSlowConsumer = websocket.ClosePolicyViolation
+
+// NewClient sets up a viewer client for a new connection with an outbound
+// queue sized by the service options
+func (ws *WebSocketService) NewClient(conn *websocket.Conn, roomID string) *models.Client {
+	return &models.Client{
+		ID:   atomic.AddUint64(&ws.lastClientID, 1),
+		Conn: conn,
+		Send: make(chan []byte, ws.opts.SendBuffer),
+		Out: models.Outbound{
+			Wake: make(chan struct{}, 1),
+			Kick: make(chan struct{}),
+		},
+		RoomID:   roomID,
+		Role:     models.RoleViewer,
+		Encoding: models.EncodingJSON,
+	}
+}
+
+// enqueue queues a message for a client, in the client's encoding, without
+// ever blocking the sender. snapshot is the full state message that stands in
+// for a state or state patch message; when Send is full it is parked instead
+// and replaces any older parked one, since only the newest state matters.
+// Other messages are dropped and counted. A parked snapshot is queued before
+// anything newer so the client never sees state go backwards.
+func (ws *WebSocketService) enqueue(client *models.Client, message, snapshot *wireMessage) {
+	data, err := message.encoded(client.Encoding)
+	if err != nil {
+		log.Printf("Error encoding message as %s: %v", client.Encoding, err)
+		return
+	}
+
+	out := &client.Out
+	out.Mu.Lock()
+	defer out.Mu.Unlock()
+
+	if out.CloseCode != 0 {
+		return
+	}
+	if out.State != nil {
+		select {
+		case client.Send <- out.State:
+			out.State = nil
+		default:
+		}
+	}
+	if out.State == nil {
+		select {
+		case client.Send <- data:
+			return
+		default:
+		}
+	}
+
+	if snapshot != nil {
+		if state, err := snapshot.encoded(client.Encoding); err == nil {
+			out.State = state
+			select {
+			case out.Wake <- struct{}{}:
+			default:
+			}
+			return
+		}
+	}
+
+	out.Dropped++
+	if ws.opts.MaxDropped > 0 && out.Dropped >= ws.opts.MaxDropped {
+		log.Printf("Client %s dropped %d messages, disconnecting", client.IP, out.Dropped)
+		kick(out, CloseSlowConsumer)
+	}
+}
+
+// disconnect makes the client's write loop close the connection with code
+// once what is already queued has been written
+func (ws *WebSocketService) disconnect(client *models.Client, code int) {
+	client.Out.Mu.Lock()
+	defer client.Out.Mu.Unlock()
+	kick(&client.Out, code)
+}
+
+// kick sets the close code and wakes the write loop; the caller holds Mu
+func kick(out *models.Outbound, code int) {
+	if out.CloseCode == 0 {
+		out.CloseCode = code
+		close(out.Kick)
+	}
+}
+
+// PendingState hands the write loop the parked state snapshot once
+// everything queued before it has been written; nil if there is none
+func PendingState(client *models.Client) []byte {
+	out := &client.Out
+	out.Mu.Lock()
+	defer out.Mu.Unlock()
+	if len(client.Send) > 0 {
+		return nil
+	}
+	state := out.State
+	out.State = nil
+	return state
+}
+
+// CloseCode returns the code the write loop closes the connection with
+// after Kick is closed
+func CloseCode(client *models.Client) int {
+	client.Out.Mu.Lock()
+	defer client.Out.Mu.Unlock()
+	return client.Out.CloseCode
+}
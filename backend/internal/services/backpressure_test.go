@@ -0,0 +1,118 @@
+package services
+
+import (
+	"testing"
+
+	"powerpoint-quiz/internal/models"
+)
+
+// slowClient returns a client whose queue holds a single message and that
+// is kicked after maxDropped dropped messages
+func slowClient(t *testing.T, maxDropped int) (*WebSocketService, *models.Client) {
+	t.Helper()
+	ws := newTestService(t)
+	ws.opts.SendBuffer = 1
+	ws.opts.MaxDropped = maxDropped
+	return ws, newTestClient(ws, "192.0.2.10")
+}
+
+// queued returns the messages in a client's queue
+func queued(client *models.Client) []string {
+	var messages []string
+	for len(client.Send) > 0 {
+		messages = append(messages, string(<-client.Send))
+	}
+	return messages
+}
+
+// A full queue parks the newest state snapshot instead of dropping it
+func TestEnqueueParksNewestSnapshot(t *testing.T) {
+	ws, client := slowClient(t, 10)
+	event := newWireMessage([]byte(`{"type":"event"}`))
+	state1 := newWireMessage([]byte(`{"type":"state","seq":1}`))
+	state2 := newWireMessage([]byte(`{"type":"state","seq":2}`))
+	patch := newWireMessage([]byte(`{"type":"state_patch","seq":2}`))
+
+	ws.enqueue(client, event, nil)
+	ws.enqueue(client, state1, state1)
+	ws.enqueue(client, patch, state2) // Replaces state1 with the snapshot of the patch
+	if client.Out.Dropped != 0 {
+		t.Errorf("dropped %d messages, want none", client.Out.Dropped)
+	}
+	select {
+	case <-client.Out.Wake:
+	default:
+		t.Error("write loop not woken for the parked state")
+	}
+	if state := PendingState(client); state != nil {
+		t.Errorf("parked state handed out before the queue was written: %s", state)
+	}
+	if got := queued(client); len(got) != 1 || got[0] != `{"type":"event"}` {
+		t.Fatalf("queue = %v", got)
+	}
+	if state := PendingState(client); string(state) != `{"type":"state","seq":2}` {
+		t.Errorf("parked state = %s, want the newest snapshot", state)
+	}
+	if state := PendingState(client); state != nil {
+		t.Errorf("parked state handed out twice: %s", state)
+	}
+}
+
+// A parked snapshot is queued before anything newer
+func TestEnqueueQueuesParkedSnapshotFirst(t *testing.T) {
+	ws, client := slowClient(t, 10)
+	state := newWireMessage([]byte(`{"type":"state"}`))
+	ws.enqueue(client, newWireMessage([]byte(`{"type":"first"}`)), nil)
+	ws.enqueue(client, state, state)
+	queued(client)
+
+	ws.enqueue(client, newWireMessage([]byte(`{"type":"later"}`)), nil)
+	if got := queued(client); len(got) != 1 || got[0] != `{"type":"state"}` {
+		t.Errorf("queue = %v, want the parked state", got)
+	}
+	if client.Out.Dropped != 1 {
+		t.Errorf("dropped %d messages, want the one behind the state", client.Out.Dropped)
+	}
+}
+
+// Other messages are dropped, and a client that keeps missing them is
+// disconnected
+func TestEnqueueDropsAndKicks(t *testing.T) {
+	ws, client := slowClient(t, 3)
+	for i := 0; i < 3; i++ {
+		ws.enqueue(client, newWireMessage([]byte(`{"type":"event"}`)), nil)
+		if CloseCode(client) != 0 {
+			t.Fatalf("kicked after %d dropped messages", client.Out.Dropped)
+		}
+	}
+	ws.enqueue(client, newWireMessage([]byte(`{"type":"event"}`)), nil)
+	if client.Out.Dropped != 3 {
+		t.Errorf("dropped %d messages, want 3", client.Out.Dropped)
+	}
+	if code := CloseCode(client); code != CloseSlowConsumer {
+		t.Fatalf("close code = %d, want %d", code, CloseSlowConsumer)
+	}
+	select {
+	case <-client.Out.Kick:
+	default:
+		t.Error("write loop not kicked")
+	}
+
+	// Nothing is queued for a client on its way out
+	queued(client)
+	ws.enqueue(client, newWireMessage([]byte(`{"type":"event"}`)), nil)
+	if len(client.Send) != 0 {
+		t.Error("message queued after the kick")
+	}
+}
+
+// Without MaxDropped a slow client is never kicked
+func TestEnqueueWithoutMaxDropped(t *testing.T) {
+	ws, client := slowClient(t, 0)
+	for i := 0; i < 100; i++ {
+		ws.enqueue(client, newWireMessage([]byte(`{"type":"event"}`)), nil)
+	}
+	if CloseCode(client) != 0 || client.Out.Dropped != 99 {
+		t.Errorf("close code %d after %d dropped messages", CloseCode(client), client.Out.Dropped)
+	}
+}
@@ -0,0 +1,308 @@
+package services
+
+import (
+	"log"
+	"sort"
+	"time"
+
+	"powerpoint-quiz/internal/models"
+)
+
+// maxClockSamples bounds the clock sync samples kept per connection
+const maxClockSamples = 16
+
+// startClockSync begins a clock sync round with a client
+func (ws *WebSocketService) startClockSync(client *models.Client) {
+	client.Clock.Pending = ws.opts.ClockSyncSamples
+	ws.sendClockPing(client)
+}
+
+func (ws *WebSocketService) sendClockPing(client *models.Client) {
+	if client.Clock.Pending <= 0 {
+		return
+	}
+	client.Clock.Pending--
+	pingEvent := models.Event{
+		Type:     models.EventClockPing,
+		TsServer: time.Now().UnixMilli(),
+	}
+	ws.sendEventToClient(client, pingEvent)
+}
+
+// handleClockSync lets a client ask for a new clock sync round
+func (ws *WebSocketService) handleClockSync(client *models.Client, event models.Event) error {
+	ws.startClockSync(client)
+	return nil
+}
+
+// handleClockPong records a ping/pong sample: the client echoes the server
+// time of the ping and adds its own clock reading when it received it
+func (ws *WebSocketService) handleClockPong(client *models.Client, event models.Event) error {
+	now := time.Now().UnixMilli()
+	if event.TsServer <= 0 || event.TsServer > now || event.TsClient <= 0 {
+		log.Printf("Ignoring invalid clock pong from %s", client.UserID)
+		return refuseQuietly(models.ErrCodeInvalidArgument, "Invalid clock pong")
+	}
+
+	rtt := now - event.TsServer
+	sample := models.ClockSample{
+		RTTMs:    rtt,
+		OffsetMs: event.TsClient - (event.TsServer + rtt/2),
+		At:       now,
+	}
+	clock := &client.Clock
+	clock.Samples = append(clock.Samples, sample)
+	if len(clock.Samples) > maxClockSamples {
+		clock.Samples = clock.Samples[len(clock.Samples)-maxClockSamples:]
+	}
+
+	// The sample with the smallest round trip has the least asymmetry error
+	best := clock.Samples[0]
+	for _, s := range clock.Samples[1:] {
+		if s.RTTMs < best.RTTMs {
+			best = s
+		}
+	}
+	clock.OffsetMs = best.OffsetMs
+	clock.RTTMs = best.RTTMs
+	clock.Synced = true
+
+	ws.sendClockPing(client)
+	return nil
+}
+
+// canBuzz reports whether a player's buzz counts for the current question:
+// either nobody is answering yet, or someone is and the player can queue up
+// behind them. Players who already had their turn stay out.
+func canBuzz(room *models.Room, userID string) bool {
+	if room.Phase != models.PhaseActive || !isBuzzerQuestion(room) {
+		return false
+	}
+	if !room.QuestionActive && room.FirstAnswerer == "" {
+		return false
+	}
+	return userID != room.FirstAnswerer &&
+		!containsString(room.BuzzQueue, userID) &&
+		!containsString(room.LockedOut, userID)
+}
+
+// isBuzzerQuestion reports whether the current question is answered by
+// buzzing. Multiple-choice questions are answered with submit_answer.
+func isBuzzerQuestion(room *models.Room) bool {
+	q := currentQuizQuestion(room)
+	return q == nil || q.Type != models.QuestionMultipleChoice
+}
+
+// acceptBuzz handles a valid buzz for the current question. While someone is
+// answering the buzz joins the queue. Without an adjudication window the
+// first arrival wins at once; otherwise every buzz arriving within the window
+// after the first is ranked by corrected client time when the window closes.
+func (ws *WebSocketService) acceptBuzz(client *models.Client, room *models.Room, entry models.HistoryEntry) {
+	candidate := &models.BuzzCandidate{
+		UserID:    entry.Event.UserID,
+		ArrivalMs: entry.Timestamp.UnixMilli(),
+		TsClient:  entry.Event.TsClient,
+	}
+	if client.Clock.Synced {
+		candidate.Synced = true
+		candidate.OffsetMs = client.Clock.OffsetMs
+		candidate.RTTMs = client.Clock.RTTMs
+	}
+
+	if room.FirstAnswerer != "" {
+		rankBuzzes([]*models.BuzzCandidate{candidate}, 0)
+		ws.queueBuzz(room, candidate.UserID, reactionMs(room, candidate))
+		ws.broadcastRoomState(room)
+		return
+	}
+
+	if ws.opts.BuzzWindow <= 0 {
+		ws.decideBuzz(room, []*models.BuzzCandidate{candidate})
+		return
+	}
+
+	for _, pending := range room.PendingBuzzes {
+		if pending.UserID == candidate.UserID {
+			return // Only a player's first buzz counts
+		}
+	}
+	room.PendingBuzzes = append(room.PendingBuzzes, candidate)
+	if len(room.PendingBuzzes) > 1 {
+		return
+	}
+
+	questionSeq := room.QuestionSeq
+	time.AfterFunc(ws.opts.BuzzWindow, func() {
+		ws.post(room.Code, func(a *roomActor) {
+			if room.QuestionSeq == questionSeq && room.FirstAnswerer == "" && len(room.PendingBuzzes) > 0 {
+				ws.decideBuzz(room, room.PendingBuzzes)
+				ws.saveRoom(room)
+			}
+		})
+	})
+}
+
+// decideBuzz ranks the candidates, records the winner and tells the hosts
+// why
+func (ws *WebSocketService) decideBuzz(room *models.Room, candidates []*models.BuzzCandidate) {
+	decision := rankBuzzes(candidates, ws.opts.BuzzWindow)
+	decision.QuestionSeq = room.QuestionSeq
+	room.PendingBuzzes = nil
+
+	ws.commit(room, "system", models.Event{
+		Type:       models.EventBuzzDecision,
+		UserID:     decision.Winner,
+		ReactionMs: reactionMs(room, decision.Candidates[0]),
+		Data:       decision,
+	})
+	log.Printf("First answer received from player %s (%s)", decision.Winner, decision.Reason)
+
+	// Everyone else in the window waits in ranked order
+	for _, c := range decision.Candidates[1:] {
+		ws.queueBuzz(room, c.UserID, reactionMs(room, c))
+	}
+
+	// Stop the clock while the player answers
+	ws.pauseTimer(room, TimerQuestion)
+
+	decisionEvent := models.Event{
+		Type:   models.EventBuzzDecision,
+		UserID: decision.Winner,
+		Data:   decision,
+	}
+	ws.sendEventToHosts(room, decisionEvent)
+	ws.broadcastRoomState(room)
+}
+
+// rankBuzzes orders buzzes by corrected press time. A client timestamp is
+// only trusted once the client's clock offset is known, and is clamped to
+// the interval the press can physically have happened in: no later than
+// arrival and no earlier than arrival minus the measured round trip.
+func rankBuzzes(candidates []*models.BuzzCandidate, window time.Duration) *models.BuzzDecision {
+	for _, c := range candidates {
+		c.CorrectedMs = c.ArrivalMs
+		switch {
+		case !c.Synced:
+			c.Note = "no clock sync, using arrival time"
+		case c.TsClient <= 0:
+			c.Note = "no client timestamp, using arrival time"
+		default:
+			corrected := c.TsClient - c.OffsetMs
+			switch {
+			case corrected > c.ArrivalMs:
+				c.Note = "corrected time after arrival, clamped to arrival"
+			case corrected < c.ArrivalMs-c.RTTMs:
+				c.CorrectedMs = c.ArrivalMs - c.RTTMs
+				c.Note = "corrected time before possible send, clamped to arrival minus RTT"
+			default:
+				c.CorrectedMs = corrected
+				c.Note = "corrected client time"
+			}
+		}
+	}
+
+	ranked := append([]*models.BuzzCandidate(nil), candidates...)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].CorrectedMs != ranked[j].CorrectedMs {
+			return ranked[i].CorrectedMs < ranked[j].CorrectedMs
+		}
+		return ranked[i].ArrivalMs < ranked[j].ArrivalMs
+	})
+
+	decision := &models.BuzzDecision{
+		Winner:     ranked[0].UserID,
+		WindowMs:   window.Milliseconds(),
+		Candidates: ranked,
+		Reason:     "only buzz in window",
+	}
+	if len(ranked) > 1 {
+		decision.Reason = "earliest corrected press time"
+		if ranked[0].CorrectedMs == ranked[1].CorrectedMs {
+			decision.Reason = "tie on corrected time, earliest arrival"
+		}
+	}
+	return decision
+}
+
+// queueBuzz puts a player at the end of the buzzer queue
+func (ws *WebSocketService) queueBuzz(room *models.Room, userID string, reaction int64) {
+	ws.commit(room, "system", models.Event{
+		Type:       models.EventBuzzQueued,
+		UserID:     userID,
+		ReactionMs: reaction,
+	})
+	log.Printf("Player %s queued in room %s (position %d)", userID, room.Code, len(room.BuzzQueue))
+}
+
+// passTurn handles a wrong answer: the answerer (and with excludeTeam their
+// teammates) is locked out and the turn goes to the next queued player who is
+// still connected; disconnected players passed over lose their place. With
+// an empty queue the question opens again for buzzing. Called from applyEvent.
+func passTurn(room *models.Room, userID string, excludeTeam bool) {
+	lockedOut := []string{userID}
+	if excludeTeam {
+		if team := findPlayerTeam(room, userID); team != nil {
+			lockedOut = append(lockedOut, team.Players...)
+		}
+	}
+	for _, id := range lockedOut {
+		if !containsString(room.LockedOut, id) {
+			room.LockedOut = append(room.LockedOut, id)
+		}
+	}
+
+	var queue []string
+	for _, id := range room.BuzzQueue {
+		if !containsString(room.LockedOut, id) {
+			queue = append(queue, id)
+		}
+	}
+
+	for len(queue) > 0 {
+		if player, ok := room.Players[queue[0]]; ok && player.Connected && !player.Left {
+			break
+		}
+		queue = queue[1:]
+	}
+
+	room.FirstAnswerer = ""
+	room.QuestionActive = false
+	if len(queue) > 0 {
+		room.FirstAnswerer = queue[0]
+		queue = queue[1:]
+	} else {
+		room.QuestionActive = room.Phase == models.PhaseActive
+	}
+	room.BuzzQueue = queue
+}
+
+// reactionMs is the time from the question start to a ranked buzz, or 0 when
+// the question start is unknown
+func reactionMs(room *models.Room, c *models.BuzzCandidate) int64 {
+	if room.QuestionStartTime.IsZero() {
+		return 0
+	}
+	if d := c.CorrectedMs - room.QuestionStartTime.UnixMilli(); d > 0 {
+		return d
+	}
+	return 0
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func removeString(list []string, s string) []string {
+	var out []string
+	for _, v := range list {
+		if v != s {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,327 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"powerpoint-quiz/internal/models"
+)
+
+func choiceQuiz() *models.Quiz {
+	return &models.Quiz{
+		Title: "Test",
+		Questions: []models.Question{
+			{
+				ID:            "q1",
+				Text:          "Capital of France?",
+				Type:          models.QuestionMultipleChoice,
+				Options:       []models.QuestionOption{{ID: "A", Text: "Berlin"}, {ID: "B", Text: "Paris"}},
+				CorrectAnswer: "B",
+				Points:        5,
+			},
+			{ID: "q2", Text: "Who?", Type: models.QuestionBuzzer, Points: 3},
+		},
+	}
+}
+
+func TestCanBuzz(t *testing.T) {
+	quiz := choiceQuiz()
+	tests := []struct {
+		name  string
+		room  models.Room
+		user  string
+		allow bool
+	}{
+		{"buzzer question", models.Room{Phase: models.PhaseActive, QuestionActive: true}, "u1", true},
+		{"not active", models.Room{Phase: models.PhaseStarted, QuestionActive: true}, "u1", false},
+		{"no question", models.Room{Phase: models.PhaseActive}, "u1", false},
+		{"already answering", models.Room{Phase: models.PhaseActive, QuestionActive: true, FirstAnswerer: "u1"}, "u1", false},
+		{"queued", models.Room{Phase: models.PhaseActive, FirstAnswerer: "u2", BuzzQueue: []string{"u1"}}, "u1", false},
+		{"locked out", models.Room{Phase: models.PhaseActive, QuestionActive: true, LockedOut: []string{"u1"}}, "u1", false},
+		{"multiple choice", models.Room{Phase: models.PhaseActive, QuestionActive: true, Quiz: quiz,
+			CurrentQuestion: &models.Question{ID: "q1"}}, "u1", false},
+		{"quiz buzzer question", models.Room{Phase: models.PhaseActive, QuestionActive: true, Quiz: quiz,
+			QuestionIndex: 1, CurrentQuestion: &models.Question{ID: "q2"}}, "u1", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := canBuzz(&tt.room, tt.user); got != tt.allow {
+				t.Errorf("canBuzz = %v, want %v", got, tt.allow)
+			}
+		})
+	}
+}
+
+// A buzz during a multiple-choice question must not stop answering, and the
+// question's time running out locks and grades the answers
+func TestMultipleChoiceIgnoresBuzzes(t *testing.T) {
+	ws := newTestService(t)
+	admin := newTestClient(ws, "192.0.2.1")
+	code := createTestRoom(t, ws, admin, choiceQuiz())
+	player := joinTestPlayer(t, ws, code, "u1")
+
+	for _, event := range []models.Event{
+		{Type: models.EventHostSetState, Phase: models.PhaseActive},
+		{Type: models.EventStartQuestion},
+	} {
+		if err := dispatch(t, ws, admin, code, event); err != nil {
+			t.Fatalf("%s: %v", event.Type, err)
+		}
+	}
+
+	err := dispatch(t, ws, player, code, models.Event{Type: models.EventClick})
+	if got := refusalCode(err); got != models.ErrCodeInvalidState {
+		t.Fatalf("click during multiple choice: got %q, want %q", got, models.ErrCodeInvalidState)
+	}
+	if err := dispatch(t, ws, player, code, models.Event{Type: models.EventSubmitAnswer, OptionID: "B"}); err != nil {
+		t.Fatalf("submit_answer after a click: %v", err)
+	}
+
+	drain(t, player)
+	onRoom(t, ws, code, func(room *models.Room) {
+		room.QuestionActive = false // As after a buzz decision
+		ws.timeUp(room)
+		if !room.AnswersLocked {
+			t.Error("time up left the answers open")
+		}
+		if score := room.Players["u1"].Score; score != 5 {
+			t.Errorf("score = %d, want 5", score)
+		}
+	})
+	if _, ok := received(t, player, models.EventAnswerResults); !ok {
+		t.Error("no answer_results after time up")
+	}
+}
+
+func TestRankBuzzes(t *testing.T) {
+	synced := func(user string, arrival, tsClient, offset, rtt int64) *models.BuzzCandidate {
+		return &models.BuzzCandidate{UserID: user, ArrivalMs: arrival, TsClient: tsClient, OffsetMs: offset, RTTMs: rtt, Synced: true}
+	}
+
+	tests := []struct {
+		name       string
+		candidates []*models.BuzzCandidate
+		wantOrder  []string
+		wantTimes  []int64 // Corrected times in ranked order
+		wantReason string
+	}{
+		{
+			name:       "single buzz",
+			candidates: []*models.BuzzCandidate{synced("u1", 1000, 900, 0, 200)},
+			wantOrder:  []string{"u1"},
+			wantTimes:  []int64{900},
+			wantReason: "only buzz in window",
+		},
+		{
+			name: "earlier press beats earlier arrival",
+			candidates: []*models.BuzzCandidate{
+				synced("u1", 1000, 990, 0, 50),
+				synced("u2", 1040, 1040-80, 0, 100),
+			},
+			wantOrder:  []string{"u2", "u1"},
+			wantTimes:  []int64{960, 990},
+			wantReason: "earliest corrected press time",
+		},
+		{
+			name: "offset applied",
+			candidates: []*models.BuzzCandidate{
+				synced("u1", 1000, 5990, 5000, 50), // Clock 5 s ahead
+				synced("u2", 1010, 980, -20, 100),  // Clock 20 ms behind
+			},
+			wantOrder:  []string{"u1", "u2"},
+			wantTimes:  []int64{990, 1000},
+			wantReason: "earliest corrected press time",
+		},
+		{
+			name: "unsynced clients rank by arrival",
+			candidates: []*models.BuzzCandidate{
+				{UserID: "u1", ArrivalMs: 1020, TsClient: 1},
+				synced("u2", 1010, 0, 0, 100),
+			},
+			wantOrder:  []string{"u2", "u1"},
+			wantTimes:  []int64{1010, 1020},
+			wantReason: "earliest corrected press time",
+		},
+		{
+			name: "press after arrival clamped to arrival",
+			candidates: []*models.BuzzCandidate{
+				synced("u1", 1000, 1500, 0, 100),
+				synced("u2", 1005, 1000, 0, 100),
+			},
+			wantOrder:  []string{"u1", "u2"}, // Tied on 1000, u1 arrived first
+			wantTimes:  []int64{1000, 1000},
+			wantReason: "tie on corrected time, earliest arrival",
+		},
+		{
+			name: "implausibly early press clamped to arrival minus RTT",
+			candidates: []*models.BuzzCandidate{
+				synced("u1", 1000, 1, 0, 100),
+				synced("u2", 1001, 950, 0, 100),
+			},
+			wantOrder:  []string{"u1", "u2"},
+			wantTimes:  []int64{900, 950},
+			wantReason: "earliest corrected press time",
+		},
+		{
+			name: "negative client time means none",
+			candidates: []*models.BuzzCandidate{
+				synced("u1", 1000, -5000, 0, 100),
+				synced("u2", 1030, 990, 0, 100),
+			},
+			wantOrder:  []string{"u2", "u1"},
+			wantTimes:  []int64{990, 1000},
+			wantReason: "earliest corrected press time",
+		},
+		{
+			name: "tie on arrival keeps the order received",
+			candidates: []*models.BuzzCandidate{
+				{UserID: "u1", ArrivalMs: 1000},
+				{UserID: "u2", ArrivalMs: 1000},
+			},
+			wantOrder:  []string{"u1", "u2"},
+			wantTimes:  []int64{1000, 1000},
+			wantReason: "tie on corrected time, earliest arrival",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision := rankBuzzes(tt.candidates, 100*time.Millisecond)
+			var order []string
+			var times []int64
+			for _, c := range decision.Candidates {
+				order = append(order, c.UserID)
+				times = append(times, c.CorrectedMs)
+				if c.Note == "" {
+					t.Errorf("%s ranked without a note", c.UserID)
+				}
+			}
+			if !reflect.DeepEqual(order, tt.wantOrder) || !reflect.DeepEqual(times, tt.wantTimes) {
+				t.Errorf("ranked %v at %v, want %v at %v", order, times, tt.wantOrder, tt.wantTimes)
+			}
+			if decision.Winner != tt.wantOrder[0] || decision.Reason != tt.wantReason || decision.WindowMs != 100 {
+				t.Errorf("decision = %+v", decision)
+			}
+		})
+	}
+}
+
+// Buzzes within the window after the first are ranked by press time; a
+// buzz after the window closed joins the queue
+func TestBuzzWindow(t *testing.T) {
+	ws := newTestService(t)
+	ws.opts.BuzzWindow = 50 * time.Millisecond
+	admin := newTestClient(ws, "192.0.2.1")
+	code := createTestRoom(t, ws, admin, nil)
+	players := make(map[string]*models.Client)
+	for _, id := range []string{"u1", "u2", "u3"} {
+		players[id] = joinTestPlayer(t, ws, code, id)
+		players[id].Clock = models.ClockSync{Synced: true, RTTMs: 1000}
+	}
+	for _, event := range []models.Event{
+		{Type: models.EventHostSetState, Phase: models.PhaseActive},
+		{Type: models.EventStartQuestion},
+	} {
+		if err := dispatch(t, ws, admin, code, event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := time.Now().UnixMilli()
+	dispatch(t, ws, players["u1"], code, models.Event{Type: models.EventClick, TsClient: now})
+	// Arrives later but was pressed earlier
+	dispatch(t, ws, players["u2"], code, models.Event{Type: models.EventClick, TsClient: now - 300})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		var answerer string
+		onRoom(t, ws, code, func(room *models.Room) { answerer = room.FirstAnswerer })
+		if answerer != "" {
+			if answerer != "u2" {
+				t.Fatalf("first answerer = %s, want u2", answerer)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("buzz window never closed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	dispatch(t, ws, players["u3"], code, models.Event{Type: models.EventClick, TsClient: now - 900})
+	onRoom(t, ws, code, func(room *models.Room) {
+		if !reflect.DeepEqual(room.BuzzQueue, []string{"u1", "u3"}) {
+			t.Errorf("queue = %v, want [u1 u3]", room.BuzzQueue)
+		}
+		if len(room.PendingBuzzes) != 0 {
+			t.Errorf("%d buzzes still pending", len(room.PendingBuzzes))
+		}
+	})
+}
+
+func TestPassTurn(t *testing.T) {
+	// turnRoom has u1 answering in the active phase; u2 and u3 are team t1,
+	// u4 and u5 have no team, u5 disconnected and u6 left
+	turnRoom := func(queue ...string) *models.Room {
+		room := &models.Room{
+			Phase:         models.PhaseActive,
+			FirstAnswerer: "u1",
+			BuzzQueue:     queue,
+			Players:       make(map[string]*models.Player),
+			Teams: map[string]*models.Team{
+				"t1": {ID: "t1", Players: []string{"u1", "u2", "u3"}},
+			},
+		}
+		for _, id := range []string{"u1", "u2", "u3", "u4", "u5", "u6"} {
+			room.Players[id] = &models.Player{ID: id, UserID: id, Connected: true}
+		}
+		room.Players["u5"].Connected = false
+		room.Players["u6"].Connected = false
+		room.Players["u6"].Left = true
+		return room
+	}
+
+	tests := []struct {
+		name        string
+		room        *models.Room
+		excludeTeam bool
+		wantNext    string
+		wantQueue   []string
+		wantLocked  []string
+		wantActive  bool
+	}{
+		{"next queued player", turnRoom("u2", "u4"), false, "u2", []string{"u4"}, []string{"u1"}, false},
+		{"locked-out players are skipped", func() *models.Room {
+			room := turnRoom("u2", "u4")
+			room.LockedOut = []string{"u2"}
+			return room
+		}(), false, "u4", nil, []string{"u2", "u1"}, false},
+		{"disconnected players are skipped", turnRoom("u5", "u6", "u4", "u2"), false, "u4", []string{"u2"}, []string{"u1"}, false},
+		{"disconnected players later in the queue keep their place", turnRoom("u4", "u5"), false, "u4", []string{"u5"}, []string{"u1"}, false},
+		{"team excluded", turnRoom("u2", "u3", "u4"), true, "u4", nil, []string{"u1", "u2", "u3"}, false},
+		{"empty queue reopens buzzing", turnRoom(), false, "", nil, []string{"u1"}, true},
+		{"only disconnected players queued", turnRoom("u5", "u6"), false, "", nil, []string{"u1"}, true},
+		{"empty queue outside the active phase ends the question", func() *models.Room {
+			room := turnRoom()
+			room.Phase = models.PhaseFinished
+			return room
+		}(), false, "", nil, []string{"u1"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			room := tt.room
+			passTurn(room, "u1", tt.excludeTeam)
+			if room.FirstAnswerer != tt.wantNext || room.QuestionActive != tt.wantActive {
+				t.Errorf("answerer %q, active %v; want %q, %v", room.FirstAnswerer, room.QuestionActive, tt.wantNext, tt.wantActive)
+			}
+			if (len(room.BuzzQueue) > 0 || len(tt.wantQueue) > 0) && !reflect.DeepEqual(room.BuzzQueue, tt.wantQueue) {
+				t.Errorf("queue = %v, want %v", room.BuzzQueue, tt.wantQueue)
+			}
+			if !reflect.DeepEqual(room.LockedOut, tt.wantLocked) {
+				t.Errorf("locked out = %v, want %v", room.LockedOut, tt.wantLocked)
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package services
+
+import (
+	"log"
+	"sort"
+
+	"powerpoint-quiz/internal/models"
+)
+
+// defaultPoints is awarded for a correct answer when neither the host nor
+// the question says otherwise
+const defaultPoints = 10
+
+// questionPoints returns the points a correct answer to a question is worth
+func questionPoints(q *models.Question) int {
+	if q.Points > 0 {
+		return q.Points
+	}
+	return defaultPoints
+}
+
+// findPlayerTeam returns the team a player belongs to, or nil
+func findPlayerTeam(room *models.Room, userID string) *models.Team {
+	for _, team := range room.Teams {
+		for _, playerID := range team.Players {
+			if playerID == userID {
+				return team
+			}
+		}
+	}
+	return nil
+}
+
+// answerMode returns how the room's quiz collects multiple-choice answers
+func answerMode(room *models.Room) models.AnswerMode {
+	if room.Quiz != nil && room.Quiz.AnswerMode == models.AnswerModeTeam {
+		return models.AnswerModeTeam
+	}
+	return models.AnswerModePlayer
+}
+
+// handleSubmitAnswer records a multiple-choice answer from a player. Players
+// (or teams) may change their answer until the answers are locked.
+func (ws *WebSocketService) handleSubmitAnswer(client *models.Client, room *models.Room, event models.Event) error {
+	question := currentQuizQuestion(room)
+	if question == nil || question.Type != models.QuestionMultipleChoice {
+		return refuse(models.ErrCodeInvalidState, "No multiple-choice question is running")
+	}
+	if room.Phase != models.PhaseActive || !room.QuestionActive || room.AnswersLocked {
+		return refuse(models.ErrCodeInvalidState, "Answers are not being accepted")
+	}
+
+	player, err := joinedPlayer(client, room)
+	if err != nil {
+		return err
+	}
+	userID := player.UserID
+
+	option := findOption(question, event.OptionID)
+	if option == nil {
+		return refuse(models.ErrCodeInvalidArgument, "Unknown option")
+	}
+
+	submitted := models.Event{
+		Type:       models.EventSubmitAnswer,
+		UserID:     userID,
+		OptionID:   option.ID,
+		QuestionID: question.ID,
+	}
+	if answerMode(room) == models.AnswerModeTeam {
+		team := findPlayerTeam(room, userID)
+		if team == nil {
+			return refuse(models.ErrCodeInvalidState, "Join a team to answer")
+		}
+		submitted.TeamID = team.ID
+	}
+
+	ws.commit(room, client.Role, submitted)
+	log.Printf("Player %s answered %s in room %s", userID, option.ID, room.Code)
+
+	acceptedEvent := models.Event{
+		Type:       models.EventAnswerAccepted,
+		UserID:     userID,
+		TeamID:     submitted.TeamID,
+		OptionID:   option.ID,
+		QuestionID: question.ID,
+	}
+	ws.sendEventToClient(client, acceptedEvent)
+	ws.broadcastRoomState(room)
+	return nil
+}
+
+// handleLockAnswers lets the host close answering before the time limit
+func (ws *WebSocketService) handleLockAnswers(client *models.Client, room *models.Room, event models.Event) error {
+	question := currentQuizQuestion(room)
+	if question == nil || question.Type != models.QuestionMultipleChoice || room.AnswersLocked {
+		return refuse(models.ErrCodeInvalidState, "No open multiple-choice question")
+	}
+
+	ws.cancelTimer(room, TimerQuestion)
+	ws.lockAnswers(room, client.Role)
+	return nil
+}
+
+// lockAnswers closes answering, grades the answers, awards points and
+// broadcasts the distribution
+func (ws *WebSocketService) lockAnswers(room *models.Room, role string) {
+	question := currentQuizQuestion(room)
+	if question == nil {
+		return
+	}
+
+	ws.commit(room, role, models.Event{
+		Type:       models.EventLockAnswers,
+		QuestionID: question.ID,
+	})
+
+	results := answerResults(room, question)
+	log.Printf("Answers locked in room %s: %d answers, %d correct", room.Code, results.Total, len(results.Correct))
+
+	resultsEvent := models.Event{
+		Type:          models.EventAnswerResults,
+		QuestionID:    question.ID,
+		CorrectAnswer: question.CorrectAnswer,
+		Points:        results.Points,
+		Data:          results,
+	}
+	ws.broadcastToRoom(room, resultsEvent)
+	ws.broadcastLeaderboard(room)
+	ws.broadcastRoomState(room)
+}
+
+// applyLockAnswers grades the submitted answers and awards points to the
+// answering players and their teams. Called from applyEvent.
+func applyLockAnswers(room *models.Room, entry models.HistoryEntry) {
+	room.AnswersLocked = true
+	room.QuestionActive = false
+
+	question := currentQuizQuestion(room)
+	if question == nil {
+		return
+	}
+	room.CorrectAnswer = question.CorrectAnswer
+
+	// Score in a fixed order so that streaks never depend on map iteration
+	action := newScoreAction(entry)
+	keys := make([]string, 0, len(room.Answers))
+	for key := range room.Answers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		answer := room.Answers[key]
+		player := room.Players[answer.UserID]
+		var reaction int64
+		if !room.QuestionStartTime.IsZero() {
+			reaction = answer.At.Sub(room.QuestionStartTime).Milliseconds()
+			recordReaction(player, reaction)
+		}
+		correct := answer.OptionID == question.CorrectAnswer
+		team, ok := room.Teams[answer.TeamID]
+		if !ok {
+			team = findPlayerTeam(room, answer.UserID)
+		}
+		points := scoreAnswer(room, player, correct, 0, reaction)
+		applyScore(room, action, player, team, correct, points)
+	}
+	logScoreAction(room, action)
+}
+
+// answerResults summarises the answers to the current question
+func answerResults(room *models.Room, question *models.Question) *models.AnswerResults {
+	results := &models.AnswerResults{
+		QuestionID:    question.ID,
+		CorrectAnswer: question.CorrectAnswer,
+		Distribution:  make(map[string]int, len(question.Options)),
+		Correct:       []string{},
+		Points:        questionPoints(question),
+	}
+	for _, opt := range question.Options {
+		results.Distribution[opt.ID] = 0
+	}
+	for key, answer := range room.Answers {
+		results.Distribution[answer.OptionID]++
+		results.Total++
+		if answer.OptionID == question.CorrectAnswer {
+			results.Correct = append(results.Correct, key)
+		}
+	}
+	sort.Strings(results.Correct)
+	return results
+}
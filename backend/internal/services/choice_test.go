@@ -0,0 +1,137 @@
+package services
+
+import (
+	"testing"
+
+	"powerpoint-quiz/internal/models"
+)
+
+// teamChoiceRoom starts the multiple-choice question of a team quiz with
+// u1 and u2 in team t1, u3 in team t2 and u4 in no team
+func teamChoiceRoom(t *testing.T) (*WebSocketService, string, *models.Client, map[string]*models.Client) {
+	t.Helper()
+	ws := newTestService(t)
+	admin := newTestClient(ws, "192.0.2.1")
+	quiz := choiceQuiz()
+	quiz.AnswerMode = models.AnswerModeTeam
+	code := createTestRoom(t, ws, admin, quiz)
+
+	players := make(map[string]*models.Client)
+	for _, id := range []string{"u1", "u2", "u3", "u4"} {
+		players[id] = joinTestPlayer(t, ws, code, id)
+	}
+	onRoom(t, ws, code, func(room *models.Room) {
+		ws.commit(room, "admin", models.Event{Type: models.EventCreateTeam, TeamID: "t1", TeamName: "Red"})
+		ws.commit(room, "admin", models.Event{Type: models.EventCreateTeam, TeamID: "t2", TeamName: "Blue"})
+	})
+	for id, team := range map[string]string{"u1": "t1", "u2": "t1", "u3": "t2"} {
+		if err := dispatch(t, ws, players[id], code, models.Event{Type: models.EventJoinTeam, TeamID: team}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, event := range []models.Event{
+		{Type: models.EventHostSetState, Phase: models.PhaseActive},
+		{Type: models.EventStartQuestion, QuestionID: "q1"},
+	} {
+		if err := dispatch(t, ws, admin, code, event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return ws, code, admin, players
+}
+
+// In team mode a team has one answer: whoever of it submitted last decides
+func TestTeamAnswerLatestSubmissionCounts(t *testing.T) {
+	tests := []struct {
+		name        string
+		submissions [][2]string // Player and option, in order
+		wantAnswer  string      // Answer of t1 when locked
+		wantBy      string
+		wantScores  map[string]int
+	}{
+		{
+			name:        "teammate corrects the answer",
+			submissions: [][2]string{{"u1", "A"}, {"u2", "B"}, {"u3", "A"}},
+			wantAnswer:  "B",
+			wantBy:      "u2",
+			wantScores:  map[string]int{"t1": 5, "t2": 0, "u1": 0, "u2": 5, "u3": 0},
+		},
+		{
+			name:        "teammate overrides a correct answer",
+			submissions: [][2]string{{"u1", "B"}, {"u2", "A"}, {"u3", "B"}},
+			wantAnswer:  "A",
+			wantBy:      "u2",
+			wantScores:  map[string]int{"t1": 0, "t2": 5, "u1": 0, "u2": 0, "u3": 5},
+		},
+		{
+			name:        "same player changes their mind",
+			submissions: [][2]string{{"u1", "A"}, {"u1", "B"}},
+			wantAnswer:  "B",
+			wantBy:      "u1",
+			wantScores:  map[string]int{"t1": 5, "t2": 0, "u1": 5, "u2": 0, "u3": 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws, code, admin, players := teamChoiceRoom(t)
+			for _, s := range tt.submissions {
+				if err := dispatch(t, ws, players[s[0]], code, models.Event{Type: models.EventSubmitAnswer, OptionID: s[1]}); err != nil {
+					t.Fatalf("%s answering %s: %v", s[0], s[1], err)
+				}
+			}
+			onRoom(t, ws, code, func(room *models.Room) {
+				answer := room.Answers["t1"]
+				if answer == nil || answer.OptionID != tt.wantAnswer || answer.UserID != tt.wantBy {
+					t.Errorf("t1 answer = %+v, want %s by %s", answer, tt.wantAnswer, tt.wantBy)
+				}
+				if room.AnswerCount != len(room.Answers) {
+					t.Errorf("answer count %d for %d teams", room.AnswerCount, len(room.Answers))
+				}
+			})
+
+			if err := dispatch(t, ws, admin, code, models.Event{Type: models.EventLockAnswers}); err != nil {
+				t.Fatal(err)
+			}
+			onRoom(t, ws, code, func(room *models.Room) {
+				for id, want := range tt.wantScores {
+					got := 0
+					if team, ok := room.Teams[id]; ok {
+						got = team.Score
+					} else {
+						got = room.Players[id].Score
+					}
+					if got != want {
+						t.Errorf("%s scored %d, want %d", id, got, want)
+					}
+				}
+			})
+		})
+	}
+}
+
+func TestTeamAnswerNeedsTeam(t *testing.T) {
+	ws, code, _, players := teamChoiceRoom(t)
+	err := dispatch(t, ws, players["u4"], code, models.Event{Type: models.EventSubmitAnswer, OptionID: "B"})
+	if refusalCode(err) != models.ErrCodeInvalidState {
+		t.Errorf("answer without a team: error = %v, want %s", err, models.ErrCodeInvalidState)
+	}
+}
+
+// Locked answers cannot be changed
+func TestAnswerAfterLock(t *testing.T) {
+	ws, code, admin, players := teamChoiceRoom(t)
+	dispatch(t, ws, players["u1"], code, models.Event{Type: models.EventSubmitAnswer, OptionID: "A"})
+	if err := dispatch(t, ws, admin, code, models.Event{Type: models.EventLockAnswers}); err != nil {
+		t.Fatal(err)
+	}
+	err := dispatch(t, ws, players["u2"], code, models.Event{Type: models.EventSubmitAnswer, OptionID: "B"})
+	if refusalCode(err) != models.ErrCodeInvalidState {
+		t.Errorf("answer after the lock: error = %v", err)
+	}
+	onRoom(t, ws, code, func(room *models.Room) {
+		if answer := room.Answers["t1"]; answer == nil || answer.OptionID != "A" {
+			t.Errorf("t1 answer = %+v, want the locked A", answer)
+		}
+	})
+}
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+
+	"powerpoint-quiz/internal/models"
+)
+
+// The service builds every message as JSON, so the outbox, state patches and
+// broadcasts are encoded once whatever the clients speak. A message that goes
+// to clients which negotiated MessagePack is converted once, on the first
+// send, and the same bytes go to every such client; commands they send are
+// converted back to JSON in their read loop.
+
+// wireMessage is an outbound message in each encoding it was sent in
+type wireMessage struct {
+	json    []byte
+	once    sync.Once
+	msgpack []byte
+	err     error
+}
+
+func newWireMessage(message []byte) *wireMessage {
+	return &wireMessage{json: message}
+}
+
+// encoded returns the message in an encoding, converting it on first use
+func (m *wireMessage) encoded(encoding string) ([]byte, error) {
+	if encoding != models.EncodingMsgPack {
+		return m.json, nil
+	}
+	m.once.Do(func() {
+		m.msgpack, m.err = jsonToMsgPack(m.json)
+	})
+	return m.msgpack, m.err
+}
+
+// FrameType returns the WebSocket frame type messages in an encoding are
+// sent in
+func FrameType(encoding string) int {
+	if encoding == models.EncodingMsgPack {
+		return websocket.BinaryMessage
+	}
+	return websocket.TextMessage
+}
+
+// FromWire turns a message received in an encoding into JSON
+func FromWire(encoding string, data []byte) ([]byte, error) {
+	if encoding != models.EncodingMsgPack {
+		return data, nil
+	}
+	var value interface{}
+	if err := msgpack.Unmarshal(data, &value); err != nil {
+		return nil, fmt.Errorf("invalid MessagePack: %w", err)
+	}
+	message, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("MessagePack message has no JSON form: %w", err)
+	}
+	return message, nil
+}
+
+// jsonToMsgPack converts a JSON message to MessagePack with the same fields
+func jsonToMsgPack(message []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(message))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	encoder := msgpack.NewEncoder(&buf)
+	encoder.UseCompactInts(true)
+	if err := encoder.Encode(msgpackValue(value)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// msgpackValue replaces the JSON numbers in a decoded value with integers
+// where they are whole, and floats otherwise, so they keep their type
+func msgpackValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = msgpackValue(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = msgpackValue(item)
+		}
+	}
+	return value
+}
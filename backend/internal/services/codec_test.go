@@ -0,0 +1,116 @@
+package services
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+
+	"powerpoint-quiz/internal/models"
+)
+
+func TestCodecRoundTrip(t *testing.T) {
+	events := []models.Event{
+		{Type: models.EventClick, ButtonID: "A", TsClient: 1700000000123},
+		{Type: models.EventScoreAdjust, UserID: "u1", ScoreOp: models.ScoreOpSubtract, Points: -5, Reason: "Ошибка"},
+		{Type: models.EventAck, RequestID: "r1", Seq: 42, Data: map[string]interface{}{"ratio": 0.25, "list": []interface{}{1, "x", true}}},
+	}
+	for _, encoding := range []string{models.EncodingJSON, models.EncodingMsgPack} {
+		for _, event := range events {
+			t.Run(encoding+"/"+string(event.Type), func(t *testing.T) {
+				message, err := json.Marshal(event)
+				if err != nil {
+					t.Fatal(err)
+				}
+				wire, err := newWireMessage(message).encoded(encoding)
+				if err != nil {
+					t.Fatalf("encoding: %v", err)
+				}
+				if encoding == models.EncodingMsgPack {
+					var value interface{}
+					if err := msgpack.Unmarshal(wire, &value); err != nil {
+						t.Fatalf("not MessagePack: %v", err)
+					}
+				}
+
+				back, err := FromWire(encoding, wire)
+				if err != nil {
+					t.Fatalf("decoding: %v", err)
+				}
+				var want, got interface{}
+				json.Unmarshal(message, &want)
+				if err := json.Unmarshal(back, &got); err != nil {
+					t.Fatalf("decoded message is not JSON: %v", err)
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("round trip = %v, want %v", got, want)
+				}
+			})
+		}
+	}
+}
+
+func TestMsgPackKeepsIntegers(t *testing.T) {
+	wire, err := newWireMessage([]byte(`{"seq":7,"points":-3,"ratio":1.5}`)).encoded(models.EncodingMsgPack)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var value map[string]interface{}
+	if err := msgpack.Unmarshal(wire, &value); err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]interface{}{"seq": int8(7), "points": int8(-3), "ratio": 1.5} {
+		if value[key] != want {
+			t.Errorf("%s = %#v, want %#v", key, value[key], want)
+		}
+	}
+}
+
+func TestFrameType(t *testing.T) {
+	if FrameType(models.EncodingJSON) != websocket.TextMessage || FrameType(models.EncodingMsgPack) != websocket.BinaryMessage {
+		t.Error("wrong frame types")
+	}
+}
+
+// A broadcast is converted to MessagePack once and every MessagePack client
+// gets the same bytes, while JSON clients get the JSON
+func TestBroadcastEncodesOncePerEncoding(t *testing.T) {
+	ws := newTestService(t)
+	admin := newTestClient(ws, "192.0.2.1")
+	code := createTestRoom(t, ws, admin, nil)
+
+	clients := make([]*models.Client, 4)
+	for i := range clients {
+		clients[i] = newTestClient(ws, "192.0.2.2")
+		if i%2 == 1 {
+			clients[i].Encoding = models.EncodingMsgPack
+		}
+	}
+	onRoom(t, ws, code, func(room *models.Room) {
+		for _, client := range clients {
+			ws.bindClient(room, client)
+		}
+		ws.broadcastToRoom(room, models.Event{Type: models.EventPhaseChanged, Phase: models.PhaseActive})
+	})
+
+	frames := make([][]byte, len(clients))
+	for i, client := range clients {
+		frames[i] = <-client.Send
+	}
+	if &frames[1][0] != &frames[3][0] {
+		t.Error("MessagePack clients got separately encoded copies")
+	}
+	if &frames[0][0] != &frames[2][0] {
+		t.Error("JSON clients got separately encoded copies")
+	}
+	var event models.Event
+	if err := json.Unmarshal(frames[0], &event); err != nil || event.Phase != models.PhaseActive {
+		t.Errorf("JSON frame %s: %v", frames[0], err)
+	}
+	var value map[string]interface{}
+	if err := msgpack.Unmarshal(frames[1], &value); err != nil || value["phase"] != string(models.PhaseActive) {
+		t.Errorf("MessagePack frame %v: %v", value, err)
+	}
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"encoding/json"
+	"log"
+	"reflect"
+
+	"powerpoint-quiz/internal/models"
+)
+
+// viewSync is what a client was last told about its view of the room state
+type viewSync struct {
+	last    *projection // Nil before the first state
+	seq     int64       // Sequence number of the last state or state_patch
+	patches int         // Patches sent since the last full state
+}
+
+// mergePatch returns the JSON merge patch (RFC 7386) that turns the decoded
+// JSON value old into new, and whether they differ at all. Objects are
+// diffed key by key, anything else is replaced as a whole; removed keys and
+// keys that became null are both sent as null.
+func mergePatch(old, new interface{}) (interface{}, bool) {
+	oldObject, oldOK := old.(map[string]interface{})
+	newObject, newOK := new.(map[string]interface{})
+	if !oldOK || !newOK {
+		if reflect.DeepEqual(old, new) {
+			return nil, false
+		}
+		return new, true
+	}
+
+	patch := make(map[string]interface{})
+	for key, value := range newObject {
+		previous, exists := oldObject[key]
+		if !exists {
+			patch[key] = value
+			continue
+		}
+		if changed, ok := mergePatch(previous, value); ok {
+			patch[key] = changed
+		}
+	}
+	for key := range oldObject {
+		if _, exists := newObject[key]; !exists {
+			patch[key] = nil
+		}
+	}
+	return patch, len(patch) > 0
+}
+
+// stateMessage encodes a full state event carrying a view, nil if it fails
+func stateMessage(view *projection, seq int64) []byte {
+	message, err := json.Marshal(models.Event{
+		Type: models.EventState,
+		Seq:  seq,
+		Data: json.RawMessage(view.encoded),
+	})
+	if err != nil {
+		log.Printf("Error marshaling state: %v", err)
+		return nil
+	}
+	return message
+}
+
+// patchMessage encodes the state_patch that turns view base, sent as baseSeq,
+// into current; nil if nothing changed or it fails
+func patchMessage(base, current *projection, baseSeq, seq int64) []byte {
+	patch, changed := mergePatch(base.decoded, current.decoded)
+	if !changed {
+		return nil
+	}
+	patchJSON, err := json.Marshal(patch)
+	if err != nil {
+		log.Printf("Error marshaling state patch: %v", err)
+		return nil
+	}
+	message, err := json.Marshal(models.Event{
+		Type:    models.EventStatePatch,
+		Seq:     seq,
+		BaseSeq: baseSeq,
+		Data:    json.RawMessage(patchJSON),
+	})
+	if err != nil {
+		log.Printf("Error marshaling state patch: %v", err)
+		return nil
+	}
+	return message
+}
+
+// viewData returns a client's view of the room state to embed in an event
+func (ws *WebSocketService) viewData(room *models.Room, client *models.Client) interface{} {
+	if view := ws.newProjector(room).project(client); view != nil {
+		return json.RawMessage(view.encoded)
+	}
+	return nil
+}
+
+// sendState sends a client the full state of its view as of the room's
+// latest event and makes it the base of the client's next patch
+func (ws *WebSocketService) sendState(client *models.Client, room *models.Room) {
+	view := ws.newProjector(room).project(client)
+	if view == nil {
+		return
+	}
+	seq := ws.roomSeq(room)
+	message := stateMessage(view, seq)
+	if message == nil {
+		return
+	}
+	wire := newWireMessage(message)
+	ws.enqueue(client, wire, wire)
+	if sync, ok := ws.actorOf(room).clients[client]; ok {
+		*sync = viewSync{last: view, seq: seq}
+	}
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"reflect"
+	"testing"
+
+	"powerpoint-quiz/internal/models"
+)
+
+// applyMergePatch applies a JSON merge patch the way RFC 7386 describes
+func applyMergePatch(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = make(map[string]interface{})
+	}
+	result := make(map[string]interface{}, len(targetObject))
+	for key, value := range targetObject {
+		result[key] = value
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(result, key)
+		} else {
+			result[key] = applyMergePatch(result[key], value)
+		}
+	}
+	return result
+}
+
+// withoutNulls drops the keys with null values from objects
+func withoutNulls(value interface{}) interface{} {
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return value
+	}
+	for key, v := range object {
+		if v == nil {
+			delete(object, key)
+		} else {
+			object[key] = withoutNulls(v)
+		}
+	}
+	return object
+}
+
+func decodeJSON(t testing.TB, data string) interface{} {
+	t.Helper()
+	var value interface{}
+	if err := json.Unmarshal([]byte(data), &value); err != nil {
+		t.Fatalf("decode %s: %v", data, err)
+	}
+	return value
+}
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		name      string
+		old, new  string
+		wantPatch string // "" when nothing changed
+	}{
+		{"unchanged", `{"a":1,"b":{"c":[1,2]}}`, `{"a":1,"b":{"c":[1,2]}}`, ""},
+		{"changed value", `{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{"added key", `{"a":"b"}`, `{"a":"b","b":"c"}`, `{"b":"c"}`},
+		{"removed key is null", `{"a":"b","b":"c"}`, `{"a":"b"}`, `{"b":null}`},
+		{"key that became null", `{"a":"b"}`, `{"a":null}`, `{"a":null}`},
+		{"nested object", `{"a":{"b":"c","d":"e"}}`, `{"a":{"b":"c","d":"f"}}`, `{"a":{"d":"f"}}`},
+		{"nested removal", `{"a":{"b":"c","d":"e"}}`, `{"a":{"b":"c"}}`, `{"a":{"d":null}}`},
+		{"array replaced whole", `{"a":[1,2,3]}`, `{"a":[1,2]}`, `{"a":[1,2]}`},
+		{"array of objects replaced whole", `{"a":[{"b":1}]}`, `{"a":[{"b":2}]}`, `{"a":[{"b":2}]}`},
+		{"object became a scalar", `{"a":{"b":"c"}}`, `{"a":1}`, `{"a":1}`},
+		{"scalar became an object", `{"a":1}`, `{"a":{"b":"c"}}`, `{"a":{"b":"c"}}`},
+		{"not an object", `[1,2]`, `"x"`, `"x"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old, new := decodeJSON(t, tt.old), decodeJSON(t, tt.new)
+			patch, changed := mergePatch(old, new)
+			if changed != (tt.wantPatch != "") {
+				t.Fatalf("changed = %v, patch %v", changed, patch)
+			}
+			if !changed {
+				return
+			}
+			if want := decodeJSON(t, tt.wantPatch); !reflect.DeepEqual(patch, want) {
+				t.Errorf("patch = %v, want %v", patch, want)
+			}
+			// The patch turns old into new, but for null values, which a
+			// merge patch cannot set
+			want := withoutNulls(decodeJSON(t, tt.new))
+			if got := applyMergePatch(decodeJSON(t, tt.old), patch); !reflect.DeepEqual(got, want) {
+				t.Errorf("patched = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+// benchmarkRoom creates a room with n players in the active phase
+func benchmarkRoom(b *testing.B, n int, delta bool) (*WebSocketService, string, []*models.Client) {
+	b.Helper()
+	ws := newTestService(b)
+	admin := newTestClient(ws, "192.0.2.1")
+	if err := ws.handleCreateRoom(admin, models.Event{Type: models.EventCreateRoom}); err != nil {
+		b.Fatal(err)
+	}
+	code := admin.RoomID
+	clients := []*models.Client{admin}
+	for i := 0; i < n; i++ {
+		client := newTestClient(ws, "192.0.2.10")
+		client.Delta = delta
+		id := fmt.Sprintf("player%03d", i)
+		var err error
+		ws.call(code, func(a *roomActor) {
+			err = ws.dispatchEvent(client, a.room, models.Event{Type: models.EventJoin, QuizID: code, UserID: id, Nickname: id})
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+		clients = append(clients, client)
+	}
+	ws.call(code, func(a *roomActor) {
+		ws.dispatchEvent(admin, a.room, models.Event{Type: models.EventHostSetState, Phase: models.PhaseActive})
+	})
+	for _, client := range clients {
+		for len(client.Send) > 0 {
+			<-client.Send
+		}
+	}
+	return ws, code, clients
+}
+
+func BenchmarkMergePatch(b *testing.B) {
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(io.Discard)
+
+	ws, code, _ := benchmarkRoom(b, 200, false)
+	var before, after *projection
+	ws.call(code, func(a *roomActor) {
+		admin := &models.Client{Role: models.RoleAdmin}
+		before = ws.newProjector(a.room).project(admin)
+		a.room.Players["player007"].Score += 10
+		after = ws.newProjector(a.room).project(admin)
+	})
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, changed := mergePatch(before.decoded, after.decoded); !changed {
+			b.Fatal("no change found")
+		}
+	}
+}
+
+func BenchmarkBroadcastState(b *testing.B) {
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(io.Discard)
+
+	for _, mode := range []struct {
+		name  string
+		delta bool
+	}{{"full", false}, {"delta", true}} {
+		b.Run(mode.name, func(b *testing.B) {
+			ws, code, clients := benchmarkRoom(b, 200, mode.delta)
+			b.ReportAllocs()
+			b.ResetTimer()
+			ws.call(code, func(a *roomActor) {
+				for i := 0; i < b.N; i++ {
+					a.room.Players[fmt.Sprintf("player%03d", i%200)].Score++
+					ws.broadcastRoomState(a.room)
+					for _, client := range clients {
+						for len(client.Send) > 0 {
+							<-client.Send
+						}
+					}
+				}
+			})
+		})
+	}
+}
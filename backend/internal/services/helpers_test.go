@@ -0,0 +1,110 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"powerpoint-quiz/internal/models"
+)
+
+// newTestService returns a service with in-memory stores and no rate limits
+func newTestService(t testing.TB) *WebSocketService {
+	t.Helper()
+	opts := DefaultOptions()
+	opts.SessionSecret = []byte("test secret")
+	opts.BuzzWindow = 0
+	opts.ConnRateLimits = nil
+	opts.IPRateLimits = nil
+	opts.SendBuffer = 1024
+	return NewWebSocketService(NewMemoryRoomStore(), NewMemoryHistoryStore(), opts)
+}
+
+// newTestClient returns a connection without a socket; its messages stay
+// in Send
+func newTestClient(ws *WebSocketService, ip string) *models.Client {
+	client := ws.NewClient(nil, "")
+	client.IP = ip
+	return client
+}
+
+// createTestRoom creates a room with client as its admin and returns the
+// room code
+func createTestRoom(t *testing.T, ws *WebSocketService, admin *models.Client, quiz *models.Quiz) string {
+	t.Helper()
+	if err := ws.handleCreateRoom(admin, models.Event{Type: models.EventCreateRoom, Quiz: quiz}); err != nil {
+		t.Fatalf("create_room: %v", err)
+	}
+	return admin.RoomID
+}
+
+// dispatch runs an event from a client on the room's actor and returns why
+// it was refused
+func dispatch(t *testing.T, ws *WebSocketService, client *models.Client, code string, event models.Event) error {
+	t.Helper()
+	var err error
+	if !ws.call(code, func(a *roomActor) { err = ws.dispatchEvent(client, a.room, event) }) {
+		t.Fatalf("room %s not found", code)
+	}
+	return err
+}
+
+// onRoom runs fn on the room's actor
+func onRoom(t *testing.T, ws *WebSocketService, code string, fn func(room *models.Room)) {
+	t.Helper()
+	if !ws.call(code, func(a *roomActor) { fn(a.room) }) {
+		t.Fatalf("room %s not found", code)
+	}
+}
+
+// joinTestPlayer joins a new player to a room
+func joinTestPlayer(t *testing.T, ws *WebSocketService, code, userID string) *models.Client {
+	t.Helper()
+	client := newTestClient(ws, "192.0.2.10")
+	event := models.Event{Type: models.EventJoin, QuizID: code, UserID: userID, Nickname: userID}
+	if err := dispatch(t, ws, client, code, event); err != nil {
+		t.Fatalf("join %s: %v", userID, err)
+	}
+	return client
+}
+
+// drain returns the events queued for a client so far
+func drain(t *testing.T, client *models.Client) []models.Event {
+	t.Helper()
+	var events []models.Event
+	for {
+		select {
+		case message := <-client.Send:
+			var event models.Event
+			if err := json.Unmarshal(message, &event); err != nil {
+				t.Fatalf("undecodable message %s: %v", message, err)
+			}
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+// received returns the first queued event of a type, draining the queue
+func received(t *testing.T, client *models.Client, eventType models.EventType) (models.Event, bool) {
+	t.Helper()
+	for _, event := range drain(t, client) {
+		if event.Type == eventType {
+			return event, true
+		}
+	}
+	return models.Event{}, false
+}
+
+// refusalCode returns the code of a refusal, or "" for nil
+func refusalCode(err error) string {
+	if err == nil {
+		return ""
+	}
+	var refusal *CommandError
+	if errors.As(err, &refusal) {
+		return refusal.Code
+	}
+	return err.Error()
+}
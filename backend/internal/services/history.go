@@ -0,0 +1,475 @@
+package services
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"powerpoint-quiz/internal/models"
+)
+
+// HistoryStore keeps the append-only event log of every room
+type HistoryStore interface {
+	// Append assigns the next sequence number of the entry's room and stores it
+	Append(entry models.HistoryEntry) (models.HistoryEntry, error)
+	Entries(roomCode string) []models.HistoryEntry
+	Delete(roomCode string) error
+}
+
+// MemoryHistoryStore keeps room history in process memory only
+type MemoryHistoryStore struct {
+	mu   sync.RWMutex
+	logs map[string][]models.HistoryEntry
+}
+
+// NewMemoryHistoryStore creates an empty in-memory history store
+func NewMemoryHistoryStore() *MemoryHistoryStore {
+	return &MemoryHistoryStore{
+		logs: make(map[string][]models.HistoryEntry),
+	}
+}
+
+// Append stores an entry at the end of its room's log
+func (s *MemoryHistoryStore) Append(entry models.HistoryEntry) (models.HistoryEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry.Seq = int64(len(s.logs[entry.RoomCode]) + 1)
+	s.logs[entry.RoomCode] = append(s.logs[entry.RoomCode], entry)
+	return entry, nil
+}
+
+// Entries returns a copy of a room's log
+func (s *MemoryHistoryStore) Entries(roomCode string) []models.HistoryEntry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]models.HistoryEntry(nil), s.logs[roomCode]...)
+}
+
+// Delete drops a room's log
+func (s *MemoryHistoryStore) Delete(roomCode string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.logs, roomCode)
+	return nil
+}
+
+// FileHistoryStore writes each room's log to <dir>/<code>.jsonl, one entry
+// per line, and keeps a copy in memory for reads
+type FileHistoryStore struct {
+	mu   sync.RWMutex
+	dir  string
+	logs map[string][]models.HistoryEntry
+}
+
+// NewFileHistoryStore opens (or creates) a history directory and loads every
+// room log found in it
+func NewFileHistoryStore(dir string) (*FileHistoryStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create history dir: %w", err)
+	}
+
+	s := &FileHistoryStore{
+		dir:  dir,
+		logs: make(map[string][]models.HistoryEntry),
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	if err != nil {
+		return nil, fmt.Errorf("list history: %w", err)
+	}
+	for _, file := range files {
+		code := strings.TrimSuffix(filepath.Base(file), ".jsonl")
+		entries, err := readHistoryFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("read history %s: %w", code, err)
+		}
+		s.logs[code] = entries
+	}
+	return s, nil
+}
+
+// Append stores an entry at the end of its room's log
+func (s *FileHistoryStore) Append(entry models.HistoryEntry) (models.HistoryEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry.Seq = int64(len(s.logs[entry.RoomCode]) + 1)
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return entry, fmt.Errorf("encode history entry: %w", err)
+	}
+	line = append(line, '\n')
+
+	f, err := os.OpenFile(s.path(entry.RoomCode), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return entry, fmt.Errorf("open history: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(line); err != nil {
+		return entry, fmt.Errorf("write history: %w", err)
+	}
+
+	s.logs[entry.RoomCode] = append(s.logs[entry.RoomCode], entry)
+	return entry, nil
+}
+
+// Entries returns a copy of a room's log
+func (s *FileHistoryStore) Entries(roomCode string) []models.HistoryEntry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]models.HistoryEntry(nil), s.logs[roomCode]...)
+}
+
+// Delete drops a room's log from memory and disk
+func (s *FileHistoryStore) Delete(roomCode string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.logs, roomCode)
+	if err := os.Remove(s.path(roomCode)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *FileHistoryStore) path(roomCode string) string {
+	return filepath.Join(s.dir, filepath.Base(roomCode)+".jsonl")
+}
+
+func readHistoryFile(path string) ([]models.HistoryEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []models.HistoryEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry models.HistoryEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// Torn tail after a crash; everything before it is intact
+			log.Printf("History %s: ignoring entries after line %d: %v", path, len(entries)+1, err)
+			break
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// withoutCredentials returns the event with every secret it may carry
+// removed, for history and logs
+func withoutCredentials(event models.Event) models.Event {
+	event.Password = ""
+	event.AdminToken = ""
+	event.SessionToken = ""
+	event.HostToken = ""
+	event.DisplayCode = ""
+	event.InviteCode = ""
+	event.APIKey = ""
+	return event
+}
+
+// commit records an accepted event in the room's history and applies it to
+// the room. Handlers validate and resolve the event first (generated IDs,
+// awarded points).
+func (ws *WebSocketService) commit(room *models.Room, role string, event models.Event) models.HistoryEntry {
+	event = withoutCredentials(event)
+	// Neither does the transport
+	event.RequestID = ""
+
+	entry := models.HistoryEntry{
+		RoomCode:  room.Code,
+		Timestamp: time.Now(),
+		Role:      role,
+		Event:     event,
+	}
+	if event.Type == models.EventCreateRoom {
+		entry.RoomCode = event.RoomCode
+	}
+
+	recorded, err := ws.history.Append(entry)
+	if err != nil {
+		log.Printf("Error recording %s in room %s history: %v", event.Type, entry.RoomCode, err)
+		recorded = entry
+	}
+	applyEvent(room, recorded)
+	ws.markChanged(room)
+	return recorded
+}
+
+// History returns the recorded event log of a room
+func (ws *WebSocketService) History(roomCode string) []models.HistoryEntry {
+	return ws.history.Entries(roomCode)
+}
+
+// ReplayRoom rebuilds a room from its event log. The first entry must be the
+// room's create_room event.
+func ReplayRoom(entries []models.HistoryEntry) (*models.Room, error) {
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("empty history")
+	}
+	if entries[0].Event.Type != models.EventCreateRoom {
+		return nil, fmt.Errorf("history starts with %s, want %s", entries[0].Event.Type, models.EventCreateRoom)
+	}
+
+	room := &models.Room{}
+	for i, entry := range entries {
+		if i > 0 && entry.Seq <= entries[i-1].Seq {
+			return nil, fmt.Errorf("history out of order at seq %d", entry.Seq)
+		}
+		applyEvent(room, entry)
+	}
+	return room, nil
+}
+
+// isFalseStart reports whether a click at the given time comes before the
+// button is enabled
+func isFalseStart(room *models.Room, at time.Time) bool {
+	return (room.Phase != models.PhaseStarted && room.Phase != models.PhaseActive) || at.Before(room.EnableAt)
+}
+
+// applyEvent is the single place where accepted events change the game
+// state. It must only depend on the room and the entry so replay is
+// deterministic. Access control is kept out of history, so the handlers set
+// the token epoch, display and invitation codes, members, API key hash and
+// creator address directly and the room store keeps them; so are the
+// pending buzzes, which last only for the adjudication window.
+func applyEvent(room *models.Room, entry models.HistoryEntry) {
+	event := entry.Event
+	at := entry.Timestamp
+	room.LastActivity = at
+
+	switch event.Type {
+	case models.EventCreateRoom:
+		room.ID = event.QuizID
+		room.Code = event.RoomCode
+		room.Phase = models.PhaseLobby
+		room.Players = make(map[string]*models.Player)
+		room.Teams = make(map[string]*models.Team)
+		room.CreatedAt = at
+		room.Quiz = event.Quiz
+
+	case models.EventLoadQuiz:
+		room.Quiz = event.Quiz
+		room.QuestionIndex = 0
+		room.CurrentQuestion = nil
+		room.CorrectAnswer = ""
+
+	case models.EventJoin:
+		room.Players[event.UserID] = &models.Player{
+			ID:        event.UserID,
+			UserID:    event.UserID,
+			ButtonID:  event.ButtonID,
+			Name:      event.Nickname,
+			Connected: true,
+		}
+
+	case models.EventPlayerConnected:
+		if player, ok := room.Players[event.UserID]; ok {
+			player.Connected = true
+			player.DisconnectedAt = time.Time{}
+			player.Left = false
+		}
+
+	case models.EventPlayerDisconnected:
+		if player, ok := room.Players[event.UserID]; ok {
+			player.Connected = false
+			player.DisconnectedAt = at
+		}
+
+	case models.EventPlayerLeft:
+		if player, ok := room.Players[event.UserID]; ok {
+			player.Connected = false
+			player.Left = true
+			if player.DisconnectedAt.IsZero() {
+				player.DisconnectedAt = at
+			}
+		}
+		room.BuzzQueue = removeString(room.BuzzQueue, event.UserID)
+
+	case models.EventClick:
+		player, exists := room.Players[event.UserID]
+		if !exists {
+			// Auto-create player if not exists
+			player = &models.Player{
+				ID:        event.UserID,
+				UserID:    event.UserID,
+				ButtonID:  event.ButtonID,
+				Name:      fmt.Sprintf("Player %s", event.UserID),
+				Connected: true,
+			}
+			room.Players[event.UserID] = player
+		}
+		player.LastClick = at
+		player.ClickCount++
+
+		// Check for false start - allow clicks in both started and active phases.
+		// The first answerer is chosen by a separate buzz_decision entry.
+		if isFalseStart(room, at) {
+			player.FalseStarts++
+		}
+
+	case models.EventBuzzDecision:
+		room.FirstAnswerer = event.UserID
+		room.QuestionActive = false
+		room.PendingBuzzes = nil
+		recordBuzzTime(room, event.UserID, event.ReactionMs)
+
+	case models.EventBuzzQueued:
+		if event.UserID != room.FirstAnswerer && !containsString(room.BuzzQueue, event.UserID) {
+			room.BuzzQueue = append(room.BuzzQueue, event.UserID)
+			recordBuzzTime(room, event.UserID, event.ReactionMs)
+		}
+
+	case models.EventHostSetState:
+		room.Phase = event.Phase
+		switch event.Phase {
+		case models.PhaseStarted:
+			room.EnableAt = at.Add(time.Duration(event.DelayMs) * time.Millisecond)
+		case models.PhaseActive:
+			room.EnableAt = at
+			room.QuestionActive = true
+		default:
+			room.QuestionActive = false
+		}
+
+	case models.EventCreateTeam:
+		room.Teams[event.TeamID] = &models.Team{
+			ID:        event.TeamID,
+			Name:      event.TeamName,
+			Color:     event.TeamColor,
+			Players:   []string{},
+			CreatedAt: at,
+		}
+
+	case models.EventJoinTeam:
+		player, exists := room.Players[event.UserID]
+		team, teamExists := room.Teams[event.TeamID]
+		if !exists || !teamExists {
+			return
+		}
+		if event.Nickname != "" {
+			player.Name = event.Nickname
+		}
+		// Remove player from other teams first
+		for _, t := range room.Teams {
+			for i, p := range t.Players {
+				if p == event.UserID {
+					t.Players = append(t.Players[:i], t.Players[i+1:]...)
+					break
+				}
+			}
+		}
+		team.Players = append(team.Players, event.UserID)
+
+	case models.EventStartQuestion:
+		room.QuestionActive = true
+		room.FirstAnswerer = ""
+		room.CorrectAnswer = ""
+		room.QuestionStartTime = at
+		room.QuestionSeq++
+		room.PendingBuzzes = nil
+		room.BuzzQueue = nil
+		room.LockedOut = nil
+		room.BuzzTimes = nil
+		room.Answers = make(map[string]*models.OptionAnswer)
+		room.AnswerCount = 0
+		room.AnswersLocked = false
+		if room.Quiz != nil {
+			if event.QuestionID != "" {
+				if i := questionIndex(room.Quiz, event.QuestionID); i >= 0 {
+					room.QuestionIndex = i
+				}
+			}
+			room.CurrentQuestion = nil
+			if room.QuestionIndex < len(room.Quiz.Questions) {
+				room.CurrentQuestion = publicQuestion(&room.Quiz.Questions[room.QuestionIndex])
+			}
+		}
+
+	case models.EventAnswerReceived:
+		room.FirstAnswerer = event.UserID
+		room.QuestionActive = false
+		if !room.QuestionStartTime.IsZero() {
+			recordBuzzTime(room, event.UserID, at.Sub(room.QuestionStartTime).Milliseconds())
+		}
+
+	case models.EventAnswerConfirmation:
+		action := newScoreAction(entry)
+		applyScore(room, action, room.Players[event.UserID], room.Teams[event.TeamID], event.IsCorrect, event.Points)
+		logScoreAction(room, action)
+		if event.IsCorrect {
+			room.QuestionActive = false
+			room.FirstAnswerer = ""
+			room.BuzzQueue = nil
+		} else {
+			passTurn(room, event.UserID, event.ExcludeTeam)
+		}
+
+	case models.EventSetScoring:
+		room.Scoring = event.Scoring
+
+	case models.EventFalseStartPenalty:
+		action := newScoreAction(entry)
+		delta := models.ScoreDelta{UserID: event.UserID, TeamID: event.TeamID, Points: event.Points}
+		applyDelta(room, delta)
+		action.Deltas = append(action.Deltas, delta)
+		logScoreAction(room, action)
+
+	case models.EventScoreAdjust:
+		applyScoreAdjust(room, entry)
+
+	case models.EventScoreUndo:
+		applyScoreUndo(room, entry)
+
+	case models.EventSubmitAnswer:
+		key := event.UserID
+		if event.TeamID != "" {
+			key = event.TeamID
+		}
+		if room.Answers == nil {
+			room.Answers = make(map[string]*models.OptionAnswer)
+		}
+		room.Answers[key] = &models.OptionAnswer{
+			UserID:   event.UserID,
+			TeamID:   event.TeamID,
+			OptionID: event.OptionID,
+			At:       at,
+		}
+		room.AnswerCount = len(room.Answers)
+
+	case models.EventLockAnswers:
+		applyLockAnswers(room, entry)
+
+	case models.EventShowAnswer:
+		if q := currentQuizQuestion(room); q != nil {
+			room.CorrectAnswer = q.CorrectAnswer
+		}
+
+	case models.EventNextQuestion:
+		room.QuestionActive = false
+		room.FirstAnswerer = ""
+		room.CorrectAnswer = ""
+		room.QuestionStartTime = time.Time{}
+		room.BuzzQueue = nil
+		room.LockedOut = nil
+		room.BuzzTimes = nil
+		if room.Quiz != nil && room.QuestionIndex < len(room.Quiz.Questions) {
+			room.QuestionIndex++
+		}
+		room.CurrentQuestion = nil
+		room.Answers = nil
+		room.AnswerCount = 0
+		room.AnswersLocked = false
+
+	case models.EventDeactivateQuestion, models.EventTimeUp:
+		room.QuestionActive = false
+	}
+}
@@ -0,0 +1,272 @@
+package services
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"powerpoint-quiz/internal/models"
+)
+
+func TestApplyEvent(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	quiz := &models.Quiz{Questions: []models.Question{
+		{ID: "q1", Type: models.QuestionMultipleChoice, Text: "?", CorrectAnswer: "a"},
+		{ID: "q2", Type: models.QuestionMultipleChoice, Text: "?", CorrectAnswer: "b"},
+	}}
+
+	tests := []struct {
+		name   string
+		events []models.Event
+		check  func(t *testing.T, room *models.Room)
+	}{
+		{
+			name:   "join",
+			events: []models.Event{{Type: models.EventJoin, UserID: "u1", Nickname: "Ann"}},
+			check: func(t *testing.T, room *models.Room) {
+				if p := room.Players["u1"]; p == nil || p.Name != "Ann" || !p.Connected {
+					t.Errorf("player = %+v", p)
+				}
+			},
+		},
+		{
+			name: "disconnect and reconnect",
+			events: []models.Event{
+				{Type: models.EventJoin, UserID: "u1"},
+				{Type: models.EventPlayerDisconnected, UserID: "u1"},
+				{Type: models.EventPlayerConnected, UserID: "u1"},
+			},
+			check: func(t *testing.T, room *models.Room) {
+				if p := room.Players["u1"]; !p.Connected || !p.DisconnectedAt.IsZero() {
+					t.Errorf("player = %+v", p)
+				}
+			},
+		},
+		{
+			name: "click before the button is enabled",
+			events: []models.Event{
+				{Type: models.EventJoin, UserID: "u1"},
+				{Type: models.EventClick, UserID: "u1"},
+			},
+			check: func(t *testing.T, room *models.Room) {
+				if p := room.Players["u1"]; p.ClickCount != 1 || p.FalseStarts != 1 {
+					t.Errorf("clicks = %d, false starts = %d", p.ClickCount, p.FalseStarts)
+				}
+			},
+		},
+		{
+			name: "join team moves the player",
+			events: []models.Event{
+				{Type: models.EventJoin, UserID: "u1"},
+				{Type: models.EventCreateTeam, TeamID: "t1", TeamName: "Red"},
+				{Type: models.EventCreateTeam, TeamID: "t2", TeamName: "Blue"},
+				{Type: models.EventJoinTeam, UserID: "u1", TeamID: "t1"},
+				{Type: models.EventJoinTeam, UserID: "u1", TeamID: "t2"},
+			},
+			check: func(t *testing.T, room *models.Room) {
+				if len(room.Teams["t1"].Players) != 0 || len(room.Teams["t2"].Players) != 1 {
+					t.Errorf("teams = %v, %v", room.Teams["t1"].Players, room.Teams["t2"].Players)
+				}
+			},
+		},
+		{
+			name:   "start question",
+			events: []models.Event{{Type: models.EventStartQuestion, QuestionID: "q2"}},
+			check: func(t *testing.T, room *models.Room) {
+				if !room.QuestionActive || room.QuestionSeq != 1 || room.QuestionIndex != 1 {
+					t.Errorf("active = %v, seq = %d, index = %d", room.QuestionActive, room.QuestionSeq, room.QuestionIndex)
+				}
+				if room.CurrentQuestion == nil || room.CurrentQuestion.CorrectAnswer != "" {
+					t.Errorf("current question = %+v, want it without the answer", room.CurrentQuestion)
+				}
+			},
+		},
+		{
+			name: "submit answer replaces the previous one",
+			events: []models.Event{
+				{Type: models.EventJoin, UserID: "u1"},
+				{Type: models.EventStartQuestion},
+				{Type: models.EventSubmitAnswer, UserID: "u1", OptionID: "a"},
+				{Type: models.EventSubmitAnswer, UserID: "u1", OptionID: "b"},
+			},
+			check: func(t *testing.T, room *models.Room) {
+				if room.AnswerCount != 1 || room.Answers["u1"].OptionID != "b" {
+					t.Errorf("answers = %d, u1 chose %+v", room.AnswerCount, room.Answers["u1"])
+				}
+			},
+		},
+		{
+			name: "correct answer scores",
+			events: []models.Event{
+				{Type: models.EventJoin, UserID: "u1"},
+				{Type: models.EventStartQuestion},
+				{Type: models.EventAnswerReceived, UserID: "u1"},
+				{Type: models.EventAnswerConfirmation, UserID: "u1", IsCorrect: true, Points: 10},
+			},
+			check: func(t *testing.T, room *models.Room) {
+				if room.Players["u1"].Score != 10 || room.QuestionActive || room.FirstAnswerer != "" {
+					t.Errorf("score = %d, active = %v, answerer = %q", room.Players["u1"].Score, room.QuestionActive, room.FirstAnswerer)
+				}
+				if len(room.ScoreLog) != 1 {
+					t.Errorf("score log has %d actions, want 1", len(room.ScoreLog))
+				}
+			},
+		},
+		{
+			name: "next question",
+			events: []models.Event{
+				{Type: models.EventStartQuestion},
+				{Type: models.EventShowAnswer},
+				{Type: models.EventNextQuestion},
+			},
+			check: func(t *testing.T, room *models.Room) {
+				if room.QuestionIndex != 1 || room.CorrectAnswer != "" || room.CurrentQuestion != nil || room.QuestionActive {
+					t.Errorf("index = %d, answer = %q, current = %v", room.QuestionIndex, room.CorrectAnswer, room.CurrentQuestion)
+				}
+			},
+		},
+		{
+			name: "time up ends the question",
+			events: []models.Event{
+				{Type: models.EventStartQuestion},
+				{Type: models.EventTimeUp},
+			},
+			check: func(t *testing.T, room *models.Room) {
+				if room.QuestionActive {
+					t.Error("question still active")
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries := []models.HistoryEntry{{
+				Seq:       1,
+				Timestamp: start,
+				Event:     models.Event{Type: models.EventCreateRoom, RoomCode: "ROOM", Quiz: quiz},
+			}}
+			for i, event := range tt.events {
+				entries = append(entries, models.HistoryEntry{
+					Seq:       int64(i + 2),
+					Timestamp: start.Add(time.Duration(i+1) * time.Second),
+					Event:     event,
+				})
+			}
+			room, err := ReplayRoom(entries)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t, room)
+		})
+	}
+}
+
+func TestReplayRoomRejectsBadHistory(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []models.HistoryEntry
+	}{
+		{"empty", nil},
+		{"no create_room", []models.HistoryEntry{{Seq: 1, Event: models.Event{Type: models.EventJoin}}}},
+		{"out of order", []models.HistoryEntry{
+			{Seq: 2, Event: models.Event{Type: models.EventCreateRoom}},
+			{Seq: 1, Event: models.Event{Type: models.EventJoin}},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ReplayRoom(tt.entries); err == nil {
+				t.Error("history accepted")
+			}
+		})
+	}
+}
+
+// A room rebuilt from its history matches the live one in everything but
+// the credentials, which are kept out of history
+func TestReplayMatchesLiveRoom(t *testing.T) {
+	ws := newTestService(t)
+	admin := newTestClient(ws, "192.0.2.1")
+	code := createTestRoom(t, ws, admin, choiceQuiz())
+	players := map[string]*models.Client{
+		"u1": joinTestPlayer(t, ws, code, "u1"),
+		"u2": joinTestPlayer(t, ws, code, "u2"),
+	}
+	ws.ClientDisconnected(joinTestPlayer(t, ws, code, "u3"))
+
+	steps := []struct {
+		client *models.Client
+		event  models.Event
+	}{
+		{admin, models.Event{Type: models.EventCreateTeam, TeamName: "Red"}},
+		{players["u1"], models.Event{Type: models.EventJoinTeam, TeamID: "team_1"}},
+		{admin, models.Event{Type: models.EventHostSetState, Phase: models.PhaseActive}},
+		{admin, models.Event{Type: models.EventStartQuestion}},
+		{players["u1"], models.Event{Type: models.EventSubmitAnswer, OptionID: "B"}},
+		{players["u2"], models.Event{Type: models.EventSubmitAnswer, OptionID: "A"}},
+		{admin, models.Event{Type: models.EventLockAnswers}},
+		{admin, models.Event{Type: models.EventNextQuestion}},
+		{admin, models.Event{Type: models.EventStartQuestion}},
+		{players["u2"], models.Event{Type: models.EventClick}},
+		{admin, models.Event{Type: models.EventAnswerConfirmation, UserID: "u2", IsCorrect: true}},
+		{admin, models.Event{Type: models.EventScoreAdjust, UserID: "u1", ScoreOp: models.ScoreOpAdd, Points: 2, Reason: "Bonus"}},
+	}
+	for _, step := range steps {
+		if err := dispatch(t, ws, step.client, code, step.event); err != nil {
+			t.Fatalf("%s: %v", step.event.Type, err)
+		}
+	}
+
+	replayed, err := ReplayRoom(ws.History(code))
+	if err != nil {
+		t.Fatal(err)
+	}
+	onRoom(t, ws, code, func(live *models.Room) {
+		if live.Players["u2"].Score == 0 || live.Teams["team_1"].Score == 0 {
+			t.Error("scenario scored nothing")
+		}
+		// The public state, plus what is kept out of it but replayed
+		for _, part := range []struct {
+			name         string
+			live, replay interface{}
+		}{
+			{"state", live, replayed},
+			{"quiz", live.Quiz, replayed.Quiz},
+			{"answers", live.Answers, replayed.Answers},
+			{"score log", live.ScoreLog, replayed.ScoreLog},
+		} {
+			want, _ := json.Marshal(part.live)
+			got, _ := json.Marshal(part.replay)
+			if string(got) != string(want) {
+				t.Errorf("replayed %s\n%s\nlive\n%s", part.name, got, want)
+			}
+		}
+	})
+}
+
+// Team IDs are numbered per room and never reuse one already taken
+func TestCreateTeamIDs(t *testing.T) {
+	ws := newTestService(t)
+	admin := newTestClient(ws, "192.0.2.1")
+	code := createTestRoom(t, ws, admin, nil)
+	onRoom(t, ws, code, func(room *models.Room) {
+		ws.commit(room, "admin", models.Event{Type: models.EventCreateTeam, TeamID: "team_2", TeamName: "Imported"})
+	})
+	for _, name := range []string{"Red", "Blue", "Green"} {
+		if err := dispatch(t, ws, admin, code, models.Event{Type: models.EventCreateTeam, TeamName: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	onRoom(t, ws, code, func(room *models.Room) {
+		names := make(map[string]string)
+		for id, team := range room.Teams {
+			names[id] = team.Name
+		}
+		want := map[string]string{"team_2": "Imported", "team_3": "Red", "team_4": "Blue", "team_5": "Green"}
+		if !reflect.DeepEqual(names, want) {
+			t.Errorf("teams = %v, want %v", names, want)
+		}
+	})
+}
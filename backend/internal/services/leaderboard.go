@@ -0,0 +1,169 @@
+package services
+
+import (
+	"sort"
+
+	"powerpoint-quiz/internal/models"
+)
+
+// recordReaction adds a reaction time to a player's average. Called from
+// applyEvent.
+func recordReaction(player *models.Player, ms int64) {
+	if player == nil || ms <= 0 {
+		return
+	}
+	player.Reactions++
+	player.ReactionTotalMs += ms
+	player.AvgReactionMs = player.ReactionTotalMs / int64(player.Reactions)
+}
+
+// recordBuzzTime remembers a player's reaction to the current question and
+// adds it to their average. Called from applyEvent.
+func recordBuzzTime(room *models.Room, userID string, ms int64) {
+	if ms <= 0 {
+		return
+	}
+	if _, seen := room.BuzzTimes[userID]; seen {
+		return
+	}
+	if room.BuzzTimes == nil {
+		room.BuzzTimes = make(map[string]int64)
+	}
+	room.BuzzTimes[userID] = ms
+	recordReaction(room.Players[userID], ms)
+}
+
+// BuildLeaderboard ranks the players and teams of a room. Ties on score are
+// broken by more correct answers, then faster average reaction (entries
+// without any reaction come last), then fewer incorrect answers. Entries
+// still tied share a rank and are listed by name.
+func BuildLeaderboard(room *models.Room) *models.Leaderboard {
+	board := &models.Leaderboard{
+		Players: make([]models.LeaderboardEntry, 0, len(room.Players)),
+		Teams:   make([]models.LeaderboardEntry, 0, len(room.Teams)),
+	}
+
+	for _, p := range room.Players {
+		board.Players = append(board.Players, models.LeaderboardEntry{
+			ID:               p.ID,
+			Name:             p.Name,
+			Score:            p.Score,
+			CorrectAnswers:   p.CorrectAnswers,
+			IncorrectAnswers: p.IncorrectAnswers,
+			AvgReactionMs:    p.AvgReactionMs,
+		})
+	}
+
+	for _, t := range room.Teams {
+		entry := models.LeaderboardEntry{
+			ID:    t.ID,
+			Name:  t.Name,
+			Score: t.Score,
+		}
+		var reactions int
+		var reactionTotal int64
+		for _, id := range t.Players {
+			if p, ok := room.Players[id]; ok {
+				entry.CorrectAnswers += p.CorrectAnswers
+				entry.IncorrectAnswers += p.IncorrectAnswers
+				reactions += p.Reactions
+				reactionTotal += p.ReactionTotalMs
+			}
+		}
+		if reactions > 0 {
+			entry.AvgReactionMs = reactionTotal / int64(reactions)
+		}
+		board.Teams = append(board.Teams, entry)
+	}
+
+	rankEntries(board.Players)
+	rankEntries(board.Teams)
+	return board
+}
+
+// compareEntries orders two entries by the tie-breaking rules; negative
+// means a ranks higher, zero means they share a rank
+func compareEntries(a, b models.LeaderboardEntry) int {
+	if a.Score != b.Score {
+		return b.Score - a.Score
+	}
+	if a.CorrectAnswers != b.CorrectAnswers {
+		return b.CorrectAnswers - a.CorrectAnswers
+	}
+	if a.AvgReactionMs != b.AvgReactionMs {
+		switch {
+		case a.AvgReactionMs == 0:
+			return 1
+		case b.AvgReactionMs == 0:
+			return -1
+		case a.AvgReactionMs < b.AvgReactionMs:
+			return -1
+		default:
+			return 1
+		}
+	}
+	return a.IncorrectAnswers - b.IncorrectAnswers
+}
+
+func rankEntries(entries []models.LeaderboardEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		if c := compareEntries(entries[i], entries[j]); c != 0 {
+			return c < 0
+		}
+		if entries[i].Name != entries[j].Name {
+			return entries[i].Name < entries[j].Name
+		}
+		return entries[i].ID < entries[j].ID
+	})
+	for i := range entries {
+		if i > 0 && compareEntries(entries[i-1], entries[i]) == 0 {
+			entries[i].Rank = entries[i-1].Rank
+		} else {
+			entries[i].Rank = i + 1
+		}
+	}
+}
+
+// Leaderboard returns the current leaderboard of a room on behalf of the
+// REST API
+func (ws *WebSocketService) Leaderboard(room *models.Room) *models.Leaderboard {
+	var board *models.Leaderboard
+	ws.call(room.Code, func(a *roomActor) {
+		board = BuildLeaderboard(room)
+	})
+	return board
+}
+
+// PublicLeaderboard returns the leaderboard of a room as players see it,
+// without user IDs
+func (ws *WebSocketService) PublicLeaderboard(room *models.Room) interface{} {
+	var board interface{}
+	ws.call(room.Code, func(a *roomActor) {
+		public, _ := publicEvent(room, models.Event{Type: models.EventLeaderboard, Data: BuildLeaderboard(room)})
+		board = public.Data
+	})
+	return board
+}
+
+// handleLeaderboard sends the current leaderboard to the requesting client
+func (ws *WebSocketService) handleLeaderboard(client *models.Client, room *models.Room) error {
+	leaderboardEvent := models.Event{
+		Type: models.EventLeaderboard,
+		Data: BuildLeaderboard(room),
+	}
+	if !isStaff(client) {
+		leaderboardEvent, _ = publicEvent(room, leaderboardEvent)
+	}
+	ws.sendEventToClient(client, leaderboardEvent)
+	return nil
+}
+
+// broadcastLeaderboard sends the leaderboard to the room after scores
+// change
+func (ws *WebSocketService) broadcastLeaderboard(room *models.Room) {
+	leaderboardEvent := models.Event{
+		Type: models.EventLeaderboard,
+		Data: BuildLeaderboard(room),
+	}
+	ws.broadcastToRoom(room, leaderboardEvent)
+}
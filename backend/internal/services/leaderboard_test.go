@@ -0,0 +1,114 @@
+package services
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"powerpoint-quiz/internal/models"
+)
+
+// ranking is the order and ranks of leaderboard entries as "name:rank"
+func ranking(entries []models.LeaderboardEntry) []string {
+	var out []string
+	for _, e := range entries {
+		out = append(out, fmt.Sprintf("%s:%d", e.Name, e.Rank))
+	}
+	return out
+}
+
+func TestBuildLeaderboardPlayers(t *testing.T) {
+	player := func(name string, score, correct, incorrect int, reactions int, reactionTotal int64) *models.Player {
+		p := &models.Player{ID: "id-" + name, UserID: "id-" + name, Name: name, Score: score,
+			CorrectAnswers: correct, IncorrectAnswers: incorrect, Reactions: reactions, ReactionTotalMs: reactionTotal}
+		if reactions > 0 {
+			p.AvgReactionMs = reactionTotal / int64(reactions)
+		}
+		return p
+	}
+
+	tests := []struct {
+		name    string
+		players []*models.Player
+		want    []string
+	}{
+		{"by score", []*models.Player{
+			player("Ann", 5, 1, 0, 0, 0),
+			player("Bob", 10, 1, 0, 0, 0),
+		}, []string{"Bob:1", "Ann:2"}},
+		{"more correct answers", []*models.Player{
+			player("Ann", 10, 1, 0, 0, 0),
+			player("Bob", 10, 2, 0, 0, 0),
+		}, []string{"Bob:1", "Ann:2"}},
+		{"faster reaction", []*models.Player{
+			player("Ann", 10, 2, 0, 2, 3000),
+			player("Bob", 10, 2, 0, 2, 1000),
+		}, []string{"Bob:1", "Ann:2"}},
+		{"no reaction ranks after any reaction", []*models.Player{
+			player("Ann", 10, 2, 0, 0, 0),
+			player("Bob", 10, 2, 0, 1, 9000),
+		}, []string{"Bob:1", "Ann:2"}},
+		{"fewer incorrect answers", []*models.Player{
+			player("Ann", 10, 2, 3, 1, 500),
+			player("Bob", 10, 2, 1, 1, 500),
+		}, []string{"Bob:1", "Ann:2"}},
+		{"full tie shares a rank, by name", []*models.Player{
+			player("Cid", 10, 2, 1, 1, 500),
+			player("Ann", 10, 2, 1, 1, 500),
+			player("Bob", 3, 0, 0, 0, 0),
+		}, []string{"Ann:1", "Cid:1", "Bob:3"}},
+		{"shared rank skips the next", []*models.Player{
+			player("Ann", 7, 0, 0, 0, 0),
+			player("Bob", 7, 0, 0, 0, 0),
+			player("Cid", 7, 0, 0, 0, 0),
+			player("Dan", 1, 0, 0, 0, 0),
+		}, []string{"Ann:1", "Bob:1", "Cid:1", "Dan:4"}},
+		{"negative scores", []*models.Player{
+			player("Ann", -2, 0, 1, 0, 0),
+			player("Bob", 0, 0, 0, 0, 0),
+		}, []string{"Bob:1", "Ann:2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			room := &models.Room{Players: make(map[string]*models.Player)}
+			for _, p := range tt.players {
+				room.Players[p.ID] = p
+			}
+			if got := ranking(BuildLeaderboard(room).Players); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("players = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Teams add up their members' answers and reactions to break ties
+func TestBuildLeaderboardTeams(t *testing.T) {
+	room := &models.Room{
+		Players: map[string]*models.Player{
+			"u1": {ID: "u1", Name: "u1", CorrectAnswers: 2, Reactions: 2, ReactionTotalMs: 2000},
+			"u2": {ID: "u2", Name: "u2", CorrectAnswers: 1, IncorrectAnswers: 1, Reactions: 1, ReactionTotalMs: 4000},
+			"u3": {ID: "u3", Name: "u3", CorrectAnswers: 3, Reactions: 3, ReactionTotalMs: 3000},
+			"u4": {ID: "u4", Name: "u4", CorrectAnswers: 3, IncorrectAnswers: 1, Reactions: 3, ReactionTotalMs: 3000},
+		},
+		Teams: map[string]*models.Team{
+			"red":    {ID: "red", Name: "Red", Score: 20, Players: []string{"u1", "u2"}},    // 3 correct, 2000 ms
+			"blue":   {ID: "blue", Name: "Blue", Score: 20, Players: []string{"u3"}},        // 3 correct, 1000 ms
+			"green":  {ID: "green", Name: "Green", Score: 20, Players: []string{"u4"}},      // Blue but one incorrect
+			"yellow": {ID: "yellow", Name: "Yellow", Score: 20, Players: []string{"gone"}},  // Unknown members add nothing
+			"white":  {ID: "white", Name: "White", Score: 30, Players: nil},                 // Score comes first
+			"black":  {ID: "black", Name: "Black", Score: 20, Players: []string{"missing"}}, // Tied with Yellow
+		},
+	}
+
+	board := BuildLeaderboard(room)
+	want := []string{"White:1", "Blue:2", "Green:3", "Red:4", "Black:5", "Yellow:5"}
+	if got := ranking(board.Teams); !reflect.DeepEqual(got, want) {
+		t.Errorf("teams = %v, want %v", got, want)
+	}
+	for _, e := range board.Teams {
+		if e.Name == "Red" && (e.CorrectAnswers != 3 || e.IncorrectAnswers != 1 || e.AvgReactionMs != 2000) {
+			t.Errorf("Red = %+v, want the sums of its members", e)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"crypto/rand"
+	"time"
+
+	"powerpoint-quiz/internal/config"
+)
+
+// Options tunes the behaviour of the WebSocket service
+type Options struct {
+	// TimerTick is the interval between timer_tick broadcasts
+	TimerTick time.Duration
+	// BuzzWindow is how long after the first buzz other buzzes are still
+	// ranked by corrected client time; zero means first arrival wins
+	BuzzWindow time.Duration
+	// ClockSyncSamples is the number of pings in a clock sync round
+	ClockSyncSamples int
+	// SessionSecret signs player session tokens
+	SessionSecret []byte
+	// SessionTTL is how long a session token stays valid
+	SessionTTL time.Duration
+	// ReconnectGrace is how long a disconnected player may resume before
+	// they are considered gone
+	ReconnectGrace time.Duration
+	// ReplayBuffer is the number of recent room events kept per room so a
+	// resuming client can catch up
+	ReplayBuffer int
+	// SendBuffer is the number of outbound messages queued per client
+	SendBuffer int
+	// MaxDropped is how many messages a client may miss because its queue
+	// was full before it is disconnected; zero never disconnects
+	MaxDropped int
+	// SnapshotEvery is the number of state patches sent between two full
+	// state snapshots
+	SnapshotEvery int
+	// MaxMessageSize is the largest client message accepted once decoded
+	// to JSON; MessagePack grows when converted
+	MaxMessageSize int
+	// AdminTokenTTL is how long admin and host tokens stay valid
+	AdminTokenTTL time.Duration
+	// AuthMaxFailures is how many failed authentications an IP address may
+	// make within AuthLockout before its further attempts are refused for
+	// AuthLockout
+	AuthMaxFailures int
+	AuthLockout     time.Duration
+	// ConnRateLimits and IPRateLimits are the token buckets of each
+	// connection and of each address, by event type; see
+	// config.RateLimitConfig
+	ConnRateLimits map[string]config.RateLimit
+	IPRateLimits   map[string]config.RateLimit
+	// MaxRateStrikes is how many events in a row may be refused for rate
+	// limits before the connection is closed; zero never closes it
+	MaxRateStrikes int
+	// MaxRoomsPerIP caps the existing rooms created from one address; zero
+	// means no cap
+	MaxRoomsPerIP int
+}
+
+// DefaultOptions returns the options used when none are configured
+func DefaultOptions() Options {
+	return Options{
+		TimerTick:        time.Second,
+		BuzzWindow:       100 * time.Millisecond,
+		ClockSyncSamples: 5,
+		SessionSecret:    randomSecret(),
+		SessionTTL:       12 * time.Hour,
+		ReconnectGrace:   2 * time.Minute,
+		ReplayBuffer:     256,
+		SendBuffer:       256,
+		MaxDropped:       64,
+		SnapshotEvery:    50,
+		MaxMessageSize:   64 * 1024,
+		AdminTokenTTL:    12 * time.Hour,
+		AuthMaxFailures:  5,
+		AuthLockout:      15 * time.Minute,
+		ConnRateLimits: map[string]config.RateLimit{
+			"default":     {Rate: 20, Burst: 40},
+			"click":       {Rate: 10, Burst: 20},
+			"join":        {Rate: 1, Burst: 5},
+			"create_room": {Rate: 0.2, Burst: 3},
+		},
+		IPRateLimits: map[string]config.RateLimit{
+			"default":     {Rate: 200, Burst: 400},
+			"join":        {Rate: 20, Burst: 100},
+			"create_room": {Rate: 0.1, Burst: 10},
+			"rest":        {Rate: 10, Burst: 30},
+		},
+		MaxRateStrikes: 50,
+		MaxRoomsPerIP:  20,
+	}
+}
+
+// randomSecret returns a fresh 32-byte key; tokens signed with it do not
+// survive a restart
+func randomSecret() []byte {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic("crypto/rand failed: " + err.Error())
+	}
+	return secret
+}
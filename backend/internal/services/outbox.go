@@ -0,0 +1,132 @@
+package services
+
+import (
+	"encoding/json"
+	"log"
+
+	"powerpoint-quiz/internal/models"
+)
+
+// outboundEvent is a sequenced room event kept for replay
+type outboundEvent struct {
+	seq       int64
+	hostsOnly bool
+	message   *wireMessage // As the staff get it
+	public    *wireMessage // As everyone else gets it, when that differs
+}
+
+// messageFor returns the event as the staff or everyone else get it
+func (e outboundEvent) messageFor(hosts bool) *wireMessage {
+	if !hosts && e.public != nil {
+		return e.public
+	}
+	return e.message
+}
+
+// roomOutbox numbers a room's outbound events and keeps the most recent
+// ones in a ring buffer. State messages are numbered but not kept, since
+// each client gets its own view of the state.
+type roomOutbox struct {
+	seq     int64
+	ring    []outboundEvent
+	next    int   // Index the next event is written to once the ring is full
+	evicted int64 // Sequence number of the newest event pushed out of the ring
+}
+
+func (o *roomOutbox) add(e outboundEvent, size int) {
+	if len(o.ring) < size {
+		o.ring = append(o.ring, e)
+		return
+	}
+	o.evicted = o.ring[o.next].seq
+	o.ring[o.next] = e
+	o.next = (o.next + 1) % size
+}
+
+// since returns the buffered events after lastSeq in order, or false when
+// some of them are no longer buffered
+func (o *roomOutbox) since(lastSeq int64, hosts bool) ([]*wireMessage, bool) {
+	if lastSeq > o.seq || lastSeq < o.evicted {
+		return nil, false // From before a restart, or too long ago
+	}
+
+	var messages []*wireMessage
+	for i := range o.ring {
+		e := o.ring[(o.next+i)%len(o.ring)]
+		if e.seq <= lastSeq || (e.hostsOnly && !hosts) {
+			continue
+		}
+		messages = append(messages, e.messageFor(hosts))
+	}
+	return messages, true
+}
+
+// sequenceEvent gives a room event the room's next sequence number, encodes
+// it for the staff and, unless it is for the staff only, for everyone else,
+// and keeps it for replay
+func (ws *WebSocketService) sequenceEvent(room *models.Room, event models.Event, hostsOnly bool) (outboundEvent, error) {
+	o := &ws.actorOf(room).outbox
+	event.Seq = o.seq + 1
+	out := outboundEvent{seq: event.Seq, hostsOnly: hostsOnly}
+	message, err := json.Marshal(event)
+	if err != nil {
+		return out, err
+	}
+	out.message = newWireMessage(message)
+	if public, changed := publicEvent(room, event); changed && !hostsOnly {
+		if message, err = json.Marshal(public); err != nil {
+			return out, err
+		}
+		out.public = newWireMessage(message)
+	}
+	o.seq = event.Seq
+	o.add(out, ws.opts.ReplayBuffer)
+	return out, nil
+}
+
+// nextSeq numbers a room event that is not kept for replay
+func (ws *WebSocketService) nextSeq(room *models.Room) int64 {
+	o := &ws.actorOf(room).outbox
+	o.seq++
+	return o.seq
+}
+
+// roomSeq returns the sequence number of a room's latest outbound event
+func (ws *WebSocketService) roomSeq(room *models.Room) int64 {
+	return ws.actorOf(room).outbox.seq
+}
+
+// eventsSince returns the room events a client missed after lastSeq, or
+// false when they can no longer be replayed
+func (ws *WebSocketService) eventsSince(room *models.Room, lastSeq int64, hosts bool) ([]*wireMessage, bool) {
+	return ws.actorOf(room).outbox.since(lastSeq, hosts)
+}
+
+// catchUp brings a reconnected client up to date: the missed events after
+// lastSeq when they are all still buffered followed by the current state of
+// its view, otherwise a snapshot of that view. The room's timers follow
+// either way, since their ticks are never replayed.
+func (ws *WebSocketService) catchUp(client *models.Client, room *models.Room, resumeEvent models.Event, lastSeq int64) {
+	hosts := isStaff(client)
+	resumeEvent.Seq = ws.roomSeq(room)
+
+	if lastSeq > 0 {
+		if missed, ok := ws.eventsSince(room, lastSeq, hosts); ok {
+			resumeEvent.Message = "replay"
+			resumeEvent.Count = len(missed)
+			ws.sendEventToClient(client, resumeEvent)
+			for _, message := range missed {
+				ws.sendMessage(client, message)
+			}
+			ws.sendState(client, room)
+			ws.sendTimers(client, room)
+			log.Printf("Replayed %d events to %s in room %s", len(missed), client.UserID, room.Code)
+			return
+		}
+	}
+
+	resumeEvent.Message = "snapshot"
+	resumeEvent.Data = ws.viewData(room, client)
+	ws.sendEventToClient(client, resumeEvent)
+	ws.sendTimers(client, room)
+}
@@ -0,0 +1,239 @@
+package services
+
+import (
+	"encoding/json"
+	"sort"
+
+	"powerpoint-quiz/internal/models"
+)
+
+// viewOf returns the view of the room state a client may see: the staff see
+// everything, a connection bound to a player sees that player's view and
+// anyone else gets the display view
+func viewOf(client *models.Client) string {
+	switch {
+	case isStaff(client):
+		return models.ViewHost
+	case client.UserID != "":
+		return models.ViewPlayer
+	default:
+		return models.ViewDisplay
+	}
+}
+
+// projection is one view of a room state, encoded for sending and decoded
+// for diffing
+type projection struct {
+	encoded []byte
+	decoded interface{}
+}
+
+// projector builds the views of one room state, each at most once
+type projector struct {
+	ws          *WebSocketService
+	room        *models.Room
+	views       map[string]*projection // Keyed by view, and by user for players
+	leaderboard *models.Leaderboard
+}
+
+func (ws *WebSocketService) newProjector(room *models.Room) *projector {
+	return &projector{ws: ws, room: room, views: make(map[string]*projection)}
+}
+
+// project returns the view of the room state for a client, or nil if it
+// cannot be encoded
+func (p *projector) project(client *models.Client) *projection {
+	view := viewOf(client)
+	key := view
+	if view == models.ViewPlayer {
+		key += ":" + client.UserID
+	}
+	if cached, ok := p.views[key]; ok {
+		return cached
+	}
+
+	var value interface{}
+	switch view {
+	case models.ViewHost:
+		value = p.hostView()
+	case models.ViewPlayer:
+		value = p.playerView(client.UserID)
+	default:
+		value = p.displayView()
+	}
+	var proj *projection
+	if encoded, err := json.Marshal(value); err == nil {
+		proj = &projection{encoded: encoded}
+		if err := json.Unmarshal(encoded, &proj.decoded); err != nil {
+			proj = nil
+		}
+	}
+	p.views[key] = proj
+	return proj
+}
+
+func (p *projector) hostView() *models.HostView {
+	view := &models.HostView{Room: p.room, Timers: []*models.TimerState{}, DisplayCode: p.room.DisplayCode}
+	actor := p.ws.actorOf(p.room)
+	for _, kind := range []string{TimerQuestion, TimerStartDelay} {
+		if c := actor.timers[kind]; c != nil {
+			view.Timers = append(view.Timers, timerState(c))
+		}
+	}
+
+	connected := make(map[string]bool)
+	for client := range actor.clients {
+		if client.MemberID != "" {
+			connected[client.MemberID] = true
+		}
+	}
+	view.Members = make([]*models.Member, 0, len(p.room.Members))
+	for _, member := range p.room.Members {
+		shown := *member
+		shown.Connected = connected[member.ID]
+		view.Members = append(view.Members, &shown)
+	}
+	sort.Slice(view.Members, func(i, j int) bool {
+		return view.Members[i].JoinedAt.Before(view.Members[j].JoinedAt)
+	})
+	return view
+}
+
+func (p *projector) playerView(userID string) *models.PlayerView {
+	room := p.room
+	view := &models.PlayerView{
+		Code:            room.Code,
+		Phase:           room.Phase,
+		EnableAt:        room.EnableAt,
+		QuestionActive:  room.QuestionActive,
+		QuestionSeq:     room.QuestionSeq,
+		QuestionIndex:   room.QuestionIndex,
+		CurrentQuestion: room.CurrentQuestion,
+		AnswersLocked:   room.AnswersLocked,
+		Me:              room.Players[userID],
+		Team:            publicTeam(findPlayerTeam(room, userID)),
+		Answering:       room.FirstAnswerer == userID,
+		LockedOut:       containsString(room.LockedOut, userID),
+		Teams:           p.scoreboard(p.board().Teams, true),
+	}
+	for _, entry := range p.board().Players {
+		if entry.ID == userID {
+			view.Rank = entry.Rank
+		}
+	}
+	for i, id := range room.BuzzQueue {
+		if id == userID {
+			view.QueuePosition = i + 1
+		}
+	}
+	return view
+}
+
+func (p *projector) displayView() *models.DisplayView {
+	room := p.room
+	return &models.DisplayView{
+		Code:            room.Code,
+		Phase:           room.Phase,
+		EnableAt:        room.EnableAt,
+		QuestionActive:  room.QuestionActive,
+		QuestionSeq:     room.QuestionSeq,
+		QuestionIndex:   room.QuestionIndex,
+		CurrentQuestion: room.CurrentQuestion,
+		AnswerCount:     room.AnswerCount,
+		AnswersLocked:   room.AnswersLocked,
+		Players:         p.scoreboard(p.board().Players, false),
+		Teams:           p.scoreboard(p.board().Teams, true),
+	}
+}
+
+// board returns the room's leaderboard, ranked once per projector
+func (p *projector) board() *models.Leaderboard {
+	if p.leaderboard == nil {
+		p.leaderboard = BuildLeaderboard(p.room)
+	}
+	return p.leaderboard
+}
+
+// scoreboard turns leaderboard entries into scoreboard lines; team lines
+// get their team's color
+func (p *projector) scoreboard(entries []models.LeaderboardEntry, teams bool) []models.ScoreboardEntry {
+	lines := make([]models.ScoreboardEntry, 0, len(entries))
+	for _, entry := range entries {
+		line := models.ScoreboardEntry{Rank: entry.Rank, Name: entry.Name, Score: entry.Score}
+		if team, ok := p.room.Teams[entry.ID]; teams && ok {
+			line.Color = team.Color
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// publicTeam returns a copy of a team without its members' user IDs
+func publicTeam(team *models.Team) *models.Team {
+	if team == nil {
+		return nil
+	}
+	shown := *team
+	shown.Players = nil
+	return &shown
+}
+
+// publicEvent returns a room event as everyone but the staff sees it: user
+// IDs, which let a client act as or tell apart other players, are replaced
+// by display names. The second result is false when the event names no
+// player and so looks the same to everyone.
+func publicEvent(room *models.Room, event models.Event) (models.Event, bool) {
+	changed := false
+	if event.UserID != "" {
+		if event.PlayerName == "" {
+			event.PlayerName = playerName(room, event.UserID)
+		}
+		event.UserID = ""
+		changed = true
+	}
+
+	switch data := event.Data.(type) {
+	case *models.Player:
+		event.Data = nil
+		changed = true
+	case *models.Team:
+		event.Data = publicTeam(data)
+		changed = true
+	case *models.Leaderboard:
+		board := &models.Leaderboard{Teams: data.Teams, Players: make([]models.LeaderboardEntry, len(data.Players))}
+		for i, entry := range data.Players {
+			entry.ID = ""
+			board.Players[i] = entry
+		}
+		event.Data = board
+		changed = true
+	case *models.AnswerResults:
+		results := *data
+		if answerMode(room) == models.AnswerModePlayer {
+			results.Correct = make([]string, len(data.Correct))
+			for i, userID := range data.Correct {
+				results.Correct[i] = playerName(room, userID)
+			}
+		}
+		event.Data = &results
+		changed = true
+	case *models.ScoreAction:
+		action := *data
+		action.Deltas = make([]models.ScoreDelta, len(data.Deltas))
+		for i, delta := range data.Deltas {
+			delta.UserID = ""
+			action.Deltas[i] = delta
+		}
+		event.Data = &action
+		changed = true
+	}
+	return event, changed
+}
+
+// playerName returns the display name of a player of the room
+func playerName(room *models.Room, userID string) string {
+	if player, ok := room.Players[userID]; ok {
+		return player.Name
+	}
+	return ""
+}
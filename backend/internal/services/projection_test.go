@@ -0,0 +1,131 @@
+package services
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"powerpoint-quiz/internal/models"
+)
+
+func TestPublicEventHidesUserIDs(t *testing.T) {
+	room := &models.Room{
+		Code: "ROOM",
+		Players: map[string]*models.Player{
+			"secret-u1": {UserID: "secret-u1", Name: "Ann"},
+		},
+		Teams: map[string]*models.Team{},
+	}
+
+	tests := []struct {
+		name  string
+		event models.Event
+		want  string // Expected in the public JSON
+	}{
+		{
+			name:  "player joined",
+			event: models.Event{Type: models.EventPlayerJoined, UserID: "secret-u1", Data: room.Players["secret-u1"]},
+			want:  `"playerName":"Ann"`,
+		},
+		{
+			name:  "team joined",
+			event: models.Event{Type: models.EventTeamJoined, UserID: "secret-u1", TeamID: "t1", Data: &models.Team{ID: "t1", Players: []string{"secret-u1"}}},
+			want:  `"teamId":"t1"`,
+		},
+		{
+			name:  "answer received",
+			event: models.Event{Type: models.EventAnswerReceived, UserID: "secret-u1", Answer: "Paris"},
+			want:  `"answer":"Paris"`,
+		},
+		{
+			name:  "answer results",
+			event: models.Event{Type: models.EventAnswerResults, Data: &models.AnswerResults{Correct: []string{"secret-u1"}}},
+			want:  `"correct":["Ann"]`,
+		},
+		{
+			name: "leaderboard",
+			event: models.Event{Type: models.EventLeaderboard, Data: &models.Leaderboard{
+				Players: []models.LeaderboardEntry{{Rank: 1, ID: "secret-u1", Name: "Ann"}},
+			}},
+			want: `"name":"Ann"`,
+		},
+		{
+			name: "score changed",
+			event: models.Event{Type: models.EventScoreChanged, Data: &models.ScoreAction{
+				Deltas: []models.ScoreDelta{{UserID: "secret-u1", Points: 5}},
+			}},
+			want: `"points":5`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			staff, _ := json.Marshal(tt.event)
+			public, changed := publicEvent(room, tt.event)
+			if !changed {
+				t.Fatal("event was not projected")
+			}
+			encoded, err := json.Marshal(public)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(string(encoded), "secret-u1") {
+				t.Errorf("public event leaks a user ID: %s", encoded)
+			}
+			if !strings.Contains(string(encoded), tt.want) {
+				t.Errorf("public event %s lacks %s", encoded, tt.want)
+			}
+			// The staff's copy is left alone
+			if again, _ := json.Marshal(tt.event); string(again) != string(staff) {
+				t.Errorf("projection changed the staff event: %s", again)
+			}
+		})
+	}
+}
+
+func TestPublicEventKeepsAnonymousEvents(t *testing.T) {
+	room := &models.Room{Players: map[string]*models.Player{}}
+	event := models.Event{Type: models.EventPhaseChanged, Phase: models.PhaseActive}
+	if _, changed := publicEvent(room, event); changed {
+		t.Error("an event naming no player was projected")
+	}
+}
+
+// A player's view names no other player by user ID, not even teammates
+func TestPlayerViewHidesOtherUserIDs(t *testing.T) {
+	ws := newTestService(t)
+	admin := newTestClient(ws, "192.0.2.1")
+	code := createTestRoom(t, ws, admin, nil)
+	player := joinTestPlayer(t, ws, code, "secret-u1")
+	teammate := joinTestPlayer(t, ws, code, "secret-u2")
+	if err := dispatch(t, ws, admin, code, models.Event{Type: models.EventCreateTeam, TeamName: "Red"}); err != nil {
+		t.Fatal(err)
+	}
+	var teamID string
+	onRoom(t, ws, code, func(room *models.Room) {
+		for id := range room.Teams {
+			teamID = id
+		}
+	})
+	for _, client := range []*models.Client{player, teammate} {
+		if err := dispatch(t, ws, client, code, models.Event{Type: models.EventJoinTeam, TeamID: teamID}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	onRoom(t, ws, code, func(room *models.Room) {
+		encoded, err := json.Marshal(ws.viewData(room, player))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(encoded), "secret-u2") {
+			t.Errorf("player view leaks a teammate's user ID: %s", encoded)
+		}
+		if !strings.Contains(string(encoded), `"name":"Red"`) {
+			t.Errorf("player view lacks the team: %s", encoded)
+		}
+		if len(room.Teams[teamID].Players) != 2 {
+			t.Error("projection changed the room's team")
+		}
+	})
+}
@@ -0,0 +1,241 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"powerpoint-quiz/internal/models"
+)
+
+// Subprotocols lists the WebSocket subprotocols the server speaks, newest
+// first
+var Subprotocols = []string{models.SubprotocolV1JSON, models.SubprotocolV1MsgPack, models.SubprotocolV1}
+
+// ProtocolVersion returns the protocol version selected by the subprotocol
+// negotiated at connect time; none means the legacy protocol
+func ProtocolVersion(subprotocol string) int {
+	switch subprotocol {
+	case models.SubprotocolV1, models.SubprotocolV1JSON, models.SubprotocolV1MsgPack:
+		return models.ProtocolV1
+	}
+	return models.ProtocolLegacy
+}
+
+// EncodingOf returns the wire encoding selected by the subprotocol
+// negotiated at connect time
+func EncodingOf(subprotocol string) string {
+	if subprotocol == models.SubprotocolV1MsgPack {
+		return models.EncodingMsgPack
+	}
+	return models.EncodingJSON
+}
+
+// SupportsSubprotocol reports whether the server speaks any of the
+// subprotocols a client asked for
+func SupportsSubprotocol(requested []string) bool {
+	for _, name := range requested {
+		for _, supported := range Subprotocols {
+			if name == supported {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ProtocolError is a client message rejected before it reaches a handler
+type ProtocolError struct {
+	Code      string // One of models.ErrCode*
+	RequestID string
+	Message   string
+}
+
+func (e *ProtocolError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// DecodeEvent turns a client message into an event. Legacy messages are
+// flat events and only need to be JSON; v1 messages are envelopes whose
+// payload must match the command's payload type and validation rules.
+func DecodeEvent(message []byte, version int) (models.Event, *ProtocolError) {
+	var event models.Event
+	if version == models.ProtocolLegacy {
+		if err := json.Unmarshal(message, &event); err != nil {
+			return event, &ProtocolError{Code: models.ErrCodeBadMessage, Message: err.Error()}
+		}
+		return event, nil
+	}
+
+	var envelope models.Envelope
+	if err := decodeStrict(message, &envelope); err != nil {
+		// Still name the command if the message is JSON at all
+		json.Unmarshal(message, &envelope)
+		return event, &ProtocolError{Code: models.ErrCodeBadMessage, RequestID: envelope.RequestID, Message: err.Error()}
+	}
+	if err := validatePayload(reflect.ValueOf(envelope)); err != nil {
+		return event, &ProtocolError{Code: models.ErrCodeBadMessage, RequestID: envelope.RequestID, Message: err.Error()}
+	}
+	payloadType, ok := models.Commands[envelope.Type]
+	if !ok {
+		return event, &ProtocolError{
+			Code:      models.ErrCodeUnknownType,
+			RequestID: envelope.RequestID,
+			Message:   fmt.Sprintf("unknown command %q", envelope.Type),
+		}
+	}
+
+	payload := reflect.New(reflect.TypeOf(payloadType))
+	raw := envelope.Payload
+	if len(raw) == 0 || string(raw) == "null" {
+		raw = []byte("{}")
+	}
+	err := decodeStrict(raw, payload.Interface())
+	if err == nil {
+		err = validatePayload(payload.Elem())
+	}
+	if err != nil {
+		return event, &ProtocolError{Code: models.ErrCodeInvalidPayload, RequestID: envelope.RequestID, Message: err.Error()}
+	}
+
+	// Payload fields carry the JSON names of the event fields they fill
+	encoded, err := json.Marshal(payload.Interface())
+	if err == nil {
+		err = json.Unmarshal(encoded, &event)
+	}
+	if err != nil {
+		return event, &ProtocolError{Code: models.ErrCodeInvalidPayload, RequestID: envelope.RequestID, Message: err.Error()}
+	}
+	event.Type = envelope.Type
+	event.RequestID = envelope.RequestID
+	return event, nil
+}
+
+// decodeStrict decodes a single JSON value that may not have fields v does
+// not know
+func decodeStrict(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return errors.New("unexpected data after the message")
+	}
+	return nil
+}
+
+// fieldRules are the validation rules in a payload field's quiz tag
+type fieldRules struct {
+	required bool
+	max      int    // Maximum string length in characters, 0 if unlimited
+	min      *int64 // Minimum number
+	enum     []string
+}
+
+func rulesOf(field reflect.StructField) fieldRules {
+	var rules fieldRules
+	tag := field.Tag.Get("quiz")
+	if tag == "" {
+		return rules
+	}
+	for _, rule := range strings.Split(tag, ",") {
+		key, arg, _ := strings.Cut(rule, "=")
+		switch key {
+		case "required":
+			rules.required = true
+		case "max":
+			rules.max, _ = strconv.Atoi(arg)
+		case "min":
+			if n, err := strconv.ParseInt(arg, 10, 64); err == nil {
+				rules.min = &n
+			}
+		case "enum":
+			rules.enum = strings.Split(arg, "|")
+		}
+	}
+	return rules
+}
+
+// jsonName returns the JSON name of a struct field, "" if it is not encoded
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "-" || !field.IsExported() {
+		return ""
+	}
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// validatePayload checks the fields of a payload struct against their rules
+func validatePayload(v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := jsonName(field)
+		value := v.Field(i)
+		rules := rulesOf(field)
+
+		if rules.required && value.IsZero() {
+			return fmt.Errorf("%s is required", name)
+		}
+		switch value.Kind() {
+		case reflect.String:
+			s := value.String()
+			if rules.max > 0 && utf8.RuneCountInString(s) > rules.max {
+				return fmt.Errorf("%s is longer than %d characters", name, rules.max)
+			}
+			if len(rules.enum) > 0 && s != "" && !containsString(rules.enum, s) {
+				return fmt.Errorf("%s must be one of %s", name, strings.Join(rules.enum, ", "))
+			}
+		case reflect.Int, reflect.Int64:
+			if rules.min != nil && value.Int() < *rules.min {
+				return fmt.Errorf("%s must be at least %d", name, *rules.min)
+			}
+		}
+	}
+	return nil
+}
+
+// HandleMessage decodes a message from a client's read loop in the client's
+// protocol and handles it; a message the protocol rejects is refused like a
+// command, with a nack if it had a request id and an error event otherwise.
+// Every message, valid or not, counts against the rate limits first.
+func (ws *WebSocketService) HandleMessage(client *models.Client, message []byte) {
+	message, err := FromWire(client.Encoding, message)
+	if err == nil && len(message) > ws.opts.MaxMessageSize {
+		err = fmt.Errorf("message is longer than %d bytes", ws.opts.MaxMessageSize)
+	}
+	if err != nil {
+		if ws.admit(client, models.Event{}) {
+			log.Printf("Undecodable message from %s: %v", client.UserID, err)
+			ws.reply(client, models.Event{}, refuse(models.ErrCodeBadMessage, err.Error()))
+		}
+		return
+	}
+
+	event, protocolErr := DecodeEvent(message, client.Protocol)
+	if protocolErr != nil {
+		rejected := models.Event{RequestID: protocolErr.RequestID}
+		if ws.admit(client, rejected) {
+			log.Printf("Rejected message from %s: %v", client.UserID, protocolErr)
+			ws.reply(client, rejected, refuse(protocolErr.Code, protocolErr.Message))
+		}
+		return
+	}
+	if !ws.admit(client, event) {
+		return
+	}
+
+	log.Printf("Handling event: %+v", withoutCredentials(event))
+	ws.HandleEvent(client, event)
+}
@@ -0,0 +1,188 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"powerpoint-quiz/internal/models"
+)
+
+func TestDecodeEvent(t *testing.T) {
+	tests := []struct {
+		name      string
+		version   int
+		message   string
+		wantCode  string // "" when the message is accepted
+		wantReqID string
+		check     func(t *testing.T, event models.Event)
+	}{
+		{
+			name:      "v1 join",
+			version:   models.ProtocolV1,
+			message:   `{"type":"join","requestId":"r1","payload":{"quizId":"ABCD","userId":"u1","nickname":"Ann"}}`,
+			wantReqID: "r1",
+			check: func(t *testing.T, event models.Event) {
+				if event.Type != models.EventJoin || event.QuizID != "ABCD" || event.UserID != "u1" || event.Nickname != "Ann" {
+					t.Errorf("event = %+v", event)
+				}
+			},
+		},
+		{
+			name:    "v1 command without a payload",
+			version: models.ProtocolV1,
+			message: `{"type":"leave"}`,
+			check: func(t *testing.T, event models.Event) {
+				if event.Type != models.EventLeave {
+					t.Errorf("event = %+v", event)
+				}
+			},
+		},
+		{
+			name:    "legacy flat event",
+			version: models.ProtocolLegacy,
+			message: `{"type":"join","quizId":"ABCD","userId":"u1"}`,
+			check: func(t *testing.T, event models.Event) {
+				if event.Type != models.EventJoin || event.QuizID != "ABCD" || event.UserID != "u1" {
+					t.Errorf("event = %+v", event)
+				}
+			},
+		},
+		{
+			name:     "legacy not json",
+			version:  models.ProtocolLegacy,
+			message:  `{"type":`,
+			wantCode: models.ErrCodeBadMessage,
+		},
+		{
+			name:     "legacy event on a v1 connection",
+			version:  models.ProtocolV1,
+			message:  `{"type":"join","quizId":"ABCD","userId":"u1"}`,
+			wantCode: models.ErrCodeBadMessage,
+		},
+		{
+			name:     "not json",
+			version:  models.ProtocolV1,
+			message:  `join`,
+			wantCode: models.ErrCodeBadMessage,
+		},
+		{
+			name:     "trailing data",
+			version:  models.ProtocolV1,
+			message:  `{"type":"leave"} {"type":"leave"}`,
+			wantCode: models.ErrCodeBadMessage,
+		},
+		{
+			name:      "missing type",
+			version:   models.ProtocolV1,
+			message:   `{"requestId":"r2","payload":{}}`,
+			wantCode:  models.ErrCodeBadMessage,
+			wantReqID: "r2",
+		},
+		{
+			name:      "request id too long is still echoed",
+			version:   models.ProtocolV1,
+			message:   `{"type":"leave","requestId":"` + strings.Repeat("x", 65) + `"}`,
+			wantCode:  models.ErrCodeBadMessage,
+			wantReqID: strings.Repeat("x", 65),
+		},
+		{
+			name:      "unknown type",
+			version:   models.ProtocolV1,
+			message:   `{"type":"self_destruct","requestId":"r3"}`,
+			wantCode:  models.ErrCodeUnknownType,
+			wantReqID: "r3",
+		},
+		{
+			name:     "server event sent by a client",
+			version:  models.ProtocolV1,
+			message:  `{"type":"join_success"}`,
+			wantCode: models.ErrCodeUnknownType,
+		},
+		{
+			name:      "missing required field",
+			version:   models.ProtocolV1,
+			message:   `{"type":"join","requestId":"r4","payload":{"quizId":"ABCD"}}`,
+			wantCode:  models.ErrCodeInvalidPayload,
+			wantReqID: "r4",
+		},
+		{
+			name:     "unknown payload field",
+			version:  models.ProtocolV1,
+			message:  `{"type":"leave","payload":{"userId":"u1"}}`,
+			wantCode: models.ErrCodeInvalidPayload,
+		},
+		{
+			name:     "wrong field type",
+			version:  models.ProtocolV1,
+			message:  `{"type":"resume","payload":{"lastSeq":"7"}}`,
+			wantCode: models.ErrCodeInvalidPayload,
+		},
+		{
+			name:     "string too long",
+			version:  models.ProtocolV1,
+			message:  `{"type":"join","payload":{"quizId":"ABCD","userId":"u1","nickname":"` + strings.Repeat("é", 65) + `"}}`,
+			wantCode: models.ErrCodeInvalidPayload,
+		},
+		{
+			name:     "number below the minimum",
+			version:  models.ProtocolV1,
+			message:  `{"type":"resume","payload":{"lastSeq":-1}}`,
+			wantCode: models.ErrCodeInvalidPayload,
+		},
+		{
+			name:     "value not in the enum",
+			version:  models.ProtocolV1,
+			message:  `{"type":"host_set_state","payload":{"phase":"paused"}}`,
+			wantCode: models.ErrCodeInvalidPayload,
+		},
+		{
+			name:    "value in the enum",
+			version: models.ProtocolV1,
+			message: `{"type":"host_set_state","payload":{"phase":"active","delayMs":500}}`,
+			check: func(t *testing.T, event models.Event) {
+				if event.Phase != models.PhaseActive || event.DelayMs != 500 {
+					t.Errorf("event = %+v", event)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, perr := DecodeEvent([]byte(tt.message), tt.version)
+			if tt.wantCode == "" {
+				if perr != nil {
+					t.Fatalf("rejected: %v", perr)
+				}
+				if event.RequestID != tt.wantReqID {
+					t.Errorf("request id = %q, want %q", event.RequestID, tt.wantReqID)
+				}
+				if tt.check != nil {
+					tt.check(t, event)
+				}
+				return
+			}
+			if perr == nil {
+				t.Fatalf("accepted as %+v, want %s", event, tt.wantCode)
+			}
+			if perr.Code != tt.wantCode || perr.RequestID != tt.wantReqID {
+				t.Errorf("error = %s (request %q), want %s (request %q)", perr, perr.RequestID, tt.wantCode, tt.wantReqID)
+			}
+		})
+	}
+}
+
+func TestProtocolVersion(t *testing.T) {
+	tests := map[string]int{
+		models.SubprotocolV1:        models.ProtocolV1,
+		models.SubprotocolV1JSON:    models.ProtocolV1,
+		models.SubprotocolV1MsgPack: models.ProtocolV1,
+		"":                          models.ProtocolLegacy,
+		"quiz.v2":                   models.ProtocolLegacy,
+	}
+	for subprotocol, want := range tests {
+		if got := ProtocolVersion(subprotocol); got != want {
+			t.Errorf("ProtocolVersion(%q) = %d, want %d", subprotocol, got, want)
+		}
+	}
+}
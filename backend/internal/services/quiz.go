@@ -0,0 +1,360 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+
+	"powerpoint-quiz/internal/models"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ParseQuiz decodes a quiz definition in "json", "yaml" or "csv" format and
+// validates it
+func ParseQuiz(data []byte, format string) (*models.Quiz, error) {
+	var quiz *models.Quiz
+	var err error
+
+	format = strings.ToLower(format)
+	if format == "" {
+		format = "json"
+	}
+	switch format {
+	case "json":
+		quiz = &models.Quiz{}
+		err = json.Unmarshal(data, quiz)
+	case "yaml", "yml":
+		quiz = &models.Quiz{}
+		err = yaml.Unmarshal(data, quiz)
+	case "csv":
+		quiz, err = parseQuizCSV(data)
+	default:
+		return nil, fmt.Errorf("unsupported quiz format %q", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s quiz: %w", format, err)
+	}
+
+	if err := normalizeQuiz(quiz); err != nil {
+		return nil, err
+	}
+	return quiz, nil
+}
+
+// QuizFormatFromContentType maps a request Content-Type to a quiz format
+func QuizFormatFromContentType(contentType string) string {
+	switch {
+	case strings.Contains(contentType, "yaml"):
+		return "yaml"
+	case strings.Contains(contentType, "csv"):
+		return "csv"
+	default:
+		return "json"
+	}
+}
+
+// parseQuizCSV reads one question per row. The first row is a header naming
+// the columns: text, type, options (separated by "|"), correctAnswer, points,
+// timeLimit, media and optionally id.
+func parseQuizCSV(data []byte) (*models.Quiz, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		key := strings.ToLower(strings.NewReplacer("_", "", " ", "").Replace(strings.TrimSpace(name)))
+		switch key {
+		case "question":
+			key = "text"
+		case "answer":
+			key = "correctanswer"
+		}
+		columns[key] = i
+	}
+	if _, ok := columns["text"]; !ok {
+		return nil, fmt.Errorf("header has no text column")
+	}
+
+	quiz := &models.Quiz{}
+	for row := 2; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		q := models.Question{
+			ID:            field("id"),
+			Text:          field("text"),
+			Type:          models.QuestionType(field("type")),
+			CorrectAnswer: field("correctanswer"),
+			Media:         field("media"),
+		}
+		if options := field("options"); options != "" {
+			for _, text := range strings.Split(options, "|") {
+				q.Options = append(q.Options, models.QuestionOption{Text: strings.TrimSpace(text)})
+			}
+		}
+		if q.Points, err = atoiOrZero(field("points")); err != nil {
+			return nil, fmt.Errorf("row %d: invalid points: %w", row, err)
+		}
+		if q.TimeLimit, err = atoiOrZero(field("timelimit")); err != nil {
+			return nil, fmt.Errorf("row %d: invalid time limit: %w", row, err)
+		}
+		quiz.Questions = append(quiz.Questions, q)
+	}
+	return quiz, nil
+}
+
+func atoiOrZero(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(s)
+}
+
+// normalizeQuiz fills in defaults (IDs, types, option IDs) and rejects
+// definitions the server cannot grade
+func normalizeQuiz(quiz *models.Quiz) error {
+	if len(quiz.Questions) == 0 {
+		return fmt.Errorf("quiz has no questions")
+	}
+	switch quiz.AnswerMode {
+	case "", models.AnswerModePlayer, models.AnswerModeTeam:
+	default:
+		return fmt.Errorf("unknown answer mode %q", quiz.AnswerMode)
+	}
+	if err := validateScoringRules(quiz.Scoring); err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool, len(quiz.Questions))
+	for i := range quiz.Questions {
+		q := &quiz.Questions[i]
+		n := i + 1
+
+		if q.ID == "" {
+			q.ID = fmt.Sprintf("q%d", n)
+		}
+		if seen[q.ID] {
+			return fmt.Errorf("question %d: duplicate id %q", n, q.ID)
+		}
+		seen[q.ID] = true
+
+		if strings.TrimSpace(q.Text) == "" {
+			return fmt.Errorf("question %d: text is required", n)
+		}
+		if q.Points < 0 {
+			return fmt.Errorf("question %d: points must not be negative", n)
+		}
+		if q.TimeLimit < 0 {
+			return fmt.Errorf("question %d: time limit must not be negative", n)
+		}
+		if err := validateScoringRules(q.Scoring); err != nil {
+			return fmt.Errorf("question %d: %w", n, err)
+		}
+
+		if q.Type == "" {
+			if len(q.Options) > 0 {
+				q.Type = models.QuestionMultipleChoice
+			} else {
+				q.Type = models.QuestionBuzzer
+			}
+		}
+
+		switch q.Type {
+		case models.QuestionMultipleChoice:
+			if err := normalizeOptions(q); err != nil {
+				return fmt.Errorf("question %d: %w", n, err)
+			}
+		case models.QuestionText:
+			if q.CorrectAnswer == "" {
+				return fmt.Errorf("question %d: text questions need a correct answer", n)
+			}
+		case models.QuestionBuzzer:
+		default:
+			return fmt.Errorf("question %d: unknown type %q", n, q.Type)
+		}
+	}
+	return nil
+}
+
+// normalizeOptions assigns option IDs A, B, C... where missing and resolves
+// the correct answer to an option ID
+func normalizeOptions(q *models.Question) error {
+	if len(q.Options) < 2 {
+		return fmt.Errorf("multiple choice needs at least 2 options")
+	}
+	if len(q.Options) > 26 {
+		return fmt.Errorf("too many options")
+	}
+
+	ids := make(map[string]bool, len(q.Options))
+	for i := range q.Options {
+		opt := &q.Options[i]
+		if opt.ID == "" {
+			opt.ID = string(rune('A' + i))
+		}
+		if ids[opt.ID] {
+			return fmt.Errorf("duplicate option id %q", opt.ID)
+		}
+		ids[opt.ID] = true
+	}
+
+	opt := findOption(q, q.CorrectAnswer)
+	if opt == nil {
+		return fmt.Errorf("correct answer %q is not one of the options", q.CorrectAnswer)
+	}
+	q.CorrectAnswer = opt.ID
+	return nil
+}
+
+// findOption matches an option by ID or by its text
+func findOption(q *models.Question, answer string) *models.QuestionOption {
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		return nil
+	}
+	for i := range q.Options {
+		if strings.EqualFold(q.Options[i].ID, answer) {
+			return &q.Options[i]
+		}
+	}
+	for i := range q.Options {
+		if normalizeAnswer(q.Options[i].Text) == normalizeAnswer(answer) {
+			return &q.Options[i]
+		}
+	}
+	return nil
+}
+
+// GradeAnswer reports whether an answer is correct for a question. Text and
+// buzzer answers are compared ignoring case and extra spaces; several
+// accepted answers can be separated with "|".
+func GradeAnswer(q *models.Question, answer string) bool {
+	if q.Type == models.QuestionMultipleChoice {
+		opt := findOption(q, answer)
+		return opt != nil && opt.ID == q.CorrectAnswer
+	}
+
+	given := normalizeAnswer(answer)
+	if given == "" {
+		return false
+	}
+	for _, accepted := range strings.Split(q.CorrectAnswer, "|") {
+		if normalizeAnswer(accepted) == given {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeAnswer(s string) string {
+	return strings.Join(strings.Fields(strings.ToLower(s)), " ")
+}
+
+// quizFromEvent returns the quiz carried by an event, either structured or as
+// raw text; nil when the event has none
+func quizFromEvent(event models.Event) (*models.Quiz, error) {
+	if event.Quiz != nil {
+		if err := normalizeQuiz(event.Quiz); err != nil {
+			return nil, err
+		}
+		return event.Quiz, nil
+	}
+	if event.QuizSource != "" {
+		return ParseQuiz([]byte(event.QuizSource), event.QuizFormat)
+	}
+	return nil, nil
+}
+
+// publicQuestion returns a copy of a question that is safe to send to players
+func publicQuestion(q *models.Question) *models.Question {
+	public := *q
+	public.CorrectAnswer = ""
+	public.Options = append([]models.QuestionOption(nil), q.Options...)
+	return &public
+}
+
+// currentQuizQuestion returns the full definition of the running question,
+// or nil when no prepared question is in play
+func currentQuizQuestion(room *models.Room) *models.Question {
+	if room.Quiz == nil || room.CurrentQuestion == nil {
+		return nil
+	}
+	if room.QuestionIndex < 0 || room.QuestionIndex >= len(room.Quiz.Questions) {
+		return nil
+	}
+	return &room.Quiz.Questions[room.QuestionIndex]
+}
+
+// questionIndex finds a question by ID
+func questionIndex(quiz *models.Quiz, id string) int {
+	for i, q := range quiz.Questions {
+		if q.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// handleLoadQuiz attaches a quiz definition to a room
+func (ws *WebSocketService) handleLoadQuiz(client *models.Client, room *models.Room, event models.Event) error {
+	quiz, err := quizFromEvent(event)
+	if err != nil {
+		return refuse(models.ErrCodeInvalidArgument, err.Error())
+	}
+	if quiz == nil {
+		return refuse(models.ErrCodeInvalidArgument, "Quiz definition is required")
+	}
+
+	ws.loadQuiz(room, client.Role, quiz)
+	return nil
+}
+
+// LoadQuiz attaches a quiz definition to a room on behalf of the REST API
+func (ws *WebSocketService) LoadQuiz(room *models.Room, quiz *models.Quiz) {
+	ws.call(room.Code, func(a *roomActor) {
+		ws.loadQuiz(room, "admin", quiz)
+		ws.saveRoom(room)
+	})
+}
+
+// loadQuiz records the quiz and announces it
+func (ws *WebSocketService) loadQuiz(room *models.Room, role string, quiz *models.Quiz) {
+	ws.commit(room, role, models.Event{
+		Type: models.EventLoadQuiz,
+		Quiz: quiz,
+	})
+	log.Printf("Quiz %q with %d questions loaded in room %s", quiz.Title, len(quiz.Questions), room.Code)
+
+	quizLoadedEvent := models.Event{
+		Type:    models.EventQuizLoaded,
+		Message: quiz.Title,
+		Data: map[string]interface{}{
+			"title":         quiz.Title,
+			"questionCount": len(quiz.Questions),
+		},
+	}
+	ws.broadcastToRoom(room, quizLoadedEvent)
+	ws.broadcastRoomState(room)
+}
@@ -0,0 +1,266 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"powerpoint-quiz/internal/models"
+)
+
+func TestParseQuiz(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		data    string
+		wantErr string // Substring of the error, "" when the quiz is valid
+		check   func(t *testing.T, quiz *models.Quiz)
+	}{
+		{
+			name:   "json",
+			format: "json",
+			data: `{"title":"Geo","answerMode":"team","questions":[
+				{"text":"Capital of France?","options":[{"text":"Paris"},{"text":"Rome"}],"correctAnswer":"Paris","points":5},
+				{"text":"Buzz!"}]}`,
+			check: func(t *testing.T, quiz *models.Quiz) {
+				q := quiz.Questions[0]
+				if quiz.AnswerMode != models.AnswerModeTeam || q.ID != "q1" || q.Type != models.QuestionMultipleChoice {
+					t.Errorf("quiz = %+v", quiz)
+				}
+				if q.Options[0].ID != "A" || q.Options[1].ID != "B" || q.CorrectAnswer != "A" {
+					t.Errorf("options = %+v, correct = %q", q.Options, q.CorrectAnswer)
+				}
+				if quiz.Questions[1].Type != models.QuestionBuzzer {
+					t.Errorf("question without options has type %q", quiz.Questions[1].Type)
+				}
+			},
+		},
+		{
+			name:   "empty format is json",
+			format: "",
+			data:   `{"questions":[{"text":"Buzz!"}]}`,
+		},
+		{
+			name:   "yaml",
+			format: "yml",
+			data: `title: Geo
+questions:
+  - id: cap
+    text: Capital of Italy?
+    options:
+      - {id: x, text: Paris}
+      - {id: y, text: Rome}
+    correctAnswer: y
+    timeLimit: 20
+  - text: Largest ocean?
+    type: text
+    correctAnswer: Pacific
+`,
+			check: func(t *testing.T, quiz *models.Quiz) {
+				q := quiz.Questions[0]
+				if q.ID != "cap" || q.CorrectAnswer != "y" || q.TimeLimit != 20 {
+					t.Errorf("question = %+v", q)
+				}
+				if quiz.Questions[1].Type != models.QuestionText {
+					t.Errorf("second question has type %q", quiz.Questions[1].Type)
+				}
+			},
+		},
+		{
+			name:   "csv",
+			format: "csv",
+			data: `Question,Type,Options,Answer,Points,Time_Limit
+"Capital of France?",multiple_choice,"Paris | Rome | Berlin",Rome,3,15
+Buzz!,,,,,
+`,
+			check: func(t *testing.T, quiz *models.Quiz) {
+				q := quiz.Questions[0]
+				if len(q.Options) != 3 || q.Options[2].Text != "Berlin" || q.Options[2].ID != "C" {
+					t.Errorf("options = %+v", q.Options)
+				}
+				if q.CorrectAnswer != "B" || q.Points != 3 || q.TimeLimit != 15 {
+					t.Errorf("question = %+v", q)
+				}
+				if quiz.Questions[1].Type != models.QuestionBuzzer {
+					t.Errorf("second question has type %q", quiz.Questions[1].Type)
+				}
+			},
+		},
+		{
+			name:    "unsupported format",
+			format:  "xml",
+			data:    `<quiz/>`,
+			wantErr: "unsupported quiz format",
+		},
+		{
+			name:    "malformed json",
+			format:  "json",
+			data:    `{"questions":[`,
+			wantErr: "invalid json quiz",
+		},
+		{
+			name:    "malformed yaml",
+			format:  "yaml",
+			data:    "questions:\n  - text: [unclosed\n",
+			wantErr: "invalid yaml quiz",
+		},
+		{
+			name:    "csv without a text column",
+			format:  "csv",
+			data:    "type,options\nbuzzer,\n",
+			wantErr: "no text column",
+		},
+		{
+			name:    "csv with bad points",
+			format:  "csv",
+			data:    "text,points\nBuzz!,many\n",
+			wantErr: "row 2: invalid points",
+		},
+		{
+			name:    "csv with an unterminated quote",
+			format:  "csv",
+			data:    "text\n\"Buzz!\n",
+			wantErr: "invalid csv quiz",
+		},
+		{
+			name:    "no questions",
+			format:  "json",
+			data:    `{"questions":[]}`,
+			wantErr: "no questions",
+		},
+		{
+			name:    "missing text",
+			format:  "json",
+			data:    `{"questions":[{"text":"  "}]}`,
+			wantErr: "question 1: text is required",
+		},
+		{
+			name:    "duplicate question id",
+			format:  "json",
+			data:    `{"questions":[{"id":"a","text":"1"},{"id":"a","text":"2"}]}`,
+			wantErr: `question 2: duplicate id "a"`,
+		},
+		{
+			name:    "negative points",
+			format:  "json",
+			data:    `{"questions":[{"text":"1","points":-1}]}`,
+			wantErr: "points must not be negative",
+		},
+		{
+			name:    "unknown type",
+			format:  "json",
+			data:    `{"questions":[{"text":"1","type":"essay"}]}`,
+			wantErr: `unknown type "essay"`,
+		},
+		{
+			name:    "unknown answer mode",
+			format:  "json",
+			data:    `{"answerMode":"everyone","questions":[{"text":"1"}]}`,
+			wantErr: "unknown answer mode",
+		},
+		{
+			name:    "one option",
+			format:  "json",
+			data:    `{"questions":[{"text":"1","options":[{"text":"a"}],"correctAnswer":"a"}]}`,
+			wantErr: "at least 2 options",
+		},
+		{
+			name:    "duplicate option id",
+			format:  "json",
+			data:    `{"questions":[{"text":"1","options":[{"id":"a","text":"x"},{"id":"a","text":"y"}],"correctAnswer":"a"}]}`,
+			wantErr: `duplicate option id "a"`,
+		},
+		{
+			name:    "answer is not an option",
+			format:  "json",
+			data:    `{"questions":[{"text":"1","options":[{"id":"a","text":"x"},{"id":"b","text":"y"}],"correctAnswer":"c"}]}`,
+			wantErr: `correct answer "c" is not one of the options`,
+		},
+		{
+			name:    "csv answer is not an option",
+			format:  "csv",
+			data:    "text,options,answer\nCapital?,Paris|Rome,Berlin\n",
+			wantErr: "not one of the options",
+		},
+		{
+			name:    "text question without an answer",
+			format:  "json",
+			data:    `{"questions":[{"text":"1","type":"text"}]}`,
+			wantErr: "text questions need a correct answer",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quiz, err := ParseQuiz([]byte(tt.data), tt.format)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.check != nil {
+				tt.check(t, quiz)
+			}
+		})
+	}
+}
+
+func TestQuizFormatFromContentType(t *testing.T) {
+	tests := map[string]string{
+		"application/json":         "json",
+		"application/x-yaml":       "yaml",
+		"text/yaml; charset=utf-8": "yaml",
+		"text/csv":                 "csv",
+		"":                         "json",
+		"application/octet-stream": "json",
+	}
+	for contentType, want := range tests {
+		if got := QuizFormatFromContentType(contentType); got != want {
+			t.Errorf("QuizFormatFromContentType(%q) = %q, want %q", contentType, got, want)
+		}
+	}
+}
+
+func TestGradeAnswer(t *testing.T) {
+	choice := &models.Question{
+		Type:          models.QuestionMultipleChoice,
+		Options:       []models.QuestionOption{{ID: "A", Text: "Berlin"}, {ID: "B", Text: "Paris"}},
+		CorrectAnswer: "B",
+	}
+	text := &models.Question{Type: models.QuestionText, CorrectAnswer: "Pacific Ocean | Pacific"}
+	buzzer := &models.Question{Type: models.QuestionBuzzer, CorrectAnswer: "Ada  Lovelace"}
+
+	tests := []struct {
+		name     string
+		question *models.Question
+		answer   string
+		want     bool
+	}{
+		{"option id", choice, "B", true},
+		{"option id in lower case", choice, " b ", true},
+		{"option text", choice, "paris", true},
+		{"wrong option", choice, "A", false},
+		{"wrong option text", choice, "Berlin", false},
+		{"unknown option", choice, "C", false},
+		{"empty choice", choice, "", false},
+		{"text exact", text, "Pacific", true},
+		{"text case and spaces", text, "  pacific   OCEAN ", true},
+		{"text other accepted answer", text, "pacific ocean", true},
+		{"text wrong", text, "Atlantic", false},
+		{"text part of an answer", text, "Ocean", false},
+		{"text empty", text, "   ", false},
+		{"buzzer answer spaces", buzzer, "ada lovelace", true},
+		{"buzzer wrong", buzzer, "Grace Hopper", false},
+		{"no correct answer set", &models.Question{Type: models.QuestionText}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := GradeAnswer(tt.question, tt.answer); got != tt.want {
+				t.Errorf("GradeAnswer(%q) = %v, want %v", tt.answer, got, tt.want)
+			}
+		})
+	}
+}
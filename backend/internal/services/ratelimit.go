@@ -0,0 +1,156 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"powerpoint-quiz/internal/config"
+	"powerpoint-quiz/internal/models"
+
+	"github.com/gorilla/websocket"
+)
+
+// CloseRateLimited is the close code sent to a client that kept sending
+// faster than its rate limits allow
+const CloseRateLimited = websocket.CloseTryAgainLater
+
+// Rate limit names besides the event types
+const (
+	limitDefault = "default" // Event types without their own limit
+	limitREST    = "rest"    // REST API calls
+)
+
+// bucket is a token bucket of one key and limit
+type bucket struct {
+	limit  config.RateLimit
+	tokens float64
+	last   time.Time
+}
+
+// refill adds the tokens earned since the last update
+func (b *bucket) refill(now time.Time) {
+	b.tokens = math.Min(float64(b.limit.Burst), b.tokens+now.Sub(b.last).Seconds()*b.limit.Rate)
+	b.last = now
+}
+
+// rateLimiter keeps token buckets per key, such as a connection or an
+// address, and limit. Read loops and REST handlers use it concurrently.
+type rateLimiter struct {
+	mu      sync.Mutex
+	limits  map[string]config.RateLimit
+	buckets map[string]*bucket // Keyed by key and limit name
+	pruned  time.Time
+}
+
+func newRateLimiter(limits map[string]config.RateLimit) *rateLimiter {
+	return &rateLimiter{
+		limits:  limits,
+		buckets: make(map[string]*bucket),
+		pruned:  time.Now(),
+	}
+}
+
+// limitFor returns the name and limit that cover a kind of request
+func (l *rateLimiter) limitFor(kind string) (string, config.RateLimit) {
+	if limit, ok := l.limits[kind]; ok {
+		return kind, limit
+	}
+	return limitDefault, l.limits[limitDefault]
+}
+
+// allow takes a token from key's bucket for a kind of request, reporting
+// false if it is empty. Kinds without a limit are always allowed.
+func (l *rateLimiter) allow(key, kind string) bool {
+	name, limit := l.limitFor(kind)
+	if limit.Rate <= 0 {
+		return true
+	}
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.pruned) > time.Minute {
+		l.prune(now)
+	}
+	id := key + " " + name
+	b := l.buckets[id]
+	if b == nil {
+		b = &bucket{limit: limit, tokens: float64(limit.Burst), last: now}
+		l.buckets[id] = b
+	}
+	b.refill(now)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// forget drops the buckets of a key that will not be used again, such as a
+// closed connection's
+func (l *rateLimiter) forget(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for name := range l.limits {
+		delete(l.buckets, key+" "+name)
+	}
+}
+
+// prune drops the buckets that have filled up again; a new bucket is full
+// too, so nothing is lost
+func (l *rateLimiter) prune(now time.Time) {
+	for id, b := range l.buckets {
+		if b.refill(now); b.tokens >= float64(b.limit.Burst) {
+			delete(l.buckets, id)
+		}
+	}
+	l.pruned = now
+}
+
+// connKey is the rate limit key of a connection. Client IDs are never
+// reused, unlike the addresses of freed clients.
+func connKey(client *models.Client) string {
+	return fmt.Sprintf("conn:%d", client.ID)
+}
+
+// admit takes a token for an event from the buckets of the client and of
+// its address. A refused event is answered with rate_limited; a client whose
+// events keep being refused is disconnected.
+func (ws *WebSocketService) admit(client *models.Client, event models.Event) bool {
+	kind := string(event.Type)
+	if ws.connLimits.allow(connKey(client), kind) && ws.ipLimits.allow("ip:"+client.IP, kind) {
+		client.RateStrikes = 0
+		return true
+	}
+
+	client.RateStrikes++
+	if ws.opts.MaxRateStrikes > 0 && client.RateStrikes >= ws.opts.MaxRateStrikes {
+		log.Printf("Client %s from %s exceeded its rate limits %d times, disconnecting", client.UserID, client.IP, client.RateStrikes)
+		ws.disconnect(client, CloseRateLimited)
+		return false
+	}
+	if client.RateStrikes == 1 {
+		log.Printf("Rate limiting %s from %s", kind, client.IP)
+	}
+	ws.reply(client, event, refuse(models.ErrCodeRateLimited, "Too many messages, slow down"))
+	return false
+}
+
+// AllowREST takes a token for a REST API call from the address's bucket
+func (ws *WebSocketService) AllowREST(ip string) bool {
+	return ws.ipLimits.allow("ip:"+ip, limitREST)
+}
+
+// roomsCreatedBy counts the existing rooms created from an address
+func (ws *WebSocketService) roomsCreatedBy(ip string) int {
+	count := 0
+	for _, room := range ws.store.List() {
+		if room.CreatorIP == ip {
+			count++
+		}
+	}
+	return count
+}
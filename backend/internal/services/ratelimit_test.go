@@ -0,0 +1,121 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"powerpoint-quiz/internal/config"
+	"powerpoint-quiz/internal/models"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	limits := map[string]config.RateLimit{
+		limitDefault: {Rate: 1, Burst: 3},
+		"join":       {Rate: 1, Burst: 1},
+		"click":      {Rate: 0, Burst: 0}, // Unlimited
+	}
+
+	tests := []struct {
+		name     string
+		requests []string // key/kind pairs, in order
+		want     []bool
+	}{
+		{
+			name:     "burst then refused",
+			requests: []string{"c1/answer", "c1/answer", "c1/answer", "c1/answer"},
+			want:     []bool{true, true, true, false},
+		},
+		{
+			name:     "kinds without a limit share the default bucket",
+			requests: []string{"c1/answer", "c1/leave", "c1/pong", "c1/answer"},
+			want:     []bool{true, true, true, false},
+		},
+		{
+			name:     "own limit",
+			requests: []string{"c1/join", "c1/join", "c1/answer"},
+			want:     []bool{true, false, true},
+		},
+		{
+			name:     "keys are independent",
+			requests: []string{"c1/join", "c2/join", "c1/join"},
+			want:     []bool{true, true, false},
+		},
+		{
+			name:     "unlimited kind",
+			requests: []string{"c1/click", "c1/click", "c1/click", "c1/click", "c1/click"},
+			want:     []bool{true, true, true, true, true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newRateLimiter(limits)
+			for i, request := range tt.requests {
+				key, kind, _ := strings.Cut(request, "/")
+				if got := l.allow(key, kind); got != tt.want[i] {
+					t.Errorf("request %d (%s) allowed = %v, want %v", i, request, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimiterRefills(t *testing.T) {
+	l := newRateLimiter(map[string]config.RateLimit{limitDefault: {Rate: 2, Burst: 2}})
+	l.allow("c1", "answer")
+	l.allow("c1", "answer")
+	if l.allow("c1", "answer") {
+		t.Fatal("empty bucket allowed a request")
+	}
+
+	// Half a second at 2 tokens a second earns one token
+	l.buckets["c1 "+limitDefault].last = time.Now().Add(-500 * time.Millisecond)
+	if !l.allow("c1", "answer") {
+		t.Error("refilled bucket refused a request")
+	}
+	if l.allow("c1", "answer") {
+		t.Error("bucket refilled more than it earned")
+	}
+}
+
+// Buckets that filled up again are dropped
+func TestRateLimiterPrunes(t *testing.T) {
+	l := newRateLimiter(map[string]config.RateLimit{limitDefault: {Rate: 1, Burst: 1}})
+	l.allow("c1", "answer")
+	l.buckets["c1 "+limitDefault].last = time.Now().Add(-time.Hour)
+	l.prune(time.Now())
+	if len(l.buckets) != 0 {
+		t.Errorf("%d buckets left after pruning", len(l.buckets))
+	}
+}
+
+// A closed connection's buckets go with it, and a new connection never
+// inherits them
+func TestConnBucketsForgotten(t *testing.T) {
+	ws := newTestService(t)
+	ws.connLimits = newRateLimiter(map[string]config.RateLimit{limitDefault: {Rate: 1, Burst: 1}})
+	client := newTestClient(ws, "192.0.2.10")
+	if !ws.admit(client, models.Event{Type: models.EventLeaderboard}) {
+		t.Fatal("first event refused")
+	}
+	if ws.admit(client, models.Event{Type: models.EventLeaderboard}) {
+		t.Fatal("second event allowed")
+	}
+
+	other := newTestClient(ws, "192.0.2.10")
+	if other.ID == client.ID {
+		t.Fatalf("two clients with ID %d", client.ID)
+	}
+	if !ws.admit(other, models.Event{Type: models.EventLeaderboard}) {
+		t.Error("new client inherited a bucket")
+	}
+
+	ws.connLimits.forget(connKey(client))
+	if _, ok := ws.connLimits.buckets[connKey(client)+" "+limitDefault]; ok {
+		t.Error("bucket kept after forget")
+	}
+	if len(ws.connLimits.buckets) != 1 {
+		t.Errorf("%d buckets left, want the other client's", len(ws.connLimits.buckets))
+	}
+}
@@ -0,0 +1,63 @@
+package services
+
+import (
+	"errors"
+
+	"powerpoint-quiz/internal/models"
+)
+
+// CommandError is why a client command was refused
+type CommandError struct {
+	Code    string // One of models.ErrCode*
+	Message string
+	// Quiet refusals are only reported to clients waiting for a reply; they
+	// cover commands that used to be dropped without a word
+	Quiet bool
+}
+
+func (e *CommandError) Error() string {
+	return e.Message
+}
+
+// refuse returns the error of a refused command
+func refuse(code, message string) error {
+	return &CommandError{Code: code, Message: message}
+}
+
+// refuseQuietly returns the error of a refused command that clients without
+// a request id are not told about
+func refuseQuietly(code, message string) error {
+	return &CommandError{Code: code, Message: message, Quiet: true}
+}
+
+// reply tells a client how its command went. A command with a request id
+// gets exactly one ack or nack; without one only a refusal is reported, as
+// an error event.
+func (ws *WebSocketService) reply(client *models.Client, event models.Event, err error) {
+	var refusal *CommandError
+	if err != nil && !errors.As(err, &refusal) {
+		refusal = &CommandError{Code: models.ErrCodeInvalidArgument, Message: err.Error()}
+	}
+
+	if event.RequestID == "" {
+		if refusal != nil && !refusal.Quiet {
+			ws.sendEventToClient(client, models.Event{
+				Type:    models.EventError,
+				Code:    refusal.Code,
+				Message: refusal.Message,
+			})
+		}
+		return
+	}
+
+	if refusal == nil {
+		ws.sendEventToClient(client, models.Event{Type: models.EventAck, RequestID: event.RequestID})
+		return
+	}
+	ws.sendEventToClient(client, models.Event{
+		Type:      models.EventNack,
+		RequestID: event.RequestID,
+		Code:      refusal.Code,
+		Message:   refusal.Message,
+	})
+}
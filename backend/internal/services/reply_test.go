@@ -0,0 +1,98 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"powerpoint-quiz/internal/models"
+)
+
+func TestReply(t *testing.T) {
+	tests := []struct {
+		name      string
+		requestID string
+		err       error
+		want      *models.Event // nil when nothing is sent
+	}{
+		{"success with a request id", "r1", nil,
+			&models.Event{Type: models.EventAck, RequestID: "r1"}},
+		{"refusal with a request id", "r2", refuse(models.ErrCodeForbidden, "Admins only"),
+			&models.Event{Type: models.EventNack, RequestID: "r2", Code: models.ErrCodeForbidden, Message: "Admins only"}},
+		{"quiet refusal with a request id", "r3", refuseQuietly(models.ErrCodeNotFound, "Room not found"),
+			&models.Event{Type: models.EventNack, RequestID: "r3", Code: models.ErrCodeNotFound, Message: "Room not found"}},
+		{"plain error with a request id", "r4", errors.New("bad value"),
+			&models.Event{Type: models.EventNack, RequestID: "r4", Code: models.ErrCodeInvalidArgument, Message: "bad value"}},
+		{"success without a request id", "", nil, nil},
+		{"refusal without a request id", "", refuse(models.ErrCodeConflict, "Too late"),
+			&models.Event{Type: models.EventError, Code: models.ErrCodeConflict, Message: "Too late"}},
+		{"quiet refusal without a request id", "", refuseQuietly(models.ErrCodeConflict, "Too late"), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws := newTestService(t)
+			client := newTestClient(ws, "192.0.2.10")
+			ws.reply(client, models.Event{Type: models.EventClick, RequestID: tt.requestID}, tt.err)
+
+			events := drain(t, client)
+			if tt.want == nil {
+				if len(events) != 0 {
+					t.Errorf("sent %+v, want nothing", events)
+				}
+				return
+			}
+			if len(events) != 1 {
+				t.Fatalf("sent %d events, want exactly one", len(events))
+			}
+			got := events[0]
+			if got.Type != tt.want.Type || got.RequestID != tt.want.RequestID || got.Code != tt.want.Code || got.Message != tt.want.Message {
+				t.Errorf("sent %+v, want %+v", got, *tt.want)
+			}
+		})
+	}
+}
+
+// Commands sent through HandleEvent get exactly one ack or nack, next to
+// whatever else they cause
+func TestHandleEventRepliesOnce(t *testing.T) {
+	ws := newTestService(t)
+	admin := newTestClient(ws, "192.0.2.1")
+	ws.HandleEvent(admin, models.Event{Type: models.EventCreateRoom, RequestID: "create"})
+	code := admin.RoomID
+
+	player := newTestClient(ws, "192.0.2.10")
+	ws.HandleEvent(player, models.Event{Type: models.EventJoin, QuizID: code, UserID: "u1", RequestID: "join"})
+	ws.HandleEvent(player, models.Event{Type: models.EventNextQuestion, QuizID: code, RequestID: "next"})
+	ws.HandleEvent(player, models.Event{Type: models.EventJoin, QuizID: "NOPE", UserID: "u2", RequestID: "missing"})
+	// Wait for the room to handle everything queued before
+	onRoom(t, ws, code, func(*models.Room) {})
+
+	replies := make(map[string][]models.Event)
+	for _, client := range []*models.Client{admin, player} {
+		for _, event := range drain(t, client) {
+			if event.Type == models.EventAck || event.Type == models.EventNack {
+				replies[event.RequestID] = append(replies[event.RequestID], event)
+			}
+		}
+	}
+
+	want := map[string]struct {
+		eventType models.EventType
+		code      string
+	}{
+		"create":  {models.EventAck, ""},
+		"join":    {models.EventAck, ""},
+		"next":    {models.EventNack, models.ErrCodeForbidden},
+		"missing": {models.EventNack, models.ErrCodeNotFound},
+	}
+	for requestID, w := range want {
+		got := replies[requestID]
+		if len(got) != 1 {
+			t.Errorf("%s got %d replies, want exactly one", requestID, len(got))
+			continue
+		}
+		if got[0].Type != w.eventType || got[0].Code != w.code {
+			t.Errorf("%s got %s %q, want %s %q", requestID, got[0].Type, got[0].Code, w.eventType, w.code)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package services
+
+//go:generate go run ../../cmd/schemagen -o ../../api/quiz.v1.schema.json
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"time"
+
+	"powerpoint-quiz/internal/models"
+)
+
+// ProtocolSchema returns the JSON Schema of protocol v1. The root schema
+// describes a client command; $defs/ServerEvent describes what the server
+// sends. Both are generated from the payload and event types, so they always
+// match what DecodeEvent accepts.
+func ProtocolSchema() map[string]interface{} {
+	g := &schemaGenerator{defs: make(map[string]interface{})}
+
+	types := make([]string, 0, len(models.Commands))
+	for eventType := range models.Commands {
+		types = append(types, string(eventType))
+	}
+	sort.Strings(types)
+
+	commands := make([]interface{}, 0, len(types))
+	for _, name := range types {
+		payload := reflect.TypeOf(models.Commands[models.EventType(name)])
+		then := map[string]interface{}{
+			"properties": map[string]interface{}{"payload": g.schemaOf(payload, true)},
+		}
+		// A missing payload counts as an empty one
+		if _, ok := g.object(payload, true)["required"]; ok {
+			then["required"] = []string{"payload"}
+		}
+		commands = append(commands, map[string]interface{}{
+			"if": map[string]interface{}{
+				"properties": map[string]interface{}{"type": map[string]interface{}{"const": name}},
+			},
+			"then": then,
+		})
+	}
+
+	envelope := g.object(reflect.TypeOf(models.Envelope{}), true)
+	envelope["properties"].(map[string]interface{})["type"] = map[string]interface{}{
+		"type": "string",
+		"enum": types,
+	}
+	g.defs["ServerEvent"] = g.object(reflect.TypeOf(models.Event{}), false)
+
+	schema := map[string]interface{}{
+		"$schema":     "https://json-schema.org/draft/2020-12/schema",
+		"$id":         models.SubprotocolV1,
+		"title":       "Quiz WebSocket protocol v1",
+		"description": "A client command. Negotiate the " + models.SubprotocolV1JSON + " or " + models.SubprotocolV1MsgPack + " subprotocol to use it; server events are described by $defs/ServerEvent.",
+		"allOf":       commands,
+		"$defs":       g.defs,
+	}
+	for key, value := range envelope {
+		schema[key] = value
+	}
+	return schema
+}
+
+// schemaGenerator builds JSON Schemas of Go types, putting named structs
+// into defs
+type schemaGenerator struct {
+	defs map[string]interface{}
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	rawType  = reflect.TypeOf(json.RawMessage{})
+)
+
+// schemaOf returns the schema of a type; strict structs reject unknown
+// properties, as DecodeEvent does
+func (g *schemaGenerator) schemaOf(t reflect.Type, strict bool) map[string]interface{} {
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t == rawType:
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return g.schemaOf(t.Elem(), strict)
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": g.schemaOf(t.Elem(), strict)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schemaOf(t.Elem(), strict)}
+	case reflect.Struct:
+		if _, ok := g.defs[t.Name()]; !ok {
+			g.defs[t.Name()] = true // Placeholder for recursive types
+			g.defs[t.Name()] = g.object(t, strict)
+		}
+		return map[string]interface{}{"$ref": "#/$defs/" + t.Name()}
+	}
+	return map[string]interface{}{} // interface{} holds anything
+}
+
+// object returns the schema of a struct's fields with their validation
+// rules
+func (g *schemaGenerator) object(t reflect.Type, strict bool) map[string]interface{} {
+	properties := make(map[string]interface{})
+	required := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := jsonName(field)
+		if name == "" {
+			continue
+		}
+		property := g.schemaOf(field.Type, strict)
+		rules := rulesOf(field)
+		if rules.required {
+			required = append(required, name)
+		}
+		if rules.max > 0 {
+			property["maxLength"] = rules.max
+		}
+		if rules.min != nil {
+			property["minimum"] = *rules.min
+		}
+		if len(rules.enum) > 0 {
+			property["enum"] = rules.enum
+		}
+		properties[name] = property
+	}
+
+	schema := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	if strict {
+		schema["additionalProperties"] = false
+	}
+	return schema
+}
@@ -0,0 +1,26 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+// TestProtocolSchemaUpToDate fails when the committed schema no longer
+// matches the payload types; run go generate ./internal/services to fix it
+func TestProtocolSchemaUpToDate(t *testing.T) {
+	want, err := json.MarshalIndent(ProtocolSchema(), "", "  ")
+	if err != nil {
+		t.Fatalf("encoding schema: %v", err)
+	}
+	want = append(want, '\n')
+
+	got, err := os.ReadFile("../../api/quiz.v1.schema.json")
+	if err != nil {
+		t.Fatalf("reading committed schema: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatal("api/quiz.v1.schema.json is stale, run go generate ./internal/services")
+	}
+}
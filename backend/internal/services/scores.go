@@ -0,0 +1,258 @@
+package services
+
+import (
+	"errors"
+	"log"
+
+	"powerpoint-quiz/internal/models"
+)
+
+// Score adjustment errors
+var (
+	ErrScoreTarget  = errors.New("exactly one of userId or teamId is required")
+	ErrScoreOp      = errors.New("scoreOp must be add, subtract or set")
+	ErrScorePoints  = errors.New("points must be positive for add and subtract")
+	ErrPlayerAbsent = errors.New("player not found in room")
+	ErrTeamAbsent   = errors.New("team not found in room")
+	ErrNothingUndo  = errors.New("no scoring actions to undo")
+)
+
+// newScoreAction starts the audit record of the score changes an entry
+// makes. Called from applyEvent.
+func newScoreAction(entry models.HistoryEntry) *models.ScoreAction {
+	return &models.ScoreAction{
+		Seq:    entry.Seq,
+		Type:   entry.Event.Type,
+		Admin:  entry.Event.AdminName,
+		Reason: entry.Event.Reason,
+		At:     entry.Timestamp,
+	}
+}
+
+// logScoreAction appends an action that changed any score to the room's
+// audit trail. Called from applyEvent.
+func logScoreAction(room *models.Room, action *models.ScoreAction) {
+	if len(action.Deltas) > 0 {
+		room.ScoreLog = append(room.ScoreLog, action)
+	}
+}
+
+// applyDelta changes the scores and answer counts named by a delta
+func applyDelta(room *models.Room, delta models.ScoreDelta) {
+	if player, ok := room.Players[delta.UserID]; ok {
+		player.Score += delta.Points
+		player.CorrectAnswers += delta.Correct
+		player.IncorrectAnswers += delta.Incorrect
+	}
+	if team, ok := room.Teams[delta.TeamID]; ok {
+		team.Score += delta.Points
+	}
+}
+
+// applyScoreAdjust applies a manual score change of one player or team.
+// "set" is turned into the difference to the score at that point of the
+// history so that it can be undone like any other change. Called from
+// applyEvent.
+func applyScoreAdjust(room *models.Room, entry models.HistoryEntry) {
+	event := entry.Event
+	delta := models.ScoreDelta{UserID: event.UserID, TeamID: event.TeamID}
+
+	current := 0
+	if player, ok := room.Players[event.UserID]; ok {
+		current = player.Score
+	} else if team, ok := room.Teams[event.TeamID]; ok {
+		current = team.Score
+	}
+	switch event.ScoreOp {
+	case models.ScoreOpAdd:
+		delta.Points = event.Points
+	case models.ScoreOpSubtract:
+		delta.Points = -event.Points
+	case models.ScoreOpSet:
+		delta.Points = event.Points - current
+	}
+
+	action := newScoreAction(entry)
+	applyDelta(room, delta)
+	action.Deltas = append(action.Deltas, delta)
+	room.ScoreLog = append(room.ScoreLog, action)
+}
+
+// applyScoreUndo reverts the latest event.Count scoring actions that are not
+// undone yet. Undos themselves are logged but never undone. Called from
+// applyEvent.
+func applyScoreUndo(room *models.Room, entry models.HistoryEntry) {
+	undo := newScoreAction(entry)
+	remaining := entry.Event.Count
+	for i := len(room.ScoreLog) - 1; i >= 0 && remaining > 0; i-- {
+		action := room.ScoreLog[i]
+		if action.UndoneBy != 0 || action.Type == models.EventScoreUndo {
+			continue
+		}
+		for _, d := range action.Deltas {
+			reverse := models.ScoreDelta{
+				UserID:    d.UserID,
+				TeamID:    d.TeamID,
+				Points:    -d.Points,
+				Correct:   -d.Correct,
+				Incorrect: -d.Incorrect,
+			}
+			applyDelta(room, reverse)
+			undo.Deltas = append(undo.Deltas, reverse)
+		}
+		action.UndoneBy = entry.Seq
+		remaining--
+	}
+	room.ScoreLog = append(room.ScoreLog, undo)
+}
+
+// undoableScoreActions counts the scoring actions an undo can still revert
+func undoableScoreActions(room *models.Room) int {
+	n := 0
+	for _, action := range room.ScoreLog {
+		if action.UndoneBy == 0 && action.Type != models.EventScoreUndo {
+			n++
+		}
+	}
+	return n
+}
+
+// adminIdentity names the admin behind a client in audit records
+func adminIdentity(client *models.Client) string {
+	if client.AdminName != "" {
+		return client.AdminName
+	}
+	return client.Role
+}
+
+// adjustScore validates and records a manual score change
+func (ws *WebSocketService) adjustScore(room *models.Room, role, admin string, event models.Event) error {
+	if (event.UserID == "") == (event.TeamID == "") {
+		return ErrScoreTarget
+	}
+	if event.UserID != "" {
+		if _, ok := room.Players[event.UserID]; !ok {
+			return ErrPlayerAbsent
+		}
+	} else if _, ok := room.Teams[event.TeamID]; !ok {
+		return ErrTeamAbsent
+	}
+	switch event.ScoreOp {
+	case models.ScoreOpAdd, models.ScoreOpSubtract:
+		if event.Points <= 0 {
+			return ErrScorePoints
+		}
+	case models.ScoreOpSet:
+	default:
+		return ErrScoreOp
+	}
+
+	ws.commit(room, role, models.Event{
+		Type:      models.EventScoreAdjust,
+		UserID:    event.UserID,
+		TeamID:    event.TeamID,
+		ScoreOp:   event.ScoreOp,
+		Points:    event.Points,
+		Reason:    event.Reason,
+		AdminName: admin,
+	})
+	log.Printf("Score %s %d for %s%s in room %s by %q: %s",
+		event.ScoreOp, event.Points, event.UserID, event.TeamID, room.Code, admin, event.Reason)
+	ws.broadcastScoreChange(room)
+	return nil
+}
+
+// undoScores validates and records an undo of the last count scoring
+// actions
+func (ws *WebSocketService) undoScores(room *models.Room, role, admin string, count int, reason string) error {
+	if count <= 0 {
+		count = 1
+	}
+	available := undoableScoreActions(room)
+	if available == 0 {
+		return ErrNothingUndo
+	}
+	if count > available {
+		count = available
+	}
+
+	ws.commit(room, role, models.Event{
+		Type:      models.EventScoreUndo,
+		Count:     count,
+		Reason:    reason,
+		AdminName: admin,
+	})
+	log.Printf("Undid %d scoring actions in room %s by %q: %s", count, room.Code, admin, reason)
+	ws.broadcastScoreChange(room)
+	return nil
+}
+
+// broadcastScoreChange tells the room about the latest audit record and the
+// new standings
+func (ws *WebSocketService) broadcastScoreChange(room *models.Room) {
+	changedEvent := models.Event{
+		Type: models.EventScoreChanged,
+		Data: room.ScoreLog[len(room.ScoreLog)-1],
+	}
+	ws.broadcastToRoom(room, changedEvent)
+	ws.broadcastLeaderboard(room)
+	ws.broadcastRoomState(room)
+}
+
+// handleScoreAdjust lets the host add, subtract or set a score
+func (ws *WebSocketService) handleScoreAdjust(client *models.Client, room *models.Room, event models.Event) error {
+	return refuseScore(ws.adjustScore(room, client.Role, adminIdentity(client), event))
+}
+
+// handleScoreUndo lets the host undo the last scoring actions
+func (ws *WebSocketService) handleScoreUndo(client *models.Client, room *models.Room, event models.Event) error {
+	return refuseScore(ws.undoScores(room, client.Role, adminIdentity(client), event.Count, event.Reason))
+}
+
+// refuseScore gives a score adjustment error its error code
+func refuseScore(err error) error {
+	switch err {
+	case nil:
+		return nil
+	case ErrPlayerAbsent, ErrTeamAbsent:
+		return refuse(models.ErrCodeNotFound, err.Error())
+	case ErrNothingUndo:
+		return refuse(models.ErrCodeInvalidState, err.Error())
+	}
+	return refuse(models.ErrCodeInvalidArgument, err.Error())
+}
+
+// AdjustScore changes a score on behalf of the REST API
+func (ws *WebSocketService) AdjustScore(room *models.Room, admin string, event models.Event) error {
+	err := ErrRoomNotFound
+	ws.call(room.Code, func(a *roomActor) {
+		if err = ws.adjustScore(room, "admin", admin, event); err == nil {
+			ws.saveRoom(room)
+		}
+	})
+	return err
+}
+
+// UndoScores undoes scoring actions on behalf of the REST API
+func (ws *WebSocketService) UndoScores(room *models.Room, admin string, count int, reason string) error {
+	err := ErrRoomNotFound
+	ws.call(room.Code, func(a *roomActor) {
+		if err = ws.undoScores(room, "admin", admin, count, reason); err == nil {
+			ws.saveRoom(room)
+		}
+	})
+	return err
+}
+
+// ScoreAudit returns a copy of a room's score audit trail
+func (ws *WebSocketService) ScoreAudit(room *models.Room) []models.ScoreAction {
+	var audit []models.ScoreAction
+	ws.call(room.Code, func(a *roomActor) {
+		audit = make([]models.ScoreAction, len(room.ScoreLog))
+		for i, action := range room.ScoreLog {
+			audit[i] = *action
+			audit[i].Deltas = append([]models.ScoreDelta(nil), action.Deltas...)
+		}
+	})
+	return audit
+}
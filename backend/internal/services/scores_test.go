@@ -0,0 +1,156 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"powerpoint-quiz/internal/models"
+)
+
+// scoreRoom creates a room with players u1 and u2 and team t1, whose only
+// member is u1
+func scoreRoom(t *testing.T) (*WebSocketService, *models.Room) {
+	t.Helper()
+	ws := newTestService(t)
+	admin := newTestClient(ws, "192.0.2.1")
+	code := createTestRoom(t, ws, admin, nil)
+	u1 := joinTestPlayer(t, ws, code, "u1")
+	joinTestPlayer(t, ws, code, "u2")
+	var room *models.Room
+	onRoom(t, ws, code, func(r *models.Room) {
+		room = r
+		ws.commit(r, "admin", models.Event{Type: models.EventCreateTeam, TeamID: "t1", TeamName: "Red"})
+	})
+	if err := dispatch(t, ws, u1, code, models.Event{Type: models.EventJoinTeam, TeamID: "t1"}); err != nil {
+		t.Fatal(err)
+	}
+	return ws, room
+}
+
+// scores returns the player and team scores of a room
+func scores(t *testing.T, ws *WebSocketService, room *models.Room) map[string]int {
+	t.Helper()
+	got := make(map[string]int)
+	onRoom(t, ws, room.Code, func(room *models.Room) {
+		for id, player := range room.Players {
+			got[id] = player.Score
+		}
+		for id, team := range room.Teams {
+			got[id] = team.Score
+		}
+	})
+	return got
+}
+
+func TestAdjustScore(t *testing.T) {
+	tests := []struct {
+		name    string
+		event   models.Event
+		wantErr error
+		want    map[string]int
+	}{
+		{"add to a player", models.Event{UserID: "u1", ScoreOp: models.ScoreOpAdd, Points: 5}, nil,
+			map[string]int{"u1": 5, "u2": 0, "t1": 0}},
+		{"subtract from a team", models.Event{TeamID: "t1", ScoreOp: models.ScoreOpSubtract, Points: 3}, nil,
+			map[string]int{"u1": 0, "u2": 0, "t1": -3}},
+		{"set a player", models.Event{UserID: "u2", ScoreOp: models.ScoreOpSet, Points: 42}, nil,
+			map[string]int{"u1": 0, "u2": 42, "t1": 0}},
+		{"both targets", models.Event{UserID: "u1", TeamID: "t1", ScoreOp: models.ScoreOpAdd, Points: 1}, ErrScoreTarget, nil},
+		{"no target", models.Event{ScoreOp: models.ScoreOpAdd, Points: 1}, ErrScoreTarget, nil},
+		{"unknown player", models.Event{UserID: "nobody", ScoreOp: models.ScoreOpAdd, Points: 1}, ErrPlayerAbsent, nil},
+		{"unknown team", models.Event{TeamID: "t9", ScoreOp: models.ScoreOpAdd, Points: 1}, ErrTeamAbsent, nil},
+		{"unknown op", models.Event{UserID: "u1", ScoreOp: "double", Points: 1}, ErrScoreOp, nil},
+		{"non-positive add", models.Event{UserID: "u1", ScoreOp: models.ScoreOpAdd, Points: 0}, ErrScorePoints, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws, room := scoreRoom(t)
+			err := ws.AdjustScore(room, "tester", tt.event)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.want != nil && !reflect.DeepEqual(scores(t, ws, room), tt.want) {
+				t.Errorf("scores = %v, want %v", scores(t, ws, room), tt.want)
+			}
+		})
+	}
+}
+
+// Undo restores the exact scores before the undone actions and is refused
+// once there is nothing left to undo
+func TestUndoScores(t *testing.T) {
+	ws, room := scoreRoom(t)
+	before := scores(t, ws, room)
+
+	adjustments := []models.Event{
+		{UserID: "u1", ScoreOp: models.ScoreOpAdd, Points: 7},
+		{TeamID: "t1", ScoreOp: models.ScoreOpSet, Points: 20},
+		{UserID: "u2", ScoreOp: models.ScoreOpSubtract, Points: 4},
+	}
+	var after []map[string]int
+	for _, event := range adjustments {
+		if err := ws.AdjustScore(room, "tester", event); err != nil {
+			t.Fatal(err)
+		}
+		after = append(after, scores(t, ws, room))
+	}
+
+	if err := ws.UndoScores(room, "tester", 1, "typo"); err != nil {
+		t.Fatal(err)
+	}
+	if got := scores(t, ws, room); !reflect.DeepEqual(got, after[1]) {
+		t.Errorf("after one undo scores = %v, want %v", got, after[1])
+	}
+	// More than is left undoes what is left
+	if err := ws.UndoScores(room, "tester", 5, "reset"); err != nil {
+		t.Fatal(err)
+	}
+	if got := scores(t, ws, room); !reflect.DeepEqual(got, before) {
+		t.Errorf("after undoing everything scores = %v, want %v", got, before)
+	}
+	if err := ws.UndoScores(room, "tester", 1, "again"); !errors.Is(err, ErrNothingUndo) {
+		t.Errorf("undo with nothing left: error = %v, want %v", err, ErrNothingUndo)
+	}
+
+	// The audit trail keeps every action and who undid it
+	audit := ws.ScoreAudit(room)
+	if len(audit) != 5 {
+		t.Fatalf("audit trail has %d actions, want 5", len(audit))
+	}
+	for i, action := range audit[:3] {
+		if action.UndoneBy == 0 || action.Admin != "tester" {
+			t.Errorf("action %d = %+v, want it undone and attributed", i, action)
+		}
+	}
+	if audit[2].UndoneBy != audit[3].Seq || audit[0].UndoneBy != audit[4].Seq {
+		t.Errorf("actions undone by the wrong undo: %+v", audit)
+	}
+}
+
+func TestUndoScoresOnEmptyLog(t *testing.T) {
+	ws, room := scoreRoom(t)
+	if err := ws.UndoScores(room, "tester", 1, ""); !errors.Is(err, ErrNothingUndo) {
+		t.Errorf("error = %v, want %v", err, ErrNothingUndo)
+	}
+}
+
+// The audit trail of a room rebuilt from its history matches the live one
+func TestScoreLogReplays(t *testing.T) {
+	ws, room := scoreRoom(t)
+	ws.AdjustScore(room, "tester", models.Event{UserID: "u1", ScoreOp: models.ScoreOpAdd, Points: 3})
+	ws.AdjustScore(room, "tester", models.Event{TeamID: "t1", ScoreOp: models.ScoreOpSet, Points: 9})
+	ws.UndoScores(room, "tester", 1, "")
+	ws.AdjustScore(room, "tester", models.Event{UserID: "u2", ScoreOp: models.ScoreOpSubtract, Points: 1})
+
+	replayed, err := ReplayRoom(ws.History(room.Code))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := json.Marshal(replayed.ScoreLog)
+	want, _ := json.Marshal(ws.ScoreAudit(room))
+	if string(got) != string(want) {
+		t.Errorf("replayed score log differs:\n got %s\nwant %s", got, want)
+	}
+}
@@ -0,0 +1,225 @@
+package services
+
+import (
+	"fmt"
+	"log"
+
+	"powerpoint-quiz/internal/models"
+)
+
+// ScoredAnswer is what a scoring policy knows about a judged answer
+type ScoredAnswer struct {
+	Correct     bool
+	BasePoints  int   // Full points of a correct answer
+	ReactionMs  int64 // Time from question start to the answer, 0 if unknown
+	TimeLimitMs int64 // Time limit of the question, 0 if none
+	Streak      int   // Correct answers in a row before this one
+}
+
+// ScoringPolicy turns a judged answer into points; negative points are a
+// penalty. Policies must be pure so that replaying the history gives the
+// same scores.
+type ScoringPolicy interface {
+	Score(a ScoredAnswer) int
+}
+
+// fixedScoring awards the full points for every correct answer
+type fixedScoring struct{}
+
+func (fixedScoring) Score(a ScoredAnswer) int {
+	if !a.Correct {
+		return 0
+	}
+	return a.BasePoints
+}
+
+// speedScoring lets the points fall linearly from the full points to
+// minPoints over the decay period
+type speedScoring struct {
+	minPoints int
+	decayMs   int64
+}
+
+func (p speedScoring) Score(a ScoredAnswer) int {
+	if !a.Correct {
+		return 0
+	}
+	decay := p.decayMs
+	if decay <= 0 {
+		decay = a.TimeLimitMs
+	}
+	if decay <= 0 || a.ReactionMs <= 0 || p.minPoints >= a.BasePoints {
+		return a.BasePoints
+	}
+	if a.ReactionMs >= decay {
+		return p.minPoints
+	}
+	lost := int64(a.BasePoints-p.minPoints) * a.ReactionMs / decay
+	return a.BasePoints - int(lost)
+}
+
+// negativeMarking takes points for wrong answers
+type negativeMarking struct {
+	ScoringPolicy
+	penalty int
+}
+
+func (p negativeMarking) Score(a ScoredAnswer) int {
+	if !a.Correct {
+		return -p.penalty
+	}
+	return p.ScoringPolicy.Score(a)
+}
+
+// streakBonus adds points for every previous correct answer in a row
+type streakBonus struct {
+	ScoringPolicy
+	bonus    int
+	maxBonus int
+}
+
+func (p streakBonus) Score(a ScoredAnswer) int {
+	points := p.ScoringPolicy.Score(a)
+	if !a.Correct {
+		return points
+	}
+	extra := p.bonus * a.Streak
+	if p.maxBonus > 0 && extra > p.maxBonus {
+		extra = p.maxBonus
+	}
+	return points + extra
+}
+
+// NewScoringPolicy builds the policy described by a set of rules; nil rules
+// give fixed points
+func NewScoringPolicy(rules *models.ScoringRules) ScoringPolicy {
+	if rules == nil {
+		return fixedScoring{}
+	}
+
+	var policy ScoringPolicy = fixedScoring{}
+	if rules.Policy == models.ScoringSpeed {
+		policy = speedScoring{minPoints: rules.MinPoints, decayMs: int64(rules.DecayMs)}
+	}
+	if rules.WrongPenalty > 0 {
+		policy = negativeMarking{ScoringPolicy: policy, penalty: rules.WrongPenalty}
+	}
+	if rules.StreakBonus > 0 {
+		policy = streakBonus{ScoringPolicy: policy, bonus: rules.StreakBonus, maxBonus: rules.MaxStreakBonus}
+	}
+	return policy
+}
+
+// validateScoringRules rejects rules the policies cannot apply
+func validateScoringRules(rules *models.ScoringRules) error {
+	if rules == nil {
+		return nil
+	}
+	switch rules.Policy {
+	case "", models.ScoringFixed, models.ScoringSpeed:
+	default:
+		return fmt.Errorf("unknown scoring policy %q", rules.Policy)
+	}
+	if rules.MinPoints < 0 || rules.DecayMs < 0 || rules.WrongPenalty < 0 ||
+		rules.FalseStartPenalty < 0 || rules.StreakBonus < 0 || rules.MaxStreakBonus < 0 {
+		return fmt.Errorf("scoring values must not be negative")
+	}
+	return nil
+}
+
+// scoringRules picks the rules for a question: its own, then the host's room
+// rules, then the quiz defaults. nil means fixed points without penalties.
+func scoringRules(room *models.Room, q *models.Question) *models.ScoringRules {
+	if q != nil && q.Scoring != nil {
+		return q.Scoring
+	}
+	if room.Scoring != nil {
+		return room.Scoring
+	}
+	if room.Quiz != nil {
+		return room.Quiz.Scoring
+	}
+	return nil
+}
+
+// scoreAnswer scores a judged answer of a player to the current question.
+// basePoints overrides the question's points when positive.
+func scoreAnswer(room *models.Room, player *models.Player, correct bool, basePoints int, reactionMs int64) int {
+	q := currentQuizQuestion(room)
+	answer := ScoredAnswer{
+		Correct:    correct,
+		BasePoints: basePoints,
+		ReactionMs: reactionMs,
+	}
+	if answer.BasePoints <= 0 {
+		answer.BasePoints = defaultPoints
+		if q != nil {
+			answer.BasePoints = questionPoints(q)
+		}
+	}
+	if q != nil {
+		answer.TimeLimitMs = int64(q.TimeLimit) * 1000
+	}
+	if player != nil {
+		answer.Streak = player.Streak
+	}
+	return NewScoringPolicy(scoringRules(room, q)).Score(answer)
+}
+
+// applyScore credits points to a player and their team, keeps the player's
+// answer counts and streak and records the change in action. Called from
+// applyEvent.
+func applyScore(room *models.Room, action *models.ScoreAction, player *models.Player, team *models.Team, correct bool, points int) {
+	delta := models.ScoreDelta{Points: points}
+	if team != nil {
+		delta.TeamID = team.ID
+	}
+	if player != nil {
+		delta.UserID = player.ID
+		if correct {
+			delta.Correct = 1
+			player.Streak++
+		} else {
+			delta.Incorrect = 1
+			player.Streak = 0
+		}
+	}
+	applyDelta(room, delta)
+	action.Deltas = append(action.Deltas, delta)
+}
+
+// handleSetScoring lets the host choose the room's scoring rules; an empty
+// rule set goes back to the quiz defaults
+func (ws *WebSocketService) handleSetScoring(client *models.Client, room *models.Room, event models.Event) error {
+	if err := validateScoringRules(event.Scoring); err != nil {
+		return refuse(models.ErrCodeInvalidArgument, err.Error())
+	}
+
+	ws.commit(room, client.Role, models.Event{
+		Type:    models.EventSetScoring,
+		Scoring: event.Scoring,
+	})
+	log.Printf("Scoring rules changed in room %s", room.Code)
+	ws.broadcastRoomState(room)
+	return nil
+}
+
+// penalizeFalseStart takes the false start penalty from a player
+func (ws *WebSocketService) penalizeFalseStart(room *models.Room, userID string) {
+	rules := scoringRules(room, currentQuizQuestion(room))
+	if rules == nil || rules.FalseStartPenalty <= 0 {
+		return
+	}
+
+	penalty := models.Event{
+		Type:   models.EventFalseStartPenalty,
+		UserID: userID,
+		Points: -rules.FalseStartPenalty,
+	}
+	if team := findPlayerTeam(room, userID); team != nil {
+		penalty.TeamID = team.ID
+	}
+	ws.commit(room, "system", penalty)
+	log.Printf("Player %s loses %d points for a false start", userID, rules.FalseStartPenalty)
+	ws.broadcastLeaderboard(room)
+}
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"testing"
+
+	"powerpoint-quiz/internal/models"
+)
+
+func TestScoringPolicies(t *testing.T) {
+	speed := &models.ScoringRules{Policy: models.ScoringSpeed, MinPoints: 2}
+
+	tests := []struct {
+		name   string
+		rules  *models.ScoringRules
+		answer ScoredAnswer
+		want   int
+	}{
+		{"no rules, correct", nil, ScoredAnswer{Correct: true, BasePoints: 10}, 10},
+		{"no rules, wrong", nil, ScoredAnswer{Correct: false, BasePoints: 10}, 0},
+		{"fixed ignores speed", &models.ScoringRules{Policy: models.ScoringFixed},
+			ScoredAnswer{Correct: true, BasePoints: 10, ReactionMs: 9000, TimeLimitMs: 10000}, 10},
+
+		{"speed without a time limit", speed, ScoredAnswer{Correct: true, BasePoints: 10, ReactionMs: 5000}, 10},
+		{"speed with unknown reaction", speed, ScoredAnswer{Correct: true, BasePoints: 10, TimeLimitMs: 10000}, 10},
+		{"speed at the start", speed, ScoredAnswer{Correct: true, BasePoints: 10, ReactionMs: 1, TimeLimitMs: 10000}, 10},
+		{"speed halfway", speed, ScoredAnswer{Correct: true, BasePoints: 10, ReactionMs: 5000, TimeLimitMs: 10000}, 6},
+		{"speed at the deadline", speed, ScoredAnswer{Correct: true, BasePoints: 10, ReactionMs: 10000, TimeLimitMs: 10000}, 2},
+		{"speed after the deadline", speed, ScoredAnswer{Correct: true, BasePoints: 10, ReactionMs: 60000, TimeLimitMs: 10000}, 2},
+		{"speed decay overrides the time limit", &models.ScoringRules{Policy: models.ScoringSpeed, DecayMs: 2000},
+			ScoredAnswer{Correct: true, BasePoints: 10, ReactionMs: 1000, TimeLimitMs: 10000}, 5},
+		{"speed floor above the points", &models.ScoringRules{Policy: models.ScoringSpeed, MinPoints: 20},
+			ScoredAnswer{Correct: true, BasePoints: 10, ReactionMs: 5000, TimeLimitMs: 10000}, 10},
+		{"speed, wrong", speed, ScoredAnswer{Correct: false, BasePoints: 10, ReactionMs: 1000, TimeLimitMs: 10000}, 0},
+
+		{"negative marking, wrong", &models.ScoringRules{WrongPenalty: 3}, ScoredAnswer{Correct: false, BasePoints: 10}, -3},
+		{"negative marking, correct", &models.ScoringRules{WrongPenalty: 3}, ScoredAnswer{Correct: true, BasePoints: 10}, 10},
+		{"negative marking with speed after the deadline", &models.ScoringRules{Policy: models.ScoringSpeed, WrongPenalty: 3},
+			ScoredAnswer{Correct: true, BasePoints: 10, ReactionMs: 20000, TimeLimitMs: 10000}, 0},
+
+		{"streak, first answer", &models.ScoringRules{StreakBonus: 2}, ScoredAnswer{Correct: true, BasePoints: 10}, 10},
+		{"streak of three", &models.ScoringRules{StreakBonus: 2}, ScoredAnswer{Correct: true, BasePoints: 10, Streak: 3}, 16},
+		{"streak capped", &models.ScoringRules{StreakBonus: 2, MaxStreakBonus: 5}, ScoredAnswer{Correct: true, BasePoints: 10, Streak: 3}, 15},
+		{"streak, wrong", &models.ScoringRules{StreakBonus: 2, WrongPenalty: 1}, ScoredAnswer{Correct: false, BasePoints: 10, Streak: 3}, -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewScoringPolicy(tt.rules).Score(tt.answer); got != tt.want {
+				t.Errorf("score = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// A wrong answer resets the streak, and penalties may take a score below
+// zero
+func TestStreakAndPenaltyOverAnswers(t *testing.T) {
+	room := &models.Room{
+		Players: map[string]*models.Player{"u1": {ID: "u1", UserID: "u1"}},
+		Teams:   map[string]*models.Team{},
+		Scoring: &models.ScoringRules{StreakBonus: 1, WrongPenalty: 4},
+	}
+	player := room.Players["u1"]
+
+	steps := []struct {
+		correct    bool
+		wantPoints int
+		wantScore  int
+		wantStreak int
+	}{
+		{false, -4, -4, 0},
+		{true, 10, 6, 1},
+		{true, 11, 17, 2},
+		{false, -4, 13, 0},
+		{true, 10, 23, 1},
+	}
+	for i, step := range steps {
+		points := scoreAnswer(room, player, step.correct, 10, 0)
+		applyScore(room, &models.ScoreAction{}, player, nil, step.correct, points)
+		if points != step.wantPoints || player.Score != step.wantScore || player.Streak != step.wantStreak {
+			t.Errorf("answer %d: points %d, score %d, streak %d; want %d, %d, %d",
+				i+1, points, player.Score, player.Streak, step.wantPoints, step.wantScore, step.wantStreak)
+		}
+	}
+}
+
+func TestValidateScoringRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules *models.ScoringRules
+		valid bool
+	}{
+		{"nil", nil, true},
+		{"speed", &models.ScoringRules{Policy: models.ScoringSpeed, MinPoints: 1, DecayMs: 1000}, true},
+		{"unknown policy", &models.ScoringRules{Policy: "random"}, false},
+		{"negative penalty", &models.ScoringRules{WrongPenalty: -1}, false},
+		{"negative floor", &models.ScoringRules{Policy: models.ScoringSpeed, MinPoints: -1}, false},
+		{"negative decay", &models.ScoringRules{DecayMs: -1}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateScoringRules(tt.rules); (err == nil) != tt.valid {
+				t.Errorf("error = %v, want valid = %v", err, tt.valid)
+			}
+		})
+	}
+}
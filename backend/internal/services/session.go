@@ -0,0 +1,261 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"powerpoint-quiz/internal/models"
+)
+
+// Session token errors
+var (
+	ErrSessionInvalid = errors.New("invalid session token")
+	ErrSessionExpired = errors.New("session token expired")
+	ErrTokenRevoked   = errors.New("token revoked")
+)
+
+// sessionClaims is the signed payload of a player session token or, with
+// Role set instead of User, of an admin or host token
+type sessionClaims struct {
+	Room    string `json:"r"`
+	User    string `json:"u,omitempty"`
+	Role    string `json:"role,omitempty"`
+	Member  string `json:"m,omitempty"`     // Invited member the token belongs to
+	Epoch   int    `json:"epoch,omitempty"` // Room.TokenEpoch the token was issued in
+	Issued  int64  `json:"iat"`             // Unix seconds
+	Expires int64  `json:"exp,omitempty"`   // Unix seconds, else Issued plus SessionTTL
+}
+
+// signSession issues a token that lets a player rebind a new connection to
+// their existing Player: base64url(claims) "." base64url(HMAC-SHA256)
+func (ws *WebSocketService) signSession(roomCode, userID string) string {
+	return ws.signClaims(sessionClaims{Room: roomCode, User: userID})
+}
+
+func (ws *WebSocketService) signClaims(claims sessionClaims) string {
+	claims.Issued = time.Now().Unix()
+	payload, _ := json.Marshal(claims)
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(ws.sessionMAC(encoded))
+}
+
+func (ws *WebSocketService) sessionMAC(encoded string) []byte {
+	mac := hmac.New(sha256.New, ws.opts.SessionSecret)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
+
+// verifySession checks a token's signature and age and returns its claims
+func (ws *WebSocketService) verifySession(token string) (*sessionClaims, error) {
+	encoded, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrSessionInvalid
+	}
+	given, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(given, ws.sessionMAC(encoded)) {
+		return nil, ErrSessionInvalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrSessionInvalid
+	}
+	var claims sessionClaims
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Room == "" || (claims.User == "") == (claims.Role == "") {
+		return nil, ErrSessionInvalid
+	}
+	if claims.Expires != 0 && time.Now().Unix() >= claims.Expires {
+		return nil, ErrSessionExpired
+	}
+	if claims.Expires == 0 && ws.opts.SessionTTL > 0 && time.Since(time.Unix(claims.Issued, 0)) > ws.opts.SessionTTL {
+		return nil, ErrSessionExpired
+	}
+	return &claims, nil
+}
+
+// playerClient returns the connection bound to a player, other than skip
+func (ws *WebSocketService) playerClient(room *models.Room, userID string, skip *models.Client) *models.Client {
+	for client := range ws.actorOf(room).clients {
+		if client != skip && client.UserID == userID {
+			return client
+		}
+	}
+	return nil
+}
+
+// handleResume brings a reconnected client up to date. With the session
+// token issued on join_success it also rebinds the connection to the
+// existing player; hosts and viewers resume the room they are in. room is
+// nil when the room does not exist.
+func (ws *WebSocketService) handleResume(client *models.Client, room *models.Room, event models.Event) error {
+	var claims *sessionClaims
+	if event.SessionToken != "" {
+		var err error
+		if claims, err = ws.verifySession(event.SessionToken); err != nil {
+			return refuse(models.ErrCodeUnauthorized, err.Error())
+		}
+	}
+	if room == nil {
+		return refuse(models.ErrCodeNotFound, "Room not found")
+	}
+	if claims == nil {
+		ws.bindClient(room, client)
+		ws.catchUp(client, room, models.Event{Type: models.EventResumeSuccess}, event.LastSeq)
+		return nil
+	}
+	if claims.Room != room.Code || claims.User == "" {
+		return refuse(models.ErrCodeUnauthorized, ErrSessionInvalid.Error())
+	}
+
+	player, exists := room.Players[claims.User]
+	if !exists {
+		return refuse(models.ErrCodeNotFound, "Player not found in room")
+	}
+
+	// Only one connection speaks for a player; the newest wins
+	if old := ws.playerClient(room, player.UserID, client); old != nil {
+		ws.sendErrorToClient(old, "Session resumed on another connection")
+		old.UserID = ""
+		old.Role = models.RoleViewer
+	}
+	client.UserID = player.UserID
+	client.Role = models.RolePlayer
+	ws.bindClient(room, client)
+	log.Printf("Player %s resumed session in room %s", player.UserID, room.Code)
+
+	resumeEvent := models.Event{
+		Type:         models.EventResumeSuccess,
+		UserID:       player.UserID,
+		SessionToken: ws.signSession(room.Code, player.UserID),
+	}
+	ws.catchUp(client, room, resumeEvent, event.LastSeq)
+	ws.startClockSync(client)
+
+	if !player.Connected {
+		ws.commit(room, "system", models.Event{
+			Type:   models.EventPlayerConnected,
+			UserID: player.UserID,
+		})
+		presenceEvent := models.Event{
+			Type:   models.EventPlayerConnected,
+			UserID: player.UserID,
+			Data:   player,
+		}
+		ws.broadcastToRoom(room, presenceEvent)
+		ws.broadcastRoomState(room)
+	}
+	return nil
+}
+
+// ClientConnected puts a new connection into the room named by its URL so it
+// gets the room's broadcasts before it sends anything
+func (ws *WebSocketService) ClientConnected(client *models.Client) {
+	ws.call(client.RoomID, func(a *roomActor) {
+		ws.bindClient(a.room, client)
+	})
+}
+
+// ClientDisconnected takes a closed connection out of its room and marks the
+// player bound to it as disconnected, unless another connection already took
+// over, and starts the reconnect grace period. It returns once the room no
+// longer uses the client.
+func (ws *WebSocketService) ClientDisconnected(client *models.Client) {
+	ws.call(client.RoomID, func(a *roomActor) {
+		delete(a.clients, client)
+		if client.UserID != "" {
+			ws.playerDisconnected(a.room, client)
+		}
+		if client.MemberID != "" {
+			// The staff see who of the members is connected
+			ws.broadcastRoomState(a.room)
+		}
+	})
+}
+
+// playerDisconnected records that the player of a closed connection is gone
+// for now and leaves them after the grace period unless they resume
+func (ws *WebSocketService) playerDisconnected(room *models.Room, client *models.Client) {
+	player, exists := room.Players[client.UserID]
+	if !exists || !player.Connected || ws.playerClient(room, client.UserID, client) != nil {
+		return
+	}
+
+	entry := ws.commit(room, "system", models.Event{
+		Type:   models.EventPlayerDisconnected,
+		UserID: player.UserID,
+	})
+	log.Printf("Player %s disconnected from room %s", player.UserID, room.Code)
+
+	presenceEvent := models.Event{
+		Type:   models.EventPlayerDisconnected,
+		UserID: player.UserID,
+		Data:   player,
+	}
+	ws.broadcastToRoom(room, presenceEvent)
+	ws.broadcastRoomState(room)
+	ws.saveRoom(room)
+	ws.startGracePeriod(room, player.UserID, entry.Timestamp)
+}
+
+// startGracePeriod leaves a player disconnected at disconnectedAt once the
+// grace period is over, unless they resumed or disconnected again since
+func (ws *WebSocketService) startGracePeriod(room *models.Room, userID string, disconnectedAt time.Time) {
+	time.AfterFunc(ws.opts.ReconnectGrace, func() {
+		ws.post(room.Code, func(a *roomActor) {
+			// A resume or a later disconnect replaces this grace period
+			if p, ok := room.Players[userID]; ok && !p.Connected && !p.Left && p.DisconnectedAt.Equal(disconnectedAt) {
+				ws.playerLeft(room, userID)
+				ws.saveRoom(room)
+			}
+		})
+	})
+}
+
+// joinedPlayer returns the player a connection joined or resumed as. Player
+// commands act on this identity only, never on a user ID the client sends.
+func joinedPlayer(client *models.Client, room *models.Room) (*models.Player, error) {
+	if client.UserID == "" {
+		return nil, refuse(models.ErrCodeForbidden, "Join the room as a player first")
+	}
+	player, ok := room.Players[client.UserID]
+	if !ok || player.Left {
+		return nil, refuse(models.ErrCodeForbidden, "Join the room as a player first")
+	}
+	return player, nil
+}
+
+// handleLeave lets a player leave the room for good
+func (ws *WebSocketService) handleLeave(client *models.Client, room *models.Room) error {
+	if client.UserID == "" {
+		return refuseQuietly(models.ErrCodeInvalidState, "Not playing in this room")
+	}
+	if player, ok := room.Players[client.UserID]; !ok || player.Left {
+		return refuseQuietly(models.ErrCodeInvalidState, "Not playing in this room")
+	}
+	ws.playerLeft(room, client.UserID)
+	client.UserID = ""
+	client.Role = models.RoleViewer
+	return nil
+}
+
+// playerLeft records that a player is gone
+func (ws *WebSocketService) playerLeft(room *models.Room, userID string) {
+	ws.commit(room, "system", models.Event{
+		Type:   models.EventPlayerLeft,
+		UserID: userID,
+	})
+	log.Printf("Player %s left room %s", userID, room.Code)
+
+	leftEvent := models.Event{
+		Type:   models.EventPlayerLeft,
+		UserID: userID,
+		Data:   room.Players[userID],
+	}
+	ws.broadcastToRoom(room, leftEvent)
+	ws.broadcastRoomState(room)
+}
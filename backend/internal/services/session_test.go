@@ -0,0 +1,227 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"powerpoint-quiz/internal/models"
+)
+
+// sessionRoom creates a room with player u1 and returns the player's
+// connection and session token
+func sessionRoom(t *testing.T, ws *WebSocketService) (code string, admin, player *models.Client, token string) {
+	t.Helper()
+	admin = newTestClient(ws, "192.0.2.1")
+	code = createTestRoom(t, ws, admin, nil)
+	player = joinTestPlayer(t, ws, code, "u1")
+	joined, ok := received(t, player, models.EventJoinSuccess)
+	if !ok || joined.SessionToken == "" {
+		t.Fatal("join_success without a session token")
+	}
+	return code, admin, player, joined.SessionToken
+}
+
+// resume resumes a session on a new connection
+func resume(t *testing.T, ws *WebSocketService, code, token string, lastSeq int64) (*models.Client, error) {
+	t.Helper()
+	client := newTestClient(ws, "192.0.2.11")
+	err := dispatch(t, ws, client, code, models.Event{Type: models.EventResume, SessionToken: token, LastSeq: lastSeq})
+	return client, err
+}
+
+// playerState returns a copy of a player
+func playerState(t *testing.T, ws *WebSocketService, code, userID string) models.Player {
+	t.Helper()
+	var player models.Player
+	onRoom(t, ws, code, func(room *models.Room) { player = *room.Players[userID] })
+	return player
+}
+
+func TestJoinWithoutUserID(t *testing.T) {
+	ws := newTestService(t)
+	code := createTestRoom(t, ws, newTestClient(ws, "192.0.2.1"), nil)
+	client := newTestClient(ws, "192.0.2.10")
+	err := dispatch(t, ws, client, code, models.Event{Type: models.EventJoin, QuizID: code})
+	if refusalCode(err) != models.ErrCodeInvalidArgument {
+		t.Errorf("join without an ID refused with %v, want %s", err, models.ErrCodeInvalidArgument)
+	}
+	if event, ok := received(t, client, models.EventJoinError); !ok || event.Message != "Player ID is required" {
+		t.Errorf("join_error = %+v", event)
+	}
+}
+
+func TestResumeRejectsBadTokens(t *testing.T) {
+	ws := newTestService(t)
+	code, _, _, token := sessionRoom(t, ws)
+
+	other := newTestService(t)
+	other.opts.SessionSecret = []byte("another secret")
+
+	tests := []struct {
+		name  string
+		token string
+		want  string
+	}{
+		{"forged signature", token[:len(token)-2] + "AA", models.ErrCodeUnauthorized},
+		{"signed with another secret", other.signSession(code, "u1"), models.ErrCodeUnauthorized},
+		{"not a token", "garbage", models.ErrCodeUnauthorized},
+		{"expired", ws.signClaims(sessionClaims{Room: code, User: "u1", Expires: time.Now().Add(-time.Minute).Unix()}), models.ErrCodeUnauthorized},
+		{"other room", ws.signSession("OTHER", "u1"), models.ErrCodeUnauthorized},
+		{"role token", ws.signClaims(sessionClaims{Room: code, Role: models.RoleAdmin}), models.ErrCodeUnauthorized},
+		{"unknown player", ws.signSession(code, "ghost"), models.ErrCodeNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := resume(t, ws, code, tt.token, 0)
+			if got := refusalCode(err); got != tt.want {
+				t.Errorf("resume refused with %q, want %q", got, tt.want)
+			}
+			if client.UserID != "" || client.Role == models.RolePlayer {
+				t.Errorf("refused resume bound the connection to %q as %s", client.UserID, client.Role)
+			}
+		})
+	}
+}
+
+// Tokens issued before revoke_tokens carry an old epoch and stop working
+func TestRoleTokenWrongEpoch(t *testing.T) {
+	ws := newTestService(t)
+	code, admin, _, _ := sessionRoom(t, ws)
+
+	var token string
+	onRoom(t, ws, code, func(room *models.Room) { token = ws.signRoleToken(room, models.RoleAdmin, "") })
+	if err := dispatch(t, ws, admin, code, models.Event{Type: models.EventRevokeTokens}); err != nil {
+		t.Fatal(err)
+	}
+	onRoom(t, ws, code, func(room *models.Room) {
+		if _, err := ws.verifyRoleToken(room, token, models.RoleAdmin); !errors.Is(err, ErrTokenRevoked) {
+			t.Errorf("token from the old epoch: error = %v, want %v", err, ErrTokenRevoked)
+		}
+		fresh := ws.signRoleToken(room, models.RoleAdmin, "")
+		if _, err := ws.verifyRoleToken(room, fresh, models.RoleAdmin); err != nil {
+			t.Errorf("token from the new epoch: %v", err)
+		}
+	})
+}
+
+// A player who resumes within the grace period is never considered gone
+func TestResumeWithinGrace(t *testing.T) {
+	ws := newTestService(t)
+	ws.opts.ReconnectGrace = 20 * time.Millisecond
+	code, _, player, token := sessionRoom(t, ws)
+
+	ws.ClientDisconnected(player)
+	if p := playerState(t, ws, code, "u1"); p.Connected || p.DisconnectedAt.IsZero() {
+		t.Fatalf("after disconnecting player = %+v", p)
+	}
+	client, err := resume(t, ws, code, token, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.UserID != "u1" || client.Role != models.RolePlayer {
+		t.Errorf("resumed connection is %q as %s", client.UserID, client.Role)
+	}
+
+	time.Sleep(3 * ws.opts.ReconnectGrace)
+	if p := playerState(t, ws, code, "u1"); !p.Connected || p.Left {
+		t.Errorf("after the grace period player = %+v, want connected", p)
+	}
+}
+
+// A player who does not come back in time leaves the room; the session
+// still brings them back with their score
+func TestResumeAfterGrace(t *testing.T) {
+	ws := newTestService(t)
+	ws.opts.ReconnectGrace = 10 * time.Millisecond
+	code, _, player, token := sessionRoom(t, ws)
+	onRoom(t, ws, code, func(room *models.Room) { room.Players["u1"].Score = 7 })
+
+	ws.ClientDisconnected(player)
+	deadline := time.Now().Add(2 * time.Second)
+	for !playerState(t, ws, code, "u1").Left {
+		if time.Now().After(deadline) {
+			t.Fatal("player did not leave after the grace period")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if _, err := resume(t, ws, code, token, 0); err != nil {
+		t.Fatal(err)
+	}
+	if p := playerState(t, ws, code, "u1"); !p.Connected || p.Left || p.Score != 7 {
+		t.Errorf("resumed player = %+v", p)
+	}
+}
+
+// A newer connection takes the player over from the old one
+func TestResumeTakesOverConnection(t *testing.T) {
+	ws := newTestService(t)
+	code, _, player, token := sessionRoom(t, ws)
+
+	if _, err := resume(t, ws, code, token, 0); err != nil {
+		t.Fatal(err)
+	}
+	if player.UserID != "" || player.Role != models.RoleViewer {
+		t.Errorf("old connection is still %q as %s", player.UserID, player.Role)
+	}
+	if p := playerState(t, ws, code, "u1"); !p.Connected {
+		t.Error("player not connected after the takeover")
+	}
+}
+
+func TestCatchUp(t *testing.T) {
+	tests := []struct {
+		name    string
+		buffer  int
+		lastSeq func(seq int64) int64 // The client's last seen seq from the room's seq before the missed events
+		want    string
+	}{
+		{"missed events are buffered", 256, func(seq int64) int64 { return seq }, "replay"},
+		{"missed events were evicted", 2, func(seq int64) int64 { return seq }, "snapshot"},
+		{"nothing seen yet", 256, func(int64) int64 { return 0 }, "snapshot"},
+		{"seq from before a restart", 256, func(seq int64) int64 { return seq + 100 }, "snapshot"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws := newTestService(t)
+			ws.opts.ReplayBuffer = tt.buffer
+			code, _, player, token := sessionRoom(t, ws)
+			var seq int64
+			onRoom(t, ws, code, func(room *models.Room) { seq = ws.roomSeq(room) })
+
+			ws.ClientDisconnected(player)
+			for _, id := range []string{"u2", "u3", "u4"} {
+				joinTestPlayer(t, ws, code, id)
+			}
+
+			client, err := resume(t, ws, code, token, tt.lastSeq(seq))
+			if err != nil {
+				t.Fatal(err)
+			}
+			events := drain(t, client)
+			if len(events) == 0 || events[0].Type != models.EventResumeSuccess {
+				t.Fatalf("first event = %+v, want resume_success", events)
+			}
+			first := events[0]
+			if first.Message != tt.want {
+				t.Fatalf("resumed with %q, want %q", first.Message, tt.want)
+			}
+			if first.Seq <= seq {
+				t.Errorf("resume_success seq = %d, want it past the missed events", first.Seq)
+			}
+			if tt.want == "replay" {
+				if first.Count == 0 || len(events) < 1+first.Count {
+					t.Errorf("replay of %d events, %d queued", first.Count, len(events)-1)
+				}
+				for _, event := range events[1 : 1+first.Count] {
+					if event.Seq <= seq {
+						t.Errorf("replayed event %s with seq %d already seen", event.Type, event.Seq)
+					}
+				}
+			} else if first.Data == nil {
+				t.Error("snapshot without the room view")
+			}
+		})
+	}
+}
@@ -0,0 +1,460 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"powerpoint-quiz/internal/models"
+)
+
+// RoomStore persists rooms by their 4-character code
+type RoomStore interface {
+	Get(code string) (*models.Room, bool)
+	Put(room *models.Room) error
+	Delete(code string) error
+	List() []*models.Room
+}
+
+// MemoryRoomStore keeps rooms in process memory only
+type MemoryRoomStore struct {
+	mu    sync.RWMutex
+	rooms map[string]*models.Room
+}
+
+// NewMemoryRoomStore creates an empty in-memory room store
+func NewMemoryRoomStore() *MemoryRoomStore {
+	return &MemoryRoomStore{
+		rooms: make(map[string]*models.Room),
+	}
+}
+
+// Get returns a room by its code
+func (s *MemoryRoomStore) Get(code string) (*models.Room, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	room, ok := s.rooms[code]
+	return room, ok
+}
+
+// Put stores or replaces a room
+func (s *MemoryRoomStore) Put(room *models.Room) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rooms[room.Code] = room
+	return nil
+}
+
+// Delete removes a room
+func (s *MemoryRoomStore) Delete(code string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.rooms, code)
+	return nil
+}
+
+// List returns all rooms ordered by code
+func (s *MemoryRoomStore) List() []*models.Room {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return sortedRooms(s.rooms)
+}
+
+// storedRoom is the on-disk form of a room; unlike the client-facing JSON it
+// keeps the token epoch, invitations, staff and API key hash so a restarted
+// server still honours revocations, and the creator's address for the room
+// cap
+type storedRoom struct {
+	*models.Room
+	TokenEpoch  int                             `json:"tokenEpoch,omitempty"`
+	DisplayCode string                          `json:"displayCode,omitempty"`
+	Invites     map[string]string               `json:"invites,omitempty"`
+	Members     map[string]*models.Member       `json:"members,omitempty"`
+	APIKeyHash  string                          `json:"apiKeyHash,omitempty"`
+	CreatorIP   string                          `json:"creatorIp,omitempty"`
+	Quiz        *models.Quiz                    `json:"quiz,omitempty"`
+	Answers     map[string]*models.OptionAnswer `json:"answers,omitempty"`
+	ScoreLog    []*models.ScoreAction           `json:"scoreLog,omitempty"`
+}
+
+// journalRecord is one line of the append-only journal
+type journalRecord struct {
+	Op   string          `json:"op"` // "put" or "delete"
+	Code string          `json:"code"`
+	Room json.RawMessage `json:"room,omitempty"`
+}
+
+const (
+	snapshotFileName = "rooms.snapshot.json"
+	journalFileName  = "rooms.journal"
+)
+
+// FileRoomStore keeps rooms in memory and persists every change to disk as a
+// snapshot plus an append-only journal. With a zero flushEvery each journal
+// record is fsynced before Put/Delete returns. Otherwise changes wait up to
+// flushEvery and are written together with a single fsync, each room once
+// with its latest state; a crash loses at most that window. The journal is
+// folded into a fresh snapshot every compactEvery records and on startup.
+type FileRoomStore struct {
+	mu           sync.Mutex
+	dir          string
+	rooms        map[string]*models.Room
+	encoded      map[string]json.RawMessage // last persisted form of each room
+	journal      *os.File
+	records      int
+	compactEvery int
+	flushEvery   time.Duration
+	pending      map[string]journalRecord // Changes waiting for the next flush, by room
+	flushTimer   *time.Timer
+}
+
+// NewFileRoomStore opens (or creates) a file-backed store in dir and restores
+// every room recorded there
+func NewFileRoomStore(dir string, compactEvery int, flushEvery time.Duration) (*FileRoomStore, error) {
+	if compactEvery <= 0 {
+		compactEvery = 1000
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create store dir: %w", err)
+	}
+
+	s := &FileRoomStore{
+		dir:          dir,
+		rooms:        make(map[string]*models.Room),
+		encoded:      make(map[string]json.RawMessage),
+		compactEvery: compactEvery,
+		flushEvery:   flushEvery,
+		pending:      make(map[string]journalRecord),
+	}
+
+	if err := s.loadSnapshot(); err != nil {
+		return nil, err
+	}
+	if err := s.replayJournal(); err != nil {
+		return nil, err
+	}
+
+	journal, err := os.OpenFile(s.path(journalFileName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open journal: %w", err)
+	}
+	s.journal = journal
+
+	// Fold whatever was replayed into a clean snapshot so a torn tail record
+	// from a crash never gets replayed twice
+	if err := s.compact(); err != nil {
+		journal.Close()
+		return nil, err
+	}
+
+	log.Printf("Room store restored %d rooms from %s", len(s.rooms), dir)
+	return s, nil
+}
+
+// Get returns a room by its code
+func (s *FileRoomStore) Get(code string) (*models.Room, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	room, ok := s.rooms[code]
+	return room, ok
+}
+
+// Put stores a room and records its current state, durably unless flushes
+// are batched. A room that did not change since it was last stored is not
+// written again. The caller must make sure the room is not mutated
+// concurrently.
+func (s *FileRoomStore) Put(room *models.Room) error {
+	data, err := json.Marshal(storedRoom{
+		Room:        room,
+		TokenEpoch:  room.TokenEpoch,
+		DisplayCode: room.DisplayCode,
+		Invites:     room.Invites,
+		Members:     room.Members,
+		APIKeyHash:  room.APIKeyHash,
+		CreatorIP:   room.CreatorIP,
+		Quiz:        room.Quiz,
+		Answers:     room.Answers,
+		ScoreLog:    room.ScoreLog,
+	})
+	if err != nil {
+		return fmt.Errorf("encode room %s: %w", room.Code, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if stored, ok := s.rooms[room.Code]; ok && stored == room && bytes.Equal(s.encoded[room.Code], data) {
+		return nil
+	}
+	if err := s.record(journalRecord{Op: "put", Code: room.Code, Room: data}); err != nil {
+		return err
+	}
+	s.rooms[room.Code] = room
+	s.encoded[room.Code] = data
+	return s.maybeCompact()
+}
+
+// Delete removes a room and records the removal, durably unless flushes are
+// batched
+func (s *FileRoomStore) Delete(code string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.rooms[code]; !ok {
+		return nil
+	}
+	if err := s.record(journalRecord{Op: "delete", Code: code}); err != nil {
+		return err
+	}
+	delete(s.rooms, code)
+	delete(s.encoded, code)
+	return s.maybeCompact()
+}
+
+// List returns all rooms ordered by code
+func (s *FileRoomStore) List() []*models.Room {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return sortedRooms(s.rooms)
+}
+
+// Close flushes a final snapshot and closes the journal
+func (s *FileRoomStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.flushTimer != nil {
+		s.flushTimer.Stop()
+		s.flushTimer = nil
+	}
+	if err := s.compact(); err != nil {
+		return err
+	}
+	return s.journal.Close()
+}
+
+func (s *FileRoomStore) path(name string) string {
+	return filepath.Join(s.dir, name)
+}
+
+// record journals a change now, or queues it for the next flush when
+// flushes are batched; a queued change replaces the room's previous one
+func (s *FileRoomStore) record(rec journalRecord) error {
+	if s.flushEvery <= 0 {
+		return s.appendRecords([]journalRecord{rec})
+	}
+	s.pending[rec.Code] = rec
+	if s.flushTimer == nil {
+		s.flushTimer = time.AfterFunc(s.flushEvery, s.flush)
+	}
+	return nil
+}
+
+// flush writes the queued changes with a single fsync
+func (s *FileRoomStore) flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flushTimer = nil
+	if len(s.pending) == 0 {
+		return
+	}
+
+	codes := make([]string, 0, len(s.pending))
+	for code := range s.pending {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	records := make([]journalRecord, 0, len(codes))
+	for _, code := range codes {
+		records = append(records, s.pending[code])
+	}
+	if err := s.appendRecords(records); err != nil {
+		log.Printf("Room store: flushing %d changes failed: %v", len(records), err)
+		return
+	}
+	s.pending = make(map[string]journalRecord)
+	if err := s.maybeCompact(); err != nil {
+		log.Printf("Room store: compaction failed: %v", err)
+	}
+}
+
+// appendRecords writes journal records and fsyncs them once
+func (s *FileRoomStore) appendRecords(records []journalRecord) error {
+	var buf bytes.Buffer
+	for _, rec := range records {
+		line, err := json.Marshal(rec)
+		if err != nil {
+			return fmt.Errorf("encode journal record: %w", err)
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	if _, err := s.journal.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("write journal: %w", err)
+	}
+	if err := s.journal.Sync(); err != nil {
+		return fmt.Errorf("sync journal: %w", err)
+	}
+	s.records += len(records)
+	return nil
+}
+
+func (s *FileRoomStore) maybeCompact() error {
+	if s.records < s.compactEvery {
+		return nil
+	}
+	return s.compact()
+}
+
+// compact writes all rooms to a new snapshot, atomically swaps it in and
+// truncates the journal
+func (s *FileRoomStore) compact() error {
+	snapshot := make(map[string]json.RawMessage, len(s.encoded))
+	for code, data := range s.encoded {
+		snapshot[code] = data
+	}
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("encode snapshot: %w", err)
+	}
+
+	tmpPath := s.path(snapshotFileName + ".tmp")
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("create snapshot: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("sync snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close snapshot: %w", err)
+	}
+	if err := os.Rename(tmpPath, s.path(snapshotFileName)); err != nil {
+		return fmt.Errorf("install snapshot: %w", err)
+	}
+	syncDir(s.dir)
+
+	if err := s.journal.Truncate(0); err != nil {
+		return fmt.Errorf("truncate journal: %w", err)
+	}
+	if err := s.journal.Sync(); err != nil {
+		return fmt.Errorf("sync journal: %w", err)
+	}
+	s.records = 0
+	// The snapshot holds every queued change
+	s.pending = make(map[string]journalRecord)
+	return nil
+}
+
+func (s *FileRoomStore) loadSnapshot() error {
+	data, err := os.ReadFile(s.path(snapshotFileName))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read snapshot: %w", err)
+	}
+
+	var snapshot map[string]json.RawMessage
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return fmt.Errorf("decode snapshot: %w", err)
+	}
+	for code, raw := range snapshot {
+		if err := s.restore(code, raw); err != nil {
+			return fmt.Errorf("decode snapshot room %s: %w", code, err)
+		}
+	}
+	return nil
+}
+
+func (s *FileRoomStore) replayJournal() error {
+	f, err := os.Open(s.path(journalFileName))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("open journal: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		var rec journalRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			// A torn write at the tail is expected after a crash; anything
+			// after it was never acknowledged
+			log.Printf("Room store: ignoring journal from line %d: %v", line, err)
+			break
+		}
+		switch rec.Op {
+		case "put":
+			if err := s.restore(rec.Code, rec.Room); err != nil {
+				log.Printf("Room store: ignoring journal from line %d: %v", line, err)
+				return nil
+			}
+		case "delete":
+			delete(s.rooms, rec.Code)
+			delete(s.encoded, rec.Code)
+		}
+	}
+	return scanner.Err()
+}
+
+func (s *FileRoomStore) restore(code string, raw json.RawMessage) error {
+	stored := storedRoom{Room: &models.Room{}}
+	if err := json.Unmarshal(raw, &stored); err != nil {
+		return err
+	}
+	room := stored.Room
+	room.TokenEpoch = stored.TokenEpoch
+	room.DisplayCode = stored.DisplayCode
+	room.Invites = stored.Invites
+	room.Members = stored.Members
+	room.APIKeyHash = stored.APIKeyHash
+	room.CreatorIP = stored.CreatorIP
+	room.Quiz = stored.Quiz
+	room.Answers = stored.Answers
+	room.ScoreLog = stored.ScoreLog
+	if room.Players == nil {
+		room.Players = make(map[string]*models.Player)
+	}
+	if room.Teams == nil {
+		room.Teams = make(map[string]*models.Team)
+	}
+	s.rooms[code] = room
+	s.encoded[code] = raw
+	return nil
+}
+
+// syncDir fsyncs a directory so a rename inside it survives a crash
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
+
+func sortedRooms(rooms map[string]*models.Room) []*models.Room {
+	out := make([]*models.Room, 0, len(rooms))
+	for _, room := range rooms {
+		out = append(out, room)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Code < out[j].Code })
+	return out
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"powerpoint-quiz/internal/models"
+)
+
+func testRoom(code string) *models.Room {
+	return &models.Room{
+		Code:        code,
+		Players:     map[string]*models.Player{"u1": {UserID: "u1", Name: "Ann", Score: 3}},
+		Teams:       map[string]*models.Team{},
+		TokenEpoch:  2,
+		DisplayCode: "123456",
+		APIKeyHash:  "hash",
+	}
+}
+
+// journalLines returns the number of records in a store's journal
+func journalLines(t *testing.T, dir string) int {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, journalFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.Count(data, []byte("\n"))
+}
+
+func TestFileRoomStoreReplay(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(t *testing.T, s *FileRoomStore)
+		want   map[string]int // Room code -> score of u1
+	}{
+		{
+			name: "put",
+			change: func(t *testing.T, s *FileRoomStore) {
+				if err := s.Put(testRoom("AAAA")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: map[string]int{"AAAA": 3},
+		},
+		{
+			name: "latest put wins",
+			change: func(t *testing.T, s *FileRoomStore) {
+				room := testRoom("AAAA")
+				s.Put(room)
+				room.Players["u1"].Score = 7
+				s.Put(room)
+			},
+			want: map[string]int{"AAAA": 7},
+		},
+		{
+			name: "delete",
+			change: func(t *testing.T, s *FileRoomStore) {
+				s.Put(testRoom("AAAA"))
+				s.Put(testRoom("BBBB"))
+				if err := s.Delete("AAAA"); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: map[string]int{"BBBB": 3},
+		},
+	}
+
+	for _, tt := range tests {
+		for _, flushEvery := range []time.Duration{0, time.Hour} {
+			t.Run(tt.name+"/"+flushEvery.String(), func(t *testing.T) {
+				dir := t.TempDir()
+				s, err := NewFileRoomStore(dir, 1000, flushEvery)
+				if err != nil {
+					t.Fatal(err)
+				}
+				tt.change(t, s)
+				if flushEvery > 0 {
+					s.flush()
+				}
+
+				// Reopen without closing, as after a crash
+				reopened, err := NewFileRoomStore(dir, 1000, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer reopened.Close()
+				rooms := reopened.List()
+				if len(rooms) != len(tt.want) {
+					t.Fatalf("restored %d rooms, want %d", len(rooms), len(tt.want))
+				}
+				for _, room := range rooms {
+					score, ok := tt.want[room.Code]
+					if !ok {
+						t.Fatalf("unexpected room %s", room.Code)
+					}
+					if room.Players["u1"].Score != score {
+						t.Errorf("room %s score = %d, want %d", room.Code, room.Players["u1"].Score, score)
+					}
+					if room.TokenEpoch != 2 || room.DisplayCode != "123456" || room.APIKeyHash != "hash" {
+						t.Errorf("room %s lost its credentials: %+v", room.Code, room)
+					}
+				}
+			})
+		}
+	}
+}
+
+// Batched changes reach the journal only when flushed, one record per room
+func TestFileRoomStoreBatchesFlushes(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewFileRoomStore(dir, 1000, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	room := testRoom("AAAA")
+	for i := 0; i < 5; i++ {
+		room.Players["u1"].Score = i
+		s.Put(room)
+	}
+	s.Put(testRoom("BBBB"))
+	if n := journalLines(t, dir); n != 0 {
+		t.Fatalf("journal has %d records before the flush", n)
+	}
+
+	s.flush()
+	if n := journalLines(t, dir); n != 2 {
+		t.Fatalf("journal has %d records after the flush, want 2", n)
+	}
+}
+
+func TestFileRoomStoreSkipsUnchangedRooms(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewFileRoomStore(dir, 1000, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	room := testRoom("AAAA")
+	s.Put(room)
+	s.Put(room)
+	if n := journalLines(t, dir); n != 1 {
+		t.Errorf("journal has %d records, want 1", n)
+	}
+}
+
+// A record torn by a crash and everything after it is ignored
+func TestFileRoomStoreIgnoresTornTail(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewFileRoomStore(dir, 1000, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Put(testRoom("AAAA"))
+
+	f, err := os.OpenFile(filepath.Join(dir, journalFileName), os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"op":"put","code":"BBBB","room":{"co`)
+	f.Close()
+
+	reopened, err := NewFileRoomStore(dir, 1000, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if _, ok := reopened.Get("AAAA"); !ok {
+		t.Error("room before the torn record was lost")
+	}
+	if _, ok := reopened.Get("BBBB"); ok {
+		t.Error("torn record was restored")
+	}
+}
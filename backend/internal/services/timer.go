@@ -0,0 +1,303 @@
+package services
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"powerpoint-quiz/internal/models"
+)
+
+// Timer kinds; each room has at most one running timer of each kind
+const (
+	TimerQuestion   = "question"    // Answering time limit of the current question
+	TimerStartDelay = "start_delay" // Delay between the started and active phases
+)
+
+// countdown is a cancellable room timer. Its fields are only touched by the
+// room's actor.
+type countdown struct {
+	kind        string
+	questionSeq int // Room.QuestionSeq the timer was started for
+	duration    time.Duration
+	remaining   time.Duration // Valid while paused
+	deadline    time.Time     // Valid while running
+	running     bool
+	stop        chan struct{} // Closed to stop the goroutine of the current run
+	onExpire    func()
+}
+
+func (c *countdown) remainingNow() time.Duration {
+	if !c.running {
+		return c.remaining
+	}
+	if left := time.Until(c.deadline); left > 0 {
+		return left
+	}
+	return 0
+}
+
+// getTimer returns a room's timer of the given kind, or nil
+func (ws *WebSocketService) getTimer(room *models.Room, kind string) *countdown {
+	return ws.actorOf(room).timers[kind]
+}
+
+// startTimer replaces the room's timer of the given kind with a new
+// countdown. onExpire runs on the room's actor, and only if the timer was not
+// cancelled or replaced and the room is still on the same question.
+func (ws *WebSocketService) startTimer(room *models.Room, kind string, d time.Duration, onExpire func()) {
+	ws.cancelTimer(room, kind)
+
+	c := &countdown{
+		kind:        kind,
+		questionSeq: room.QuestionSeq,
+		duration:    d,
+		onExpire:    onExpire,
+	}
+	ws.actorOf(room).timers[kind] = c
+
+	ws.runTimer(room, c, d)
+	log.Printf("Timer %s started in room %s for %v", kind, room.Code, d)
+}
+
+// pauseTimer freezes a running timer
+func (ws *WebSocketService) pauseTimer(room *models.Room, kind string) bool {
+	c := ws.getTimer(room, kind)
+	if c == nil || !c.running {
+		return false
+	}
+	c.remaining = c.remainingNow()
+	c.running = false
+	close(c.stop)
+	ws.broadcastTimer(room, c)
+	return true
+}
+
+// resumeTimer restarts a paused timer
+func (ws *WebSocketService) resumeTimer(room *models.Room, kind string) bool {
+	c := ws.getTimer(room, kind)
+	if c == nil || c.running {
+		return false
+	}
+	ws.runTimer(room, c, c.remaining)
+	return true
+}
+
+// extendTimer adds time to a running or paused timer
+func (ws *WebSocketService) extendTimer(room *models.Room, kind string, d time.Duration) bool {
+	c := ws.getTimer(room, kind)
+	if c == nil {
+		return false
+	}
+	c.duration += d
+	if !c.running {
+		c.remaining += d
+		ws.broadcastTimer(room, c)
+		return true
+	}
+	left := c.remainingNow() + d
+	close(c.stop)
+	ws.runTimer(room, c, left)
+	return true
+}
+
+// cancelTimer stops and forgets a room's timer
+func (ws *WebSocketService) cancelTimer(room *models.Room, kind string) bool {
+	timers := ws.actorOf(room).timers
+	c := timers[kind]
+	delete(timers, kind)
+
+	if c == nil {
+		return false
+	}
+	if c.running {
+		c.running = false
+		close(c.stop)
+	}
+	return true
+}
+
+// cancelRoomTimers stops every timer of a room
+func (ws *WebSocketService) cancelRoomTimers(room *models.Room) {
+	ws.cancelTimer(room, TimerQuestion)
+	ws.cancelTimer(room, TimerStartDelay)
+}
+
+// timerState describes a timer for clients
+func timerState(c *countdown) *models.TimerState {
+	return &models.TimerState{
+		Kind:        c.kind,
+		QuestionSeq: c.questionSeq,
+		DurationMs:  c.duration.Milliseconds(),
+		RemainingMs: c.remainingNow().Milliseconds(),
+		Running:     c.running,
+	}
+}
+
+// broadcastTimer sends the current state of a timer to the room. Ticks are
+// not sequenced or kept for replay, so they cannot push the room's events
+// out of the replay buffer; a reconnecting client gets the running timers
+// with its catch-up, see sendTimers.
+func (ws *WebSocketService) broadcastTimer(room *models.Room, c *countdown) {
+	message, err := json.Marshal(timerTick(c))
+	if err != nil {
+		log.Printf("Error marshaling event: %v", err)
+		return
+	}
+	tick := newWireMessage(message)
+	for client := range ws.actorOf(room).clients {
+		ws.sendMessage(client, tick)
+	}
+}
+
+// sendTimers sends the state of each of the room's timers to a client
+func (ws *WebSocketService) sendTimers(client *models.Client, room *models.Room) {
+	timers := ws.actorOf(room).timers
+	for _, kind := range []string{TimerQuestion, TimerStartDelay} {
+		if c := timers[kind]; c != nil {
+			ws.sendEventToClient(client, timerTick(c))
+		}
+	}
+}
+
+func timerTick(c *countdown) models.Event {
+	return models.Event{
+		Type: models.EventTimerTick,
+		Data: timerState(c),
+	}
+}
+
+// runTimer starts a run of c lasting d with its own tick goroutine
+func (ws *WebSocketService) runTimer(room *models.Room, c *countdown, d time.Duration) {
+	stop := make(chan struct{})
+	c.stop = stop
+	c.running = true
+	c.deadline = time.Now().Add(d)
+	ws.broadcastTimer(room, c)
+
+	go func() {
+		ticker := time.NewTicker(ws.opts.TimerTick)
+		defer ticker.Stop()
+		expire := time.NewTimer(d)
+		defer expire.Stop()
+
+		// current reports whether this run is still the live one; it must be
+		// called from the room's actor
+		current := func() bool {
+			select {
+			case <-stop:
+				return false
+			default:
+			}
+			return ws.getTimer(room, c.kind) == c
+		}
+
+		for {
+			select {
+			case <-stop:
+				return
+
+			case <-ticker.C:
+				ws.post(room.Code, func(a *roomActor) {
+					if current() {
+						ws.broadcastTimer(room, c)
+					}
+				})
+
+			case <-expire.C:
+				ws.post(room.Code, func(a *roomActor) {
+					if !current() {
+						return
+					}
+					ws.cancelTimer(room, c.kind)
+					// A timer never outlives the question it was started for
+					if room.QuestionSeq == c.questionSeq {
+						c.onExpire()
+						ws.saveRoom(room)
+					}
+				})
+				return
+			}
+		}
+	}()
+}
+
+// startQuestionTimer starts the answering countdown of the current question:
+// d if positive, otherwise the question's time limit.
+func (ws *WebSocketService) startQuestionTimer(room *models.Room, d time.Duration, onExpire func()) {
+	if d <= 0 {
+		if q := currentQuizQuestion(room); q != nil && q.TimeLimit > 0 {
+			d = time.Duration(q.TimeLimit) * time.Second
+		}
+	}
+	if d <= 0 {
+		ws.cancelTimer(room, TimerQuestion)
+		return
+	}
+	if onExpire == nil {
+		onExpire = func() { ws.timeUp(room) }
+	}
+	ws.startTimer(room, TimerQuestion, d, onExpire)
+}
+
+// timeUp ends answering for the current question when its time runs out.
+// Multiple-choice answers are locked even if answering already stopped.
+func (ws *WebSocketService) timeUp(room *models.Room) {
+	q := currentQuizQuestion(room)
+	openChoice := q != nil && q.Type == models.QuestionMultipleChoice && !room.AnswersLocked
+	if !room.QuestionActive && !openChoice {
+		return
+	}
+
+	questionID := ""
+	if room.CurrentQuestion != nil {
+		questionID = room.CurrentQuestion.ID
+	}
+	ws.commit(room, "system", models.Event{
+		Type:       models.EventTimeUp,
+		QuestionID: questionID,
+	})
+	log.Printf("Time is up in room %s", room.Code)
+
+	timeUpEvent := models.Event{
+		Type:       models.EventTimeUp,
+		QuestionID: questionID,
+	}
+	ws.broadcastToRoom(room, timeUpEvent)
+
+	if openChoice {
+		ws.lockAnswers(room, "system")
+		return
+	}
+	ws.broadcastRoomState(room)
+}
+
+// handleTimerControl processes host timer commands for the question timer
+func (ws *WebSocketService) handleTimerControl(client *models.Client, room *models.Room, event models.Event) error {
+	ok := false
+	switch event.Type {
+	case models.EventTimerStart:
+		if !room.QuestionActive {
+			return refuse(models.ErrCodeInvalidState, "No active question")
+		}
+		ws.startQuestionTimer(room, time.Duration(event.DurationMs)*time.Millisecond, nil)
+		ok = ws.getTimer(room, TimerQuestion) != nil
+	case models.EventTimerPause:
+		ok = ws.pauseTimer(room, TimerQuestion)
+	case models.EventTimerResume:
+		ok = ws.resumeTimer(room, TimerQuestion)
+	case models.EventTimerExtend:
+		ok = event.DurationMs > 0 && ws.extendTimer(room, TimerQuestion, time.Duration(event.DurationMs)*time.Millisecond)
+	case models.EventTimerCancel:
+		ok = ws.cancelTimer(room, TimerQuestion)
+		if ok {
+			ws.broadcastToRoom(room, models.Event{Type: models.EventTimerCancel})
+		}
+	}
+
+	if !ok {
+		return refuse(models.ErrCodeInvalidState, "Timer is not in a state that allows "+string(event.Type))
+	}
+	log.Printf("Timer %s in room %s", event.Type, room.Code)
+	return nil
+}
@@ -0,0 +1,265 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"powerpoint-quiz/internal/models"
+)
+
+// Timer ticks carry no sequence number and stay out of the replay buffer,
+// and a reconnecting client gets the running timers with its catch-up
+func TestTimerTicksAreNotReplayed(t *testing.T) {
+	ws := newTestService(t)
+	admin := newTestClient(ws, "192.0.2.1")
+	code := createTestRoom(t, ws, admin, nil)
+	player := joinTestPlayer(t, ws, code, "u1")
+
+	var lastSeq int64
+	onRoom(t, ws, code, func(room *models.Room) {
+		lastSeq = ws.roomSeq(room)
+		ws.startQuestionTimer(room, time.Minute, func() {})
+		ws.pauseTimer(room, TimerQuestion)
+		if seq := ws.roomSeq(room); seq != lastSeq {
+			t.Errorf("timer ticks moved the room sequence from %d to %d", lastSeq, seq)
+		}
+		if missed, _ := ws.eventsSince(room, lastSeq, true); len(missed) != 0 {
+			t.Errorf("%d timer ticks were kept for replay", len(missed))
+		}
+	})
+	tick, ok := received(t, player, models.EventTimerTick)
+	if !ok {
+		t.Fatal("player got no timer_tick")
+	}
+	if tick.Seq != 0 {
+		t.Errorf("timer_tick has seq %d", tick.Seq)
+	}
+
+	tests := []struct {
+		name    string
+		lastSeq int64
+		mode    string
+	}{
+		{"replay", lastSeq, "replay"},
+		{"snapshot", 0, "snapshot"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			onRoom(t, ws, code, func(room *models.Room) {
+				ws.catchUp(player, room, models.Event{Type: models.EventResumeSuccess}, tt.lastSeq)
+			})
+			events := drain(t, player)
+			if len(events) == 0 || events[0].Message != tt.mode {
+				t.Fatalf("catch-up did not start with a %s: %+v", tt.mode, events)
+			}
+			if events[len(events)-1].Type != models.EventTimerTick {
+				t.Errorf("catch-up ended with %s, want the timer", events[len(events)-1].Type)
+			}
+		})
+	}
+}
+
+// timerRoom creates a room and returns its code
+func timerRoom(t *testing.T) (*WebSocketService, string) {
+	t.Helper()
+	ws := newTestService(t)
+	return ws, createTestRoom(t, ws, newTestClient(ws, "192.0.2.1"), nil)
+}
+
+// questionTimer returns a copy of the room's question timer
+func questionTimer(t *testing.T, ws *WebSocketService, code string) countdown {
+	t.Helper()
+	var c countdown
+	onRoom(t, ws, code, func(room *models.Room) {
+		if timer := ws.getTimer(room, TimerQuestion); timer != nil {
+			c = *timer
+		}
+	})
+	return c
+}
+
+// expired reports whether fired got a value within d
+func expired(fired chan struct{}, d time.Duration) bool {
+	select {
+	case <-fired:
+		return true
+	case <-time.After(d):
+		return false
+	}
+}
+
+func TestTimerPauseAndResume(t *testing.T) {
+	ws, code := timerRoom(t)
+	onRoom(t, ws, code, func(room *models.Room) {
+		ws.startTimer(room, TimerQuestion, time.Minute, func() {})
+	})
+	time.Sleep(20 * time.Millisecond)
+
+	var paused time.Duration
+	onRoom(t, ws, code, func(room *models.Room) {
+		if !ws.pauseTimer(room, TimerQuestion) {
+			t.Error("running timer not paused")
+		}
+		if ws.pauseTimer(room, TimerQuestion) {
+			t.Error("paused timer paused again")
+		}
+		paused = ws.getTimer(room, TimerQuestion).remainingNow()
+	})
+	if paused >= time.Minute-20*time.Millisecond || paused < time.Minute-time.Second {
+		t.Fatalf("paused with %v left", paused)
+	}
+
+	// A paused timer does not run down
+	time.Sleep(20 * time.Millisecond)
+	if c := questionTimer(t, ws, code); c.running || c.remainingNow() != paused {
+		t.Fatalf("paused timer has %v left, running %v; want %v", c.remainingNow(), c.running, paused)
+	}
+
+	onRoom(t, ws, code, func(room *models.Room) {
+		if !ws.resumeTimer(room, TimerQuestion) {
+			t.Error("paused timer not resumed")
+		}
+		if ws.resumeTimer(room, TimerQuestion) {
+			t.Error("running timer resumed again")
+		}
+	})
+	c := questionTimer(t, ws, code)
+	if left := c.remainingNow(); !c.running || left > paused || left < paused-time.Second {
+		t.Errorf("resumed timer has %v left, running %v; want about %v", left, c.running, paused)
+	}
+}
+
+func TestTimerExtend(t *testing.T) {
+	tests := []struct {
+		name   string
+		paused bool
+	}{
+		{"running", false},
+		{"paused", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws, code := timerRoom(t)
+			var before time.Duration
+			onRoom(t, ws, code, func(room *models.Room) {
+				ws.startTimer(room, TimerQuestion, time.Minute, func() {})
+				if tt.paused {
+					ws.pauseTimer(room, TimerQuestion)
+				}
+				before = ws.getTimer(room, TimerQuestion).remainingNow()
+				if !ws.extendTimer(room, TimerQuestion, 30*time.Second) {
+					t.Error("timer not extended")
+				}
+			})
+
+			c := questionTimer(t, ws, code)
+			if c.running == tt.paused {
+				t.Errorf("running = %v after extending", c.running)
+			}
+			if c.duration != 90*time.Second {
+				t.Errorf("duration = %v, want 1m30s", c.duration)
+			}
+			if left := c.remainingNow(); left > before+30*time.Second || left < before+29*time.Second {
+				t.Errorf("%v left after extending %v by 30s", left, before)
+			}
+		})
+	}
+}
+
+func TestTimerExtendWithoutTimer(t *testing.T) {
+	ws, code := timerRoom(t)
+	onRoom(t, ws, code, func(room *models.Room) {
+		if ws.extendTimer(room, TimerQuestion, time.Second) {
+			t.Error("missing timer extended")
+		}
+	})
+}
+
+func TestTimerExpires(t *testing.T) {
+	ws, code := timerRoom(t)
+	fired := make(chan struct{}, 1)
+	onRoom(t, ws, code, func(room *models.Room) {
+		ws.startTimer(room, TimerQuestion, 10*time.Millisecond, func() { fired <- struct{}{} })
+	})
+	if !expired(fired, 2*time.Second) {
+		t.Fatal("timer did not expire")
+	}
+	onRoom(t, ws, code, func(room *models.Room) {
+		if ws.getTimer(room, TimerQuestion) != nil {
+			t.Error("expired timer kept")
+		}
+	})
+}
+
+func TestTimerCancelStopsExpiry(t *testing.T) {
+	ws, code := timerRoom(t)
+	fired := make(chan struct{}, 1)
+	onRoom(t, ws, code, func(room *models.Room) {
+		ws.startTimer(room, TimerQuestion, 20*time.Millisecond, func() { fired <- struct{}{} })
+		if !ws.cancelTimer(room, TimerQuestion) {
+			t.Error("running timer not cancelled")
+		}
+		if ws.cancelTimer(room, TimerQuestion) {
+			t.Error("timer cancelled twice")
+		}
+	})
+	if expired(fired, 100*time.Millisecond) {
+		t.Error("cancelled timer expired")
+	}
+}
+
+// A paused timer does not expire until it is resumed
+func TestTimerPausedDoesNotExpire(t *testing.T) {
+	ws, code := timerRoom(t)
+	fired := make(chan struct{}, 1)
+	onRoom(t, ws, code, func(room *models.Room) {
+		ws.startTimer(room, TimerQuestion, 20*time.Millisecond, func() { fired <- struct{}{} })
+		ws.pauseTimer(room, TimerQuestion)
+	})
+	if expired(fired, 100*time.Millisecond) {
+		t.Fatal("paused timer expired")
+	}
+	onRoom(t, ws, code, func(room *models.Room) { ws.resumeTimer(room, TimerQuestion) })
+	if !expired(fired, 2*time.Second) {
+		t.Error("resumed timer did not expire")
+	}
+}
+
+// A timer started for one question never fires once the room moved on to
+// another
+func TestTimerIgnoresLaterQuestion(t *testing.T) {
+	ws, code := timerRoom(t)
+	fired := make(chan struct{}, 1)
+	onRoom(t, ws, code, func(room *models.Room) {
+		ws.startTimer(room, TimerQuestion, 10*time.Millisecond, func() { fired <- struct{}{} })
+		room.QuestionSeq++
+	})
+	if expired(fired, 100*time.Millisecond) {
+		t.Error("timer of an earlier question expired")
+	}
+}
+
+func TestTimerControlRefusals(t *testing.T) {
+	ws := newTestService(t)
+	admin := newTestClient(ws, "192.0.2.1")
+	code := createTestRoom(t, ws, admin, nil)
+
+	for _, eventType := range []models.EventType{models.EventTimerPause, models.EventTimerResume, models.EventTimerCancel, models.EventTimerStart} {
+		err := dispatch(t, ws, admin, code, models.Event{Type: eventType, DurationMs: 1000})
+		if refusalCode(err) != models.ErrCodeInvalidState {
+			t.Errorf("%s without a timer: error = %v, want %s", eventType, err, models.ErrCodeInvalidState)
+		}
+	}
+
+	if err := dispatch(t, ws, admin, code, models.Event{Type: models.EventStartQuestion, DurationMs: 60000}); err != nil {
+		t.Fatal(err)
+	}
+	if err := dispatch(t, ws, admin, code, models.Event{Type: models.EventTimerExtend}); refusalCode(err) != models.ErrCodeInvalidState {
+		t.Errorf("extend by nothing: error = %v", err)
+	}
+	for _, eventType := range []models.EventType{models.EventTimerPause, models.EventTimerResume, models.EventTimerCancel} {
+		if err := dispatch(t, ws, admin, code, models.Event{Type: eventType}); err != nil {
+			t.Errorf("%s: %v", eventType, err)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"bytes"
 	"crypto/rand"
 	"encoding/json"
 	"fmt"
@@ -8,10 +9,11 @@ import (
 	"math/big"
 	"net/http"
 	"net/url"
-	"os"
 	"strings"
+	"sync"
 	"time"
 
+	"powerpoint-quiz/internal/config"
 	"powerpoint-quiz/internal/models"
 
 	"github.com/gorilla/websocket"
@@ -19,14 +21,34 @@ import (
 
 // WebSocketService handles WebSocket connections and events
 type WebSocketService struct {
-	hub *models.Hub
+	hub     *models.Hub
+	store   RoomStore
+	history HistoryStore
+	opts    Options
+	rooms   map[string]*roomActor // Running room actors keyed by room code
+	roomsMu sync.RWMutex
+	auth    *authLimiter
+	// Rate limits of connections and addresses
+	connLimits *rateLimiter
+	ipLimits   *rateLimiter
+	// createMu makes counting an address's rooms and creating one atomic
+	createMu sync.Mutex
+	// lastClientID is the ID of the newest client, updated atomically
+	lastClientID uint64
 }
 
-// NewWebSocketService creates a new WebSocket service
-func NewWebSocketService() *WebSocketService {
+// NewWebSocketService creates a new WebSocket service backed by the given
+// room store and event history
+func NewWebSocketService(store RoomStore, history HistoryStore, opts Options) *WebSocketService {
 	return &WebSocketService{
+		store:      store,
+		history:    history,
+		opts:       opts,
+		rooms:      make(map[string]*roomActor),
+		auth:       newAuthLimiter(opts.AuthMaxFailures, opts.AuthLockout),
+		connLimits: newRateLimiter(opts.ConnRateLimits),
+		ipLimits:   newRateLimiter(opts.IPRateLimits),
 		hub: &models.Hub{
-			Rooms:      make(map[string]*models.Room),
 			Clients:    make(map[*models.Client]bool),
 			Register:   make(chan *models.Client),
 			Unregister: make(chan *models.Client),
@@ -51,159 +73,242 @@ func generateRoomCode() string {
 	return string(code)
 }
 
-// generateAdminPassword generates a random admin password
-func generateAdminPassword() string {
-	const charset = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	password := make([]byte, 6)
-	for i := range password {
+// generateDisplayCode generates a random display pairing code
+func generateDisplayCode() string {
+	code := make([]byte, 6)
+	for i := range code {
+		num, _ := rand.Int(rand.Reader, big.NewInt(10))
+		code[i] = byte('0' + num.Int64())
+	}
+	return string(code)
+}
+
+// generateInviteCode generates a random invitation code
+func generateInviteCode() string {
+	const charset = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	code := make([]byte, 8)
+	for i := range code {
 		num, _ := rand.Int(rand.Reader, big.NewInt(int64(len(charset))))
-		password[i] = charset[num.Int64()]
+		code[i] = charset[num.Int64()]
 	}
-	return string(password)
+	return string(code)
 }
 
-// Run starts the hub's main loop
+// Run starts the hub's main loop. It only tracks open connections; room
+// membership lives in the room actors.
 func (ws *WebSocketService) Run() {
 	for {
 		select {
 		case client := <-ws.hub.Register:
 			ws.hub.Clients[client] = true
-			log.Printf("Client connected: %s", client.UserID)
+			log.Printf("Client connected: %s", client.Conn.RemoteAddr())
 
 		case client := <-ws.hub.Unregister:
 			if _, ok := ws.hub.Clients[client]; ok {
 				delete(ws.hub.Clients, client)
 				close(client.Send)
-				log.Printf("Client disconnected: %s", client.UserID)
+				ws.connLimits.forget(connKey(client))
+				log.Printf("Client disconnected: %s", client.Conn.RemoteAddr())
 			}
 
 		case message := <-ws.hub.Broadcast:
+			wire := newWireMessage(message)
 			for client := range ws.hub.Clients {
-				select {
-				case client.Send <- message:
-				default:
-					close(client.Send)
-					delete(ws.hub.Clients, client)
-				}
+				ws.sendMessage(client, wire)
 			}
 		}
 	}
 }
 
-// HandleEvent processes incoming WebSocket events
+// HandleEvent routes an incoming WebSocket event to the actor of its room
+// and replies once it has been handled, see reply. Events for the client's
+// own room are queued; joining another room first takes the client out of
+// its current one and then waits for the new room, so only one room actor
+// ever uses a client at a time.
 func (ws *WebSocketService) HandleEvent(client *models.Client, event models.Event) {
-	ws.hub.Mu.Lock()
-	defer ws.hub.Mu.Unlock()
-
-	roomID := event.QuizID
-	if roomID == "" {
-		// For admin_auth events, use RoomCode instead of QuizID
-		if event.Type == models.EventAdminAuth {
-			roomID = event.RoomCode
-		} else {
-			roomID = client.RoomID // Use client's room if not specified
-		}
+	if event.Type == models.EventCreateRoom {
+		ws.unbindClient(client)
+		ws.reply(client, event, ws.handleCreateRoom(client, event))
+		return
+	}
+
+	roomID := ws.eventRoom(client, event)
+	dispatch := func(a *roomActor) {
+		err := ws.dispatchEvent(client, a.room, event)
+		ws.saveRoom(a.room)
+		ws.reply(client, event, err)
 	}
 
-	// Get or create room
-	room, exists := ws.hub.Rooms[roomID]
-	if !exists && event.Type != models.EventCreateRoom {
-		// For non-create-room events, check if room exists
-		room = nil
-	} else if !exists {
-		// Only create room for create_room events
-		room = &models.Room{
-			ID:        roomID,
-			Phase:     models.PhaseLobby,
-			Players:   make(map[string]*models.Player),
-			Teams:     make(map[string]*models.Team),
-			CreatedAt: time.Now(),
+	if roomID == client.RoomID {
+		if ws.post(roomID, dispatch) {
+			return
 		}
-		ws.hub.Rooms[roomID] = room
+	} else if isBindingEvent(event.Type) {
+		if ws.actorFor(roomID) != nil {
+			ws.unbindClient(client)
+		}
+		if ws.call(roomID, dispatch) {
+			return
+		}
+	} else {
+		log.Printf("Ignoring %s for room %s from a client of room %q", event.Type, roomID, client.RoomID)
+		ws.reply(client, event, refuseQuietly(models.ErrCodeForbidden, "Not a member of room "+roomID))
+		return
 	}
 
+	// The room does not exist
+	var err error
 	switch event.Type {
-	case models.EventCreateRoom:
-		ws.handleCreateRoom(client, event)
+	case models.EventJoin:
+		err = ws.handleJoin(client, nil, event)
+	case models.EventResume:
+		err = ws.handleResume(client, nil, event)
+	case models.EventAdminAuth, models.EventHostAuth, models.EventPairDisplay, models.EventRedeemInvite:
+		err = refuse(models.ErrCodeNotFound, "Room not found")
+	case models.EventClockSync:
+		err = ws.handleClockSync(client, event)
+	case models.EventClockPong:
+		err = ws.handleClockPong(client, event)
+	default:
+		err = refuseQuietly(models.ErrCodeNotFound, "Room not found")
+	}
+	ws.reply(client, event, err)
+}
 
-	case models.EventAdminAuth:
-		if room != nil {
-			ws.handleAdminAuth(client, room, event)
-		} else {
-			ws.sendErrorToClient(client, "Room not found")
+// eventRoom picks the room an event is meant for
+func (ws *WebSocketService) eventRoom(client *models.Client, event models.Event) string {
+	if event.Type == models.EventResume && event.SessionToken != "" {
+		// The session names the room; a bad token is reported by handleResume
+		if claims, err := ws.verifySession(event.SessionToken); err == nil {
+			return claims.Room
 		}
+	}
+	if event.QuizID != "" {
+		return event.QuizID
+	}
+	// Authentication events name the room by RoomCode instead of QuizID
+	if isAuthEvent(event.Type) && event.RoomCode != "" {
+		return event.RoomCode
+	}
+	return client.RoomID // Use client's room if not specified
+}
+
+// isBindingEvent reports whether an event may move a client into a room
+func isBindingEvent(t models.EventType) bool {
+	return t == models.EventJoin || t == models.EventResume || isAuthEvent(t)
+}
+
+// isAuthEvent reports whether an event asks for a role
+func isAuthEvent(t models.EventType) bool {
+	return t == models.EventAdminAuth || t == models.EventHostAuth || t == models.EventPairDisplay ||
+		t == models.EventRedeemInvite
+}
+
+// dispatchEvent runs the handler of an event on the room's actor and
+// returns why it was refused, if it was
+func (ws *WebSocketService) dispatchEvent(client *models.Client, room *models.Room, event models.Event) error {
+	if err := authorize(client, event.Type); err != nil {
+		return err
+	}
+
+	switch event.Type {
+	case models.EventAdminAuth:
+		return ws.handleAdminAuth(client, room, event)
+
+	case models.EventHostAuth:
+		return ws.handleHostAuth(client, room, event)
+
+	case models.EventPairDisplay:
+		return ws.handlePairDisplay(client, room, event)
+
+	case models.EventRedeemInvite:
+		return ws.handleRedeemInvite(client, room, event)
+
+	case models.EventCreateInvite:
+		return ws.handleCreateInvite(client, room, event)
+
+	case models.EventRevokeMember:
+		return ws.handleRevokeMember(room, event)
+
+	case models.EventRevokeTokens:
+		return ws.handleRevokeTokens(client, room)
+
+	case models.EventRotateAPIKey:
+		return ws.handleRotateAPIKey(client, room)
 
 	case models.EventJoinTeam:
-		if room != nil {
-			room.Mu.Lock()
-			ws.handleJoinTeam(client, room, event)
-			room.Mu.Unlock()
-		}
+		return ws.handleJoinTeam(client, room, event)
 
 	case models.EventCreateTeam:
-		if room != nil {
-			room.Mu.Lock()
-			ws.handleCreateTeam(client, room, event)
-			room.Mu.Unlock()
-		}
+		return ws.handleCreateTeam(client, room, event)
 
 	case models.EventJoin:
-		ws.handleJoin(client, room, event)
+		return ws.handleJoin(client, room, event)
+
+	case models.EventResume:
+		return ws.handleResume(client, room, event)
+
+	case models.EventLeave:
+		return ws.handleLeave(client, room)
+
+	case models.EventClockSync:
+		return ws.handleClockSync(client, event)
+
+	case models.EventClockPong:
+		return ws.handleClockPong(client, event)
 
 	case models.EventClick:
-		if room != nil {
-			room.Mu.Lock()
-			ws.handleClick(client, room, event)
-			room.Mu.Unlock()
-		}
+		return ws.handleClick(client, room, event)
 
 	case models.EventHostSetState:
-		if room != nil {
-			room.Mu.Lock()
-			ws.handleHostSetState(client, room, event)
-			room.Mu.Unlock()
-		}
+		return ws.handleHostSetState(client, room, event)
 
 	case models.EventStartQuestion:
-		if room != nil {
-			room.Mu.Lock()
-			ws.handleStartQuestion(client, room, event)
-			room.Mu.Unlock()
-		}
+		return ws.handleStartQuestion(client, room, event)
 
 	case models.EventAnswerReceived:
-		if room != nil {
-			room.Mu.Lock()
-			ws.handleAnswerReceived(client, room, event)
-			room.Mu.Unlock()
-		}
+		return ws.handleAnswerReceived(client, room, event)
 
 	case models.EventAnswerConfirmation:
-		if room != nil {
-			room.Mu.Lock()
-			ws.handleAnswerConfirmation(client, room, event)
-			room.Mu.Unlock()
-		}
+		return ws.handleAnswerConfirmation(client, room, event)
 
 	case models.EventShowAnswer:
-		if room != nil {
-			room.Mu.Lock()
-			ws.handleShowAnswer(client, room, event)
-			room.Mu.Unlock()
-		}
+		return ws.handleShowAnswer(client, room, event)
 
 	case models.EventNextQuestion:
-		if room != nil {
-			room.Mu.Lock()
-			ws.handleNextQuestion(client, room, event)
-			room.Mu.Unlock()
-		}
+		return ws.handleNextQuestion(client, room, event)
+
+	case models.EventLoadQuiz:
+		return ws.handleLoadQuiz(client, room, event)
+
+	case models.EventSubmitAnswer:
+		return ws.handleSubmitAnswer(client, room, event)
+
+	case models.EventLockAnswers:
+		return ws.handleLockAnswers(client, room, event)
+
+	case models.EventSetScoring:
+		return ws.handleSetScoring(client, room, event)
+
+	case models.EventScoreAdjust:
+		return ws.handleScoreAdjust(client, room, event)
+
+	case models.EventScoreUndo:
+		return ws.handleScoreUndo(client, room, event)
+
+	case models.EventLeaderboard:
+		return ws.handleLeaderboard(client, room)
+
+	case models.EventTimerStart, models.EventTimerPause, models.EventTimerResume,
+		models.EventTimerExtend, models.EventTimerCancel:
+		return ws.handleTimerControl(client, room, event)
 	}
+	return refuseQuietly(models.ErrCodeUnknownType, fmt.Sprintf("Unknown command %q", event.Type))
 }
 
 // handleJoin processes player join events
-func (ws *WebSocketService) handleJoin(client *models.Client, room *models.Room, event models.Event) {
-	// Check if room exists
+func (ws *WebSocketService) handleJoin(client *models.Client, room *models.Room, event models.Event) error {
+	// Check if room exists; join errors have their own event
 	if room == nil {
 		log.Printf("Room not found for join request: %s", event.QuizID)
 		errorEvent := models.Event{
@@ -211,30 +316,46 @@ func (ws *WebSocketService) handleJoin(client *models.Client, room *models.Room,
 			Message: "Room not found",
 		}
 		ws.sendEventToClient(client, errorEvent)
-		return
+		return refuseQuietly(models.ErrCodeNotFound, errorEvent.Message)
 	}
 
-	room.Mu.Lock()
-	defer room.Mu.Unlock()
+	if event.UserID == "" {
+		errorEvent := models.Event{
+			Type:    models.EventJoinError,
+			Message: "Player ID is required",
+		}
+		ws.sendEventToClient(client, errorEvent)
+		return refuseQuietly(models.ErrCodeInvalidArgument, errorEvent.Message)
+	}
 
-	player := &models.Player{
-		ID:        event.UserID,
-		UserID:    event.UserID,
-		ButtonID:  event.ButtonID,
-		Name:      event.Nickname,
-		Connected: true,
+	// Rejoining must go through resume so the player keeps their state and
+	// nobody can take over someone else's ID
+	if _, exists := room.Players[event.UserID]; exists {
+		errorEvent := models.Event{
+			Type:    models.EventJoinError,
+			Message: "Player ID is already in use, resume the session instead",
+		}
+		ws.sendEventToClient(client, errorEvent)
+		return refuseQuietly(models.ErrCodeConflict, errorEvent.Message)
 	}
-	room.Players[event.UserID] = player
+
+	ws.commit(room, client.Role, event)
+	player := room.Players[event.UserID]
 	client.UserID = event.UserID
-	client.RoomID = room.Code
+	client.Role = models.RolePlayer
+	ws.bindClient(room, client)
 	log.Printf("Player %s joined room %s", event.UserID, room.Code)
 
 	// Send success response with specific event type
 	successEvent := models.Event{
-		Type: models.EventJoinSuccess,
-		Data: room,
+		Type:         models.EventJoinSuccess,
+		Seq:          ws.roomSeq(room),
+		UserID:       event.UserID,
+		SessionToken: ws.signSession(room.Code, event.UserID),
+		Data:         ws.viewData(room, client),
 	}
 	ws.sendEventToClient(client, successEvent)
+	ws.startClockSync(client)
 
 	// Broadcast player joined event to all clients in the room
 	playerJoinedEvent := models.Event{
@@ -246,58 +367,42 @@ func (ws *WebSocketService) handleJoin(client *models.Client, room *models.Room,
 
 	// Broadcast to all clients in the room (this will send state event)
 	ws.broadcastRoomState(room)
+	return nil
 }
 
 // handleClick processes player click events
-func (ws *WebSocketService) handleClick(client *models.Client, room *models.Room, event models.Event) {
-	player, exists := room.Players[event.UserID]
-	if !exists {
-		// Auto-create player if not exists
-		player = &models.Player{
-			ID:        event.UserID,
-			UserID:    event.UserID,
-			ButtonID:  event.ButtonID,
-			Name:      fmt.Sprintf("Player %s", event.UserID),
-			Connected: true,
-		}
-		room.Players[event.UserID] = player
+func (ws *WebSocketService) handleClick(client *models.Client, room *models.Room, event models.Event) error {
+	player, err := joinedPlayer(client, room)
+	if err != nil {
+		return err
 	}
+	event.UserID = player.UserID
+	if room.QuestionActive && !isBuzzerQuestion(room) {
+		return refuseQuietly(models.ErrCodeInvalidState, "The question is answered with submit_answer")
+	}
+	entry := ws.commit(room, client.Role, event)
 
-	clickTime := time.Now()
-	player.LastClick = clickTime
-	player.ClickCount++
-
-	// Check for false start - allow clicks in both started and active phases
-	if (room.Phase != models.PhaseStarted && room.Phase != models.PhaseActive) || clickTime.Before(room.EnableAt) {
-		player.FalseStarts++
+	if isFalseStart(room, entry.Timestamp) {
 		log.Printf("False start by player %s (phase: %s)", event.UserID, room.Phase)
-	} else if room.Phase == models.PhaseActive && room.QuestionActive {
-		// This is a valid answer - set first answerer and deactivate question
-		if room.FirstAnswerer == "" {
-			room.FirstAnswerer = event.UserID
-			room.QuestionActive = false // Deactivate question after first answer
-			log.Printf("First answer received from player %s", event.UserID)
-		}
+		ws.penalizeFalseStart(room, event.UserID)
+	} else if canBuzz(room, event.UserID) {
+		// Valid answer - the buzz adjudication picks the first answerer or
+		// queues the player behind the current one
+		ws.acceptBuzz(client, room, entry)
 	}
 
 	log.Printf("Player %s clicked (total: %d, false starts: %d)",
 		event.UserID, player.ClickCount, player.FalseStarts)
 	ws.broadcastRoomState(room)
+	return nil
 }
 
 // handleHostSetState processes host state change events
-func (ws *WebSocketService) handleHostSetState(client *models.Client, room *models.Room, event models.Event) {
-	// Only allow admin/host role to change state
-	if client.Role != "admin" && client.Role != "host" {
-		log.Printf("Non-admin client attempted to change state, role: %s", client.Role)
-		return
-	}
+func (ws *WebSocketService) handleHostSetState(client *models.Client, room *models.Room, event models.Event) error {
+	ws.commit(room, client.Role, event)
 
 	if event.Phase == models.PhaseStarted {
 		// Transition to started phase - players can see button but it's not active yet
-		room.Phase = models.PhaseStarted
-		room.EnableAt = time.Now().Add(time.Duration(event.DelayMs) * time.Millisecond)
-
 		// Send phase changed event
 		phaseChangedEvent := models.Event{
 			Type:  models.EventPhaseChanged,
@@ -307,12 +412,14 @@ func (ws *WebSocketService) handleHostSetState(client *models.Client, room *mode
 
 		// Auto-transition to active after delay (if delay is specified)
 		if event.DelayMs > 0 {
-			go func() {
-				time.Sleep(time.Duration(event.DelayMs) * time.Millisecond)
-				room.Mu.Lock()
-				room.Phase = models.PhaseActive
-				room.QuestionActive = true // Enable question answering
-				room.Mu.Unlock()
+			ws.startTimer(room, TimerStartDelay, time.Duration(event.DelayMs)*time.Millisecond, func() {
+				if room.Phase != models.PhaseStarted {
+					return
+				}
+				ws.commit(room, "system", models.Event{
+					Type:  models.EventHostSetState,
+					Phase: models.PhaseActive,
+				})
 
 				// Send phase changed event for active phase
 				phaseChangedEvent := models.Event{
@@ -321,14 +428,13 @@ func (ws *WebSocketService) handleHostSetState(client *models.Client, room *mode
 				}
 				ws.broadcastToRoom(room, phaseChangedEvent)
 				ws.broadcastRoomState(room)
-			}()
+			})
+		} else {
+			ws.cancelTimer(room, TimerStartDelay)
 		}
 	} else if event.Phase == models.PhaseActive {
 		// Direct transition to active phase - players can now click
-		room.Phase = models.PhaseActive
-		room.EnableAt = time.Now()
-		room.QuestionActive = true // Enable question answering
-
+		ws.cancelTimer(room, TimerStartDelay)
 		// Send phase changed event
 		phaseChangedEvent := models.Event{
 			Type:  models.EventPhaseChanged,
@@ -336,11 +442,8 @@ func (ws *WebSocketService) handleHostSetState(client *models.Client, room *mode
 		}
 		ws.broadcastToRoom(room, phaseChangedEvent)
 	} else {
-		room.Phase = event.Phase
-		// Reset question state for non-active phases
-		if event.Phase != models.PhaseActive {
-			room.QuestionActive = false
-		}
+		// Leaving the game phases stops every countdown
+		ws.cancelRoomTimers(room)
 
 		// Send phase changed event
 		phaseChangedEvent := models.Event{
@@ -352,131 +455,138 @@ func (ws *WebSocketService) handleHostSetState(client *models.Client, room *mode
 
 	log.Printf("Room %s phase changed to %s by admin", room.ID, event.Phase)
 	ws.broadcastRoomState(room)
+	return nil
 }
 
-// broadcastRoomState sends room state to all clients in the room
+// broadcastRoomState sends every client in the room its view of the room
+// state, and nothing to those whose view did not change. Clients that asked
+// for deltas get a state_patch against the last state they got; they get the
+// full state instead every SnapshotEvery patches or when a patch would not be
+// smaller.
 func (ws *WebSocketService) broadcastRoomState(room *models.Room) {
-	stateEvent := models.Event{
-		Type: models.EventState,
-		Data: room,
-	}
-
-	message, err := json.Marshal(stateEvent)
-	if err != nil {
-		log.Printf("Error marshaling state: %v", err)
-		return
-	}
+	views := ws.newProjector(room)
+	fulls := make(map[*projection]*wireMessage)
+	patches := make(map[[2]*projection]*wireMessage) // Keyed by base and current view
+	var seq int64
+
+	for client, sync := range ws.actorOf(room).clients {
+		current := views.project(client)
+		if current == nil || (sync.last != nil && bytes.Equal(sync.last.encoded, current.encoded)) {
+			continue
+		}
+		if seq == 0 {
+			seq = ws.nextSeq(room)
+		}
+		full, ok := fulls[current]
+		if !ok {
+			if message := stateMessage(current, seq); message != nil {
+				full = newWireMessage(message)
+			}
+			fulls[current] = full
+		}
+		if full == nil {
+			continue
+		}
 
-	// Broadcast to all clients in the room
-	for client := range ws.hub.Clients {
-		if client.RoomID == room.Code {
-			select {
-			case client.Send <- message:
-			default:
-				close(client.Send)
-				delete(ws.hub.Clients, client)
+		if client.Delta && sync.last != nil && sync.patches < ws.opts.SnapshotEvery {
+			key := [2]*projection{sync.last, current}
+			patch, ok := patches[key]
+			if !ok {
+				if message := patchMessage(sync.last, current, sync.seq, seq); message != nil {
+					patch = newWireMessage(message)
+				}
+				patches[key] = patch
+			}
+			if patch != nil && len(patch.json) < len(full.json) {
+				ws.enqueue(client, patch, full)
+				*sync = viewSync{last: current, seq: seq, patches: sync.patches + 1}
+				continue
 			}
 		}
+		ws.enqueue(client, full, full)
+		*sync = viewSync{last: current, seq: seq}
 	}
 }
 
 // broadcastToRoom sends an event to all clients in a specific room
 func (ws *WebSocketService) broadcastToRoom(room *models.Room, event models.Event) {
-	message, err := json.Marshal(event)
+	out, err := ws.sequenceEvent(room, event, false)
 	if err != nil {
 		log.Printf("Error marshaling event: %v", err)
 		return
 	}
 
-	// Broadcast to all clients in the room
-	for client := range ws.hub.Clients {
-		if client.RoomID == room.Code {
-			select {
-			case client.Send <- message:
-			default:
-				close(client.Send)
-				delete(ws.hub.Clients, client)
-			}
-		}
+	// Broadcast to all clients in the room, user IDs to the staff only
+	for client := range ws.actorOf(room).clients {
+		ws.sendMessage(client, out.messageFor(isStaff(client)))
 	}
 }
 
 // handleCreateRoom processes room creation events
-func (ws *WebSocketService) handleCreateRoom(client *models.Client, event models.Event) {
-	roomCode := generateRoomCode()
-	adminPassword := generateAdminPassword()
-
-	room := &models.Room{
-		ID:            fmt.Sprintf("room_%d", time.Now().Unix()),
-		Code:          roomCode,
-		Phase:         models.PhaseLobby,
-		Players:       make(map[string]*models.Player),
-		Teams:         make(map[string]*models.Team),
-		CreatedAt:     time.Now(),
-		AdminPassword: adminPassword,
+func (ws *WebSocketService) handleCreateRoom(client *models.Client, event models.Event) error {
+	quiz, err := quizFromEvent(event)
+	if err != nil {
+		return refuse(models.ErrCodeInvalidArgument, err.Error())
 	}
 
-	ws.hub.Rooms[roomCode] = room
-	client.RoomID = roomCode
-	client.Role = "admin"
-
-	log.Printf("Room created: %s, Admin password: %s", roomCode, adminPassword)
-
-	// Send room creation response with specific event type
-	response := models.Event{
-		Type:       models.EventRoomCreated,
-		Data:       room,
-		AdminToken: adminPassword,
+	ws.createMu.Lock()
+	defer ws.createMu.Unlock()
+	if ws.opts.MaxRoomsPerIP > 0 && ws.roomsCreatedBy(client.IP) >= ws.opts.MaxRoomsPerIP {
+		log.Printf("Refused create_room from %s: room cap reached", client.IP)
+		return refuse(models.ErrCodeRateLimited, fmt.Sprintf("At most %d rooms may be open from one address", ws.opts.MaxRoomsPerIP))
 	}
 
-	ws.sendEventToClient(client, response)
-
-	// Also broadcast to all clients in the room (this will send state event)
-	ws.broadcastRoomState(room)
-}
-
-// handleAdminAuth processes admin authentication
-func (ws *WebSocketService) handleAdminAuth(client *models.Client, room *models.Room, event models.Event) {
-	if room.AdminPassword != event.Password {
-		ws.sendErrorToClient(client, "Invalid admin password")
-		return
+	roomCode := generateRoomCode()
+	for ws.GetRoom(roomCode) != nil {
+		roomCode = generateRoomCode()
 	}
+	room := &models.Room{DisplayCode: generateDisplayCode(), CreatorIP: client.IP}
+	createEvent := event
+	createEvent.QuizID = fmt.Sprintf("room_%d", time.Now().Unix())
+	createEvent.RoomCode = roomCode
+	createEvent.Quiz = quiz
+	createEvent.QuizSource = ""
+	ws.commit(room, "admin", createEvent)
+	apiKey := issueAPIKey(room)
+
+	ws.saveRoom(room)
+	ws.startActor(room)
+
+	log.Printf("Room created: %s", roomCode)
+
+	ws.call(roomCode, func(a *roomActor) {
+		ws.bindClient(room, client)
+		client.Role = models.RoleAdmin
+		client.AdminName = event.AdminName
+
+		// Send room creation response with specific event type
+		response := models.Event{
+			Type:       models.EventRoomCreated,
+			Data:       room,
+			AdminToken: ws.signAdminToken(room),
+			HostToken:  ws.signHostToken(room),
+			APIKey:     apiKey,
+		}
 
-	client.RoomID = event.RoomCode
-	client.Role = "admin"
+		ws.sendEventToClient(client, response)
 
-	log.Printf("Admin authenticated for room: %s", event.RoomCode)
-	ws.broadcastRoomState(room)
+		// Also broadcast to all clients in the room (this will send state event)
+		ws.broadcastRoomState(room)
+	})
+	return nil
 }
 
 // handleJoinTeam processes team join events
-func (ws *WebSocketService) handleJoinTeam(client *models.Client, room *models.Room, event models.Event) {
-	player, exists := room.Players[event.UserID]
-	if !exists {
-		log.Printf("Player %s not found in room, cannot join team", event.UserID)
-		ws.sendErrorToClient(client, "Player not found in room")
-		return
-	}
-
-	// Update player name if provided
-	if event.Nickname != "" {
-		player.Name = event.Nickname
+func (ws *WebSocketService) handleJoinTeam(client *models.Client, room *models.Room, event models.Event) error {
+	player, err := joinedPlayer(client, room)
+	if err != nil {
+		return err
 	}
+	event.UserID = player.UserID
 
 	// Add player to team
 	if team, exists := room.Teams[event.TeamID]; exists {
-		// Remove player from other teams first
-		for _, t := range room.Teams {
-			for i, p := range t.Players {
-				if p == event.UserID {
-					t.Players = append(t.Players[:i], t.Players[i+1:]...)
-					break
-				}
-			}
-		}
-
-		// Add to new team
-		team.Players = append(team.Players, event.UserID)
+		ws.commit(room, client.Role, event)
 		log.Printf("Player %s joined team %s", player.Name, team.Name)
 
 		// Send team joined event to all clients in the room
@@ -490,31 +600,26 @@ func (ws *WebSocketService) handleJoinTeam(client *models.Client, room *models.R
 		ws.broadcastToRoom(room, teamJoinedEvent)
 	} else {
 		log.Printf("Team %s not found", event.TeamID)
-		ws.sendErrorToClient(client, "Team not found")
-		return
+		return refuse(models.ErrCodeNotFound, "Team not found")
 	}
 
 	ws.broadcastRoomState(room)
+	return nil
 }
 
 // handleCreateTeam processes team creation events
-func (ws *WebSocketService) handleCreateTeam(client *models.Client, room *models.Room, event models.Event) {
-	if client.Role != "admin" {
-		ws.sendErrorToClient(client, "Only admin can create teams")
-		return
-	}
-
-	teamID := fmt.Sprintf("team_%d", time.Now().Unix())
-	team := &models.Team{
-		ID:        teamID,
-		Name:      event.TeamName,
-		Color:     event.TeamColor,
-		Players:   []string{},
-		Score:     0,
-		CreatedAt: time.Now(),
+func (ws *WebSocketService) handleCreateTeam(client *models.Client, room *models.Room, event models.Event) error {
+	// Numbered per room, skipping the IDs taken by teams already there
+	var teamID string
+	for n := len(room.Teams) + 1; ; n++ {
+		teamID = fmt.Sprintf("team_%d", n)
+		if _, taken := room.Teams[teamID]; !taken {
+			break
+		}
 	}
-
-	room.Teams[teamID] = team
+	event.TeamID = teamID
+	ws.commit(room, client.Role, event)
+	team := room.Teams[teamID]
 	log.Printf("Team created: %s (%s)", event.TeamName, teamID)
 
 	// Send team created event to all clients in the room
@@ -529,6 +634,7 @@ func (ws *WebSocketService) handleCreateTeam(client *models.Client, room *models
 
 	// Also broadcast room state
 	ws.broadcastRoomState(room)
+	return nil
 }
 
 // sendEventToClient sends an event to a specific client
@@ -538,12 +644,26 @@ func (ws *WebSocketService) sendEventToClient(client *models.Client, event model
 		log.Printf("Error marshaling event: %v", err)
 		return
 	}
+	ws.sendMessage(client, newWireMessage(message))
+}
 
-	select {
-	case client.Send <- message:
-	default:
-		close(client.Send)
-		delete(ws.hub.Clients, client)
+// sendMessage queues a message for a client; see enqueue for what happens
+// when the client cannot keep up
+func (ws *WebSocketService) sendMessage(client *models.Client, message *wireMessage) {
+	ws.enqueue(client, message, nil)
+}
+
+// sendEventToHosts sends an event only to admin/host clients of a room
+func (ws *WebSocketService) sendEventToHosts(room *models.Room, event models.Event) {
+	out, err := ws.sequenceEvent(room, event, true)
+	if err != nil {
+		log.Printf("Error marshaling event: %v", err)
+		return
+	}
+	for client := range ws.actorOf(room).clients {
+		if isStaff(client) {
+			ws.sendMessage(client, out.message)
+		}
 	}
 }
 
@@ -556,24 +676,6 @@ func (ws *WebSocketService) sendErrorToClient(client *models.Client, message str
 	ws.sendEventToClient(client, errorEvent)
 }
 
-func parseAllowedOrigins() []string {
-	raw := os.Getenv("WS_ALLOWED_ORIGINS")
-	if strings.TrimSpace(raw) == "" {
-		return nil
-	}
-	parts := strings.Split(raw, ",")
-	out := make([]string, 0, len(parts))
-	for _, p := range parts {
-		p = strings.TrimSpace(p)
-		if p != "" {
-			out = append(out, strings.TrimRight(p, "/"))
-		}
-	}
-	return out
-}
-
-var allowedOrigins = parseAllowedOrigins()
-
 func checkSameHost(origin string, host string) bool {
 	u, err := url.Parse(origin)
 	if err != nil {
@@ -583,7 +685,7 @@ func checkSameHost(origin string, host string) bool {
 	return (u.Scheme == "https" || u.Scheme == "http") && strings.EqualFold(originHost, host)
 }
 
-func originAllowed(origin, host string) bool {
+func originAllowed(origin, host string, allowedOrigins []string) bool {
 	if origin == "" {
 		return true
 	}
@@ -601,14 +703,17 @@ func originAllowed(origin, host string) bool {
 	return false
 }
 
-// GetUpgrader returns a configured WebSocket upgrader
-func GetUpgrader() websocket.Upgrader {
+// NewUpgrader returns a WebSocket upgrader configured by cfg
+func NewUpgrader(cfg config.WebSocketConfig) websocket.Upgrader {
+	allowedOrigins := cfg.AllowedOrigins
 	return websocket.Upgrader{
-		ReadBufferSize:  4096,
-		WriteBufferSize: 4096,
+		ReadBufferSize:    cfg.ReadBufferSize,
+		WriteBufferSize:   cfg.WriteBufferSize,
+		EnableCompression: cfg.EnableCompression,
+		Subprotocols:      Subprotocols,
 		CheckOrigin: func(r *http.Request) bool {
 			origin := r.Header.Get("Origin")
-			ok := originAllowed(origin, r.Host)
+			ok := originAllowed(origin, r.Host, allowedOrigins)
 			if !ok {
 				log.Printf("[WS] CheckOrigin reject: origin=%q host=%q allowed=%v ua=%q",
 					origin, r.Host, allowedOrigins, r.UserAgent())
@@ -620,58 +725,50 @@ func GetUpgrader() websocket.Upgrader {
 	}
 }
 
-// updateRoomActivity updates the last activity timestamp for a room
-func (ws *WebSocketService) updateRoomActivity(room *models.Room) {
-	if room != nil {
-		room.Mu.Lock()
-		room.LastActivity = time.Now()
-		room.Mu.Unlock()
-		log.Printf("Updated activity for room %s", room.Code)
-	}
-}
-
 // cleanupInactiveRooms removes rooms that haven't been active for more than 1 hour
 func (ws *WebSocketService) cleanupInactiveRooms() {
-	ws.hub.Mu.Lock()
-	defer ws.hub.Mu.Unlock()
-
 	cutoffTime := time.Now().Add(-1 * time.Hour)
-	var roomsToDelete []string
-
-	for roomCode, room := range ws.hub.Rooms {
-		room.Mu.RLock()
-		lastActivity := room.LastActivity
-		room.Mu.RUnlock()
-
-		if lastActivity.Before(cutoffTime) {
-			roomsToDelete = append(roomsToDelete, roomCode)
+	deleted := 0
+
+	for _, room := range ws.store.List() {
+		roomCode := room.Code
+		ws.call(roomCode, func(a *roomActor) {
+			lastActivity := a.room.LastActivity
+			if !lastActivity.Before(cutoffTime) {
+				return
+			}
 			log.Printf("Room %s marked for deletion (last activity: %v)", roomCode, lastActivity)
-		}
-	}
 
-	// Delete inactive rooms
-	for _, roomCode := range roomsToDelete {
-		delete(ws.hub.Rooms, roomCode)
-		log.Printf("Deleted inactive room: %s", roomCode)
+			if err := ws.store.Delete(roomCode); err != nil {
+				log.Printf("Error deleting room %s: %v", roomCode, err)
+				return
+			}
+			if err := ws.history.Delete(roomCode); err != nil {
+				log.Printf("Error deleting history of room %s: %v", roomCode, err)
+			}
+			ws.cancelRoomTimers(a.room)
+			ws.stopActor(a)
+			deleted++
+			log.Printf("Deleted inactive room: %s", roomCode)
+		})
 	}
 
-	if len(roomsToDelete) > 0 {
-		log.Printf("Cleaned up %d inactive rooms", len(roomsToDelete))
+	if deleted > 0 {
+		log.Printf("Cleaned up %d inactive rooms", deleted)
 	}
 }
 
 // handleStartQuestion processes question start events
-func (ws *WebSocketService) handleStartQuestion(client *models.Client, room *models.Room, event models.Event) {
-	// Only allow admin to start questions
-	if client.Role != "admin" && client.Role != "host" {
-		log.Printf("Non-admin client attempted to start question, role: %s", client.Role)
-		return
+func (ws *WebSocketService) handleStartQuestion(client *models.Client, room *models.Room, event models.Event) error {
+	// A prepared quiz picks the question; without one the question lives in PowerPoint
+	if event.QuestionID != "" && (room.Quiz == nil || questionIndex(room.Quiz, event.QuestionID) < 0) {
+		return refuse(models.ErrCodeNotFound, "Question not found")
 	}
-
-	// Start the question (no need to set correct answer - it will be handled in PowerPoint)
-	room.QuestionActive = true
-	room.FirstAnswerer = ""
-	room.QuestionStartTime = time.Now()
+	if room.Quiz != nil && event.QuestionID == "" && room.QuestionIndex >= len(room.Quiz.Questions) {
+		return refuse(models.ErrCodeInvalidState, "No more questions in quiz")
+	}
+	ws.commit(room, client.Role, event)
+	ws.startQuestionTimer(room, time.Duration(event.DurationMs)*time.Millisecond, nil)
 
 	log.Printf("Question started in room %s", room.Code)
 
@@ -679,28 +776,62 @@ func (ws *WebSocketService) handleStartQuestion(client *models.Client, room *mod
 	questionStartEvent := models.Event{
 		Type: models.EventStartQuestion,
 	}
+	if room.CurrentQuestion != nil {
+		questionStartEvent.QuestionID = room.CurrentQuestion.ID
+		questionStartEvent.Data = room.CurrentQuestion
+	}
 	ws.broadcastToRoom(room, questionStartEvent)
 
 	ws.broadcastRoomState(room)
+	return nil
 }
 
 // handleAnswerReceived processes answer events from players
-func (ws *WebSocketService) handleAnswerReceived(client *models.Client, room *models.Room, event models.Event) {
+func (ws *WebSocketService) handleAnswerReceived(client *models.Client, room *models.Room, event models.Event) error {
+	player, err := joinedPlayer(client, room)
+	if err != nil {
+		return err
+	}
+	event.UserID = player.UserID
+
 	// Check if question is active
 	if !room.QuestionActive {
 		log.Printf("Question not active, ignoring answer from %s", event.UserID)
-		return
+		return refuseQuietly(models.ErrCodeInvalidState, "Question not active")
 	}
 
 	// Check if someone already answered
 	if room.FirstAnswerer != "" {
 		log.Printf("Someone already answered, ignoring answer from %s", event.UserID)
-		return
+		return refuseQuietly(models.ErrCodeConflict, "Someone already answered")
+	}
+	if containsString(room.LockedOut, event.UserID) {
+		log.Printf("Player %s already answered this question", event.UserID)
+		return refuseQuietly(models.ErrCodeConflict, "Already answered this question")
 	}
 
-	// Set first answerer
-	room.FirstAnswerer = event.UserID
-	room.QuestionActive = false // Stop accepting more answers
+	// Grade the answer when the question comes from a prepared quiz
+	question := currentQuizQuestion(room)
+	if question != nil && event.Answer != "" {
+		event.IsCorrect = GradeAnswer(question, event.Answer)
+	}
+
+	// Set first answerer and stop accepting more answers
+	ws.commit(room, client.Role, event)
+	ws.pauseTimer(room, TimerQuestion)
+
+	if question != nil && event.Answer != "" {
+		gradedEvent := models.Event{
+			Type:          models.EventAnswerGraded,
+			UserID:        event.UserID,
+			QuestionID:    question.ID,
+			Answer:        event.Answer,
+			CorrectAnswer: question.CorrectAnswer,
+			IsCorrect:     event.IsCorrect,
+			Points:        question.Points,
+		}
+		ws.sendEventToHosts(room, gradedEvent)
+	}
 
 	log.Printf("First answer received from %s", event.UserID)
 
@@ -713,104 +844,106 @@ func (ws *WebSocketService) handleAnswerReceived(client *models.Client, room *mo
 	ws.broadcastToRoom(room, answerEvent)
 
 	ws.broadcastRoomState(room)
+	return nil
 }
 
 // handleAnswerConfirmation processes answer confirmation events
-func (ws *WebSocketService) handleAnswerConfirmation(client *models.Client, room *models.Room, event models.Event) {
-	// Check if user is admin/host
-	if client.Role != "admin" && client.Role != "host" {
-		log.Printf("Non-admin client attempted to confirm answer, role: %s", client.Role)
-		return
-	}
-
+func (ws *WebSocketService) handleAnswerConfirmation(client *models.Client, room *models.Room, event models.Event) error {
 	// Check if there's a first answerer
 	if room.FirstAnswerer == "" {
 		log.Printf("No first answerer to confirm")
-		return
+		return refuseQuietly(models.ErrCodeInvalidState, "No answer to confirm")
 	}
 
 	// Get player info
 	player, exists := room.Players[room.FirstAnswerer]
 	if !exists {
 		log.Printf("First answerer player not found: %s", room.FirstAnswerer)
-		return
+		return refuseQuietly(models.ErrCodeNotFound, "Player not found in room")
 	}
 
 	// Get player's team
-	var playerTeam *models.Team
-	for _, team := range room.Teams {
-		for _, playerID := range team.Players {
-			if playerID == room.FirstAnswerer {
-				playerTeam = team
-				break
-			}
-		}
-		if playerTeam != nil {
-			break
-		}
+	playerTeam := findPlayerTeam(room, room.FirstAnswerer)
+
+	// Resolve the award so the recorded event carries exactly what was applied
+	confirmed := event
+	confirmed.UserID = room.FirstAnswerer
+	confirmed.TeamID = ""
+	confirmed.AdminName = adminIdentity(client)
+	confirmed.Points = scoreAnswer(room, player, event.IsCorrect, event.Points, room.BuzzTimes[room.FirstAnswerer])
+	if playerTeam != nil {
+		confirmed.TeamID = playerTeam.ID
 	}
-
-	// Award points if correct
-	if event.IsCorrect && playerTeam != nil {
-		points := event.Points
-		if points <= 0 {
-			points = 10 // Default points
-		}
-		playerTeam.Score += points
-		log.Printf("Awarded %d points to team %s for correct answer", points, playerTeam.Name)
+	if confirmed.Points != 0 {
+		log.Printf("Awarded %d points to player %s (correct=%v)", confirmed.Points, player.Name, event.IsCorrect)
+	}
+	if !event.IsCorrect && room.Quiz != nil && room.Quiz.ExcludeTeamOnWrong {
+		confirmed.ExcludeTeam = true
 	}
 
-	// Reset question state
-	room.QuestionActive = false
-	room.FirstAnswerer = ""
+	// Award points, or pass the turn on to the next player in the queue
+	ws.commit(room, client.Role, confirmed)
+	if event.IsCorrect {
+		ws.cancelTimer(room, TimerQuestion)
+	} else if room.QuestionActive {
+		// Nobody left in the queue, the question is open again
+		ws.resumeTimer(room, TimerQuestion)
+	}
 
 	log.Printf("Answer confirmed: correct=%v, points=%d", event.IsCorrect, event.Points)
 
 	// Broadcast confirmation event
 	confirmationEvent := models.Event{
 		Type:          models.EventAnswerConfirmation,
+		UserID:        confirmed.UserID,
+		TeamID:        confirmed.TeamID,
 		IsCorrect:     event.IsCorrect,
-		Points:        event.Points,
+		Points:        confirmed.Points,
 		PlayerName:    player.Name,
 		CorrectAnswer: event.CorrectAnswer,
 	}
 	ws.broadcastToRoom(room, confirmationEvent)
 
+	if room.FirstAnswerer != "" {
+		next := room.Players[room.FirstAnswerer]
+		turnEvent := models.Event{
+			Type:   models.EventBuzzTurn,
+			UserID: room.FirstAnswerer,
+		}
+		if next != nil {
+			turnEvent.PlayerName = next.Name
+		}
+		log.Printf("Turn passed to player %s in room %s", room.FirstAnswerer, room.Code)
+		ws.broadcastToRoom(room, turnEvent)
+	}
+
+	ws.broadcastLeaderboard(room)
+
 	ws.broadcastRoomState(room)
+	return nil
 }
 
 // handleShowAnswer processes show answer events
-func (ws *WebSocketService) handleShowAnswer(client *models.Client, room *models.Room, event models.Event) {
-	// Only allow admin to show answers
-	if client.Role != "admin" && client.Role != "host" {
-		log.Printf("Non-admin client attempted to show answer, role: %s", client.Role)
-		return
-	}
-
+func (ws *WebSocketService) handleShowAnswer(client *models.Client, room *models.Room, event models.Event) error {
+	ws.commit(room, client.Role, event)
 	log.Printf("Showing answer in room %s", room.Code)
 
 	// Broadcast show answer event
 	showAnswerEvent := models.Event{
-		Type: models.EventShowAnswer,
+		Type:          models.EventShowAnswer,
+		CorrectAnswer: room.CorrectAnswer,
 	}
 	ws.broadcastToRoom(room, showAnswerEvent)
 
 	ws.broadcastRoomState(room)
+	return nil
 }
 
 // handleNextQuestion processes next question events
-func (ws *WebSocketService) handleNextQuestion(client *models.Client, room *models.Room, event models.Event) {
-	// Only allow admin to go to next question
-	if client.Role != "admin" && client.Role != "host" {
-		log.Printf("Non-admin client attempted to go to next question, role: %s", client.Role)
-		return
-	}
-
+func (ws *WebSocketService) handleNextQuestion(client *models.Client, room *models.Room, event models.Event) error {
 	// Reset question state
-	room.QuestionActive = false
-	room.FirstAnswerer = ""
-	room.CorrectAnswer = ""
-	room.QuestionStartTime = time.Time{}
+	ws.commit(room, client.Role, event)
+	ws.cancelRoomTimers(room)
 
 	log.Printf("Next question in room %s", room.Code)
 
@@ -821,18 +954,86 @@ func (ws *WebSocketService) handleNextQuestion(client *models.Client, room *mode
 	ws.broadcastToRoom(room, nextQuestionEvent)
 
 	ws.broadcastRoomState(room)
+	return nil
 }
 
 // GetRoom returns a room by its code
 func (ws *WebSocketService) GetRoom(roomCode string) *models.Room {
-	ws.hub.Mu.RLock()
-	defer ws.hub.Mu.RUnlock()
-	return ws.hub.Rooms[roomCode]
+	room, _ := ws.store.Get(roomCode)
+	return room
+}
+
+// ActivateQuestion starts a question on behalf of the PowerPoint API. A
+// positive duration deactivates the question when it runs out.
+func (ws *WebSocketService) ActivateQuestion(room *models.Room, duration time.Duration) {
+	ws.call(room.Code, func(a *roomActor) {
+		ws.commit(room, "host", models.Event{Type: models.EventStartQuestion})
+		ws.startQuestionTimer(room, duration, func() {
+			ws.timeUp(room)
+			ws.deactivateQuestion(room)
+		})
+		ws.saveRoom(room)
+
+		// Broadcast to all clients in the room
+		questionStartEvent := models.Event{
+			Type: models.EventStartQuestion,
+		}
+		ws.broadcastToRoom(room, questionStartEvent)
+	})
+}
+
+// DeactivateQuestion stops accepting answers on behalf of the PowerPoint API
+func (ws *WebSocketService) DeactivateQuestion(room *models.Room) {
+	ws.call(room.Code, func(a *roomActor) {
+		ws.cancelTimer(room, TimerQuestion)
+		ws.deactivateQuestion(room)
+		ws.saveRoom(room)
+	})
+}
+
+// deactivateQuestion records the deactivation and tells the add-ins to move
+// on
+func (ws *WebSocketService) deactivateQuestion(room *models.Room) {
+	ws.commit(room, "host", models.Event{Type: models.EventDeactivateQuestion})
+	log.Printf("Question deactivated for room %s", room.Code)
+
+	nextQuestionEvent := models.Event{
+		Type: models.EventNextQuestion,
+	}
+	ws.broadcastToRoom(room, nextQuestionEvent)
+}
+
+// SaveRoom persists the current state of a room after it was changed outside
+// HandleEvent (e.g. by the PowerPoint REST API)
+func (ws *WebSocketService) SaveRoom(room *models.Room) {
+	ws.call(room.Code, func(a *roomActor) {
+		a.dirty = true
+		ws.saveRoom(room)
+	})
+}
+
+// saveRoom writes a room to the store if it changed since it was last
+// saved; called from the room's actor. A room without an actor yet is
+// always written.
+func (ws *WebSocketService) saveRoom(room *models.Room) {
+	a := ws.actorOf(room)
+	if a != nil && !a.dirty {
+		return
+	}
+	if err := ws.store.Put(room); err != nil {
+		log.Printf("Error saving room %s: %v", room.Code, err)
+		return
+	}
+	if a != nil {
+		a.dirty = false
+	}
 }
 
 // BroadcastToRoom sends an event to all clients in a specific room
 func (ws *WebSocketService) BroadcastToRoom(room *models.Room, event models.Event) {
-	ws.broadcastToRoom(room, event)
+	ws.post(room.Code, func(a *roomActor) {
+		ws.broadcastToRoom(room, event)
+	})
 }
 
 // StartRoomCleanup starts a background goroutine to clean up inactive rooms every 30 minutes
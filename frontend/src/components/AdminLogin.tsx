@@ -40,7 +40,6 @@ export const AdminLogin: React.FC<AdminLoginProps> = ({ onSuccess, createRoom, a
     if (room && adminPassword && isCreating) {
       console.log('🏠 [AdminLogin] Room created successfully with password');
       console.log('🏠 [AdminLogin] Room data:', room);
-      console.log('🔑 [AdminLogin] Admin password:', adminPassword);
       setIsCreating(false); // Reset loading state
       // Don't call onSuccess immediately, show password first
     }
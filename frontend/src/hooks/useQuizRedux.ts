@@ -109,7 +109,6 @@ export const useQuiz = () => {
               dispatch(setUser(adminUser));
               dispatch(setAdminPassword(event.adminToken));
               console.log('👤 [useQuiz] Set admin user:', adminUser);
-              console.log('🔑 [useQuiz] Set admin password:', event.adminToken);
             }
             
             // Save room data to localStorage for reconnection